@@ -5,86 +5,205 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/feedhenry/fh-system-dump-tool/openshift/api/types"
 )
 
 // A CheckResult is the result of some verification of the system conditions.
+// It is part of the format of analysis.json: the description tags document
+// its JSON Schema, see AnalysisSchema.
 type CheckResult struct {
-	CheckName string        `json:"name"`
-	Ok        bool          `json:"ok"`
-	Message   string        `json:"message"`
-	Info      []Info        `json:"info,omitempty"`
-	Events    []types.Event `json:"events,omitempty"`
+	CheckID   string       `json:"id,omitempty" description:"Stable identifier of the check."`
+	CheckName string       `json:"name" description:"Human-readable name of the check."`
+	Severity  Severity     `json:"severity,omitempty" description:"How important an issue detected by the check is."`
+	DocURL    string       `json:"docURL,omitempty" description:"Link to documentation about the issue."`
+	Ok        bool         `json:"ok" description:"Whether the check passed."`
+	Message   string       `json:"message" description:"Outcome of the check."`
+	Info      []Info       `json:"info,omitempty" description:"Resources involved in the issue."`
+	Events    []CheckEvent `json:"events,omitempty" description:"Events that revealed the issue."`
 }
 
 // ProjectResult stores the results of checks in a project.
 type ProjectResult struct {
-	Project string        `json:"project"`
-	Results []CheckResult `json:"checks"`
+	Project string        `json:"project" description:"Name of the project."`
+	Results []CheckResult `json:"checks" description:"Results of the checks run against the project."`
 }
 
 // AnalysisResult aggregates the result of checks executed against the system.
-// It is used to dump analysis results to a JSON file.
+// It is written to analysis.json as part of an AnalysisReport.
 type AnalysisResult struct {
-	Platform []CheckResult   `json:"platform,omitempty"`
-	Projects []ProjectResult `json:"projects,omitempty"`
+	Platform []CheckResult   `json:"platform,omitempty" description:"Results of platform-wide checks."`
+	Projects []ProjectResult `json:"projects,omitempty" description:"Results of checks per project."`
+}
+
+// Merge adds the checks in other to r. Checks of a project already in r are
+// appended to the existing project results.
+func (r *AnalysisResult) Merge(other AnalysisResult) {
+	r.Platform = append(r.Platform, other.Platform...)
+	for _, projectResult := range other.Projects {
+		merged := false
+		for i := range r.Projects {
+			if r.Projects[i].Project == projectResult.Project {
+				r.Projects[i].Results = append(r.Projects[i].Results, projectResult.Results...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			r.Projects = append(r.Projects, projectResult)
+		}
+	}
 }
 
 // Info is a piece of information regarding a check, multiple Info can be
 // attached to a single Result.
 type Info struct {
-	Name      string `json:"name"`
-	Namespace string `json:"namespace"`
-	Message   string `json:"message"`
+	Name      string `json:"name" description:"Name of the resource."`
+	Namespace string `json:"namespace" description:"Project of the resource."`
+	Message   string `json:"message" description:"What is wrong with the resource."`
+}
+
+// A CheckEvent is an event attached to a check result. It keeps the fields of
+// OpenShift events that matter to analysis, so that analysis.json does not
+// change with the API of the cluster.
+type CheckEvent struct {
+	Kind           string     `json:"kind,omitempty" description:"Kind of the object the event is about."`
+	Namespace      string     `json:"namespace,omitempty" description:"Project of the object the event is about."`
+	Name           string     `json:"name,omitempty" description:"Name of the object the event is about."`
+	Type           string     `json:"type,omitempty" description:"Type of the event, such as Warning."`
+	Reason         string     `json:"reason,omitempty" description:"Short, machine-readable reason of the event."`
+	Message        string     `json:"message" description:"Human-readable description of the event."`
+	Count          int32      `json:"count,omitempty" description:"Number of times the event occurred."`
+	FirstTimestamp *time.Time `json:"firstTimestamp,omitempty" description:"Time the event first occurred."`
+	LastTimestamp  *time.Time `json:"lastTimestamp,omitempty" description:"Time the event last occurred."`
+}
+
+// newCheckEvent converts an OpenShift event to a CheckEvent.
+func newCheckEvent(event types.Event) CheckEvent {
+	e := CheckEvent{
+		Kind:      event.InvolvedObject.Kind,
+		Namespace: event.InvolvedObject.Namespace,
+		Name:      event.InvolvedObject.Name,
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Message:   event.Message,
+		Count:     event.Count,
+	}
+	if t := event.FirstTimestamp; !t.IsZero() {
+		e.FirstTimestamp = &t
+	}
+	if t := event.LastTimestamp; !t.IsZero() {
+		e.LastTimestamp = &t
+	}
+	return e
 }
 
 // GetAnalysisTasks creates all the analysis tasks and sends them one by one
 // down the tasks Channel.
-func GetAnalysisTasks(tasks chan<- Task, basepath string, projects []string, results chan<- AnalysisResult) {
+func GetAnalysisTasks(tasks chan<- Task, checks []Check, basepath string, projects []string, results chan<- AnalysisResult) {
 	// Platform-wide analysis goes here.
 
 	// Project-specific analysis goes here.
 	for _, p := range projects {
-		definition := &definitionLoader{basepath: basepath, project: p}
-		tasks <- CheckProjectTask(p, definition, results)
+		tasks <- CheckProjectTask(checks, newCheckEnv(basepath, p), results)
 	}
 }
 
-// CheckProjectTask returns a task that diagnoses problems in the project scope.
-func CheckProjectTask(project string, definition DefinitionLoader, results chan<- AnalysisResult) Task {
-	return func() error {
-		result := ProjectResult{Project: project}
+// newCheckEnv returns the environment of checks of a project in the dump in
+// basepath.
+func newCheckEnv(basepath, project string) CheckEnv {
+	return CheckEnv{
+		Project:  project,
+		Basepath: basepath,
+		NewDefinition: func() DefinitionLoader {
+			return &definitionLoader{basepath: basepath, project: project}
+		},
+		Collected: func(kind string) bool {
+			return collected(basepath, project, kind)
+		},
+	}
+}
 
-		var (
-			events            types.EventList
-			deploymentConfigs types.DeploymentConfigList
-			pods              types.PodList
-		)
+// collected reports whether data of the given kind was collected in a project
+// of the dump in basepath: either resource definitions, or a directory of data
+// such as the status of MongoDB replica sets. Definitions that could not be
+// fetched are empty files, and do not count as collected.
+func collected(basepath, project, kind string) bool {
+	dir := filepath.Join(basepath, "projects", project)
+	if fi, err := os.Stat(filepath.Join(dir, "definitions", kind+".json")); err == nil && fi.Size() > 0 {
+		return true
+	}
+	fi, err := os.Stat(filepath.Join(dir, kind))
+	return err == nil && fi.IsDir()
+}
 
-		definition.Load("events", &events)
-		definition.Load("deploymentconfigs", &deploymentConfigs)
-		definition.Load("pods", &pods)
+// CheckProjectTask returns a task that runs checks to diagnose problems in the
+// project scope. Checks that are not applicable to the project, including
+// checks requiring data that was not collected, produce no result. Checks that
+// fail to run are returned as a MultiError of TaskErrors, one per check, after
+// the results of the other checks are sent.
+func CheckProjectTask(checks []Check, env CheckEnv, results chan<- AnalysisResult) Task {
+	return func() error {
+		result := ProjectResult{Project: env.Project}
 
-		if err := definition.Err(); err != nil {
-			return err
+		var errs MultiError
+		for _, c := range checks {
+			if !requirementsCollected(c, env) {
+				continue
+			}
+			checkEnv := env
+			if env.NewDefinition != nil {
+				checkEnv.Definition = env.NewDefinition()
+			}
+			checkResult, err := c.Run(checkEnv)
+			if err == errNotApplicable {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, &TaskError{Check: c.ID(), Project: env.Project, Err: err})
+				continue
+			}
+			checkResult.CheckID = c.ID()
+			checkResult.Severity = c.Severity()
+			checkResult.DocURL = c.DocURL()
+			result.Results = append(result.Results, checkResult)
 		}
 
-		result.Results = append(result.Results,
-			CheckEvents(events),
-			CheckDeploymentConfigs(deploymentConfigs),
-			CheckPods(pods),
-		)
+		if len(result.Results) > 0 {
+			results <- AnalysisResult{Projects: []ProjectResult{result}}
+		}
 
-		results <- AnalysisResult{Projects: []ProjectResult{result}}
+		switch len(errs) {
+		case 0:
+			return nil
+		case 1:
+			return errs[0]
+		}
+		return errs
+	}
+}
 
-		return nil
+// requirementsCollected reports whether all the data c requires was collected
+// in the project of env.
+func requirementsCollected(c Check, env CheckEnv) bool {
+	if env.Collected == nil {
+		return true
 	}
+	for _, kind := range c.Requires() {
+		if !env.Collected(kind) {
+			return false
+		}
+	}
+	return true
 }
 
-// A DefinitionLoader loads definitions of OpenShift resources.
+// A DefinitionLoader loads definitions of OpenShift resources. After an error,
+// Load does nothing and Err returns the error.
 type DefinitionLoader interface {
 	Load(kind string, v interface{})
 	Err() error
@@ -140,6 +259,58 @@ func CheckPods(pods types.PodList) CheckResult {
 	return result
 }
 
+// CheckInitContainers checks pods that did not finish initializing, looking for
+// init containers that exited with a failure. Such pods show up as stuck in the
+// Init state, and never get to start their regular containers.
+func CheckInitContainers(pods types.PodList) CheckResult {
+	result := CheckResult{
+		CheckName: "check pods stuck in init with failing init containers",
+		Ok:        true,
+		Message:   "this issue was not detected",
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != types.PodPending {
+			continue
+		}
+		for _, container := range pod.Status.InitContainerStatuses {
+			terminated := failedTermination(container)
+			if terminated == nil {
+				continue
+			}
+			result.Ok = false
+			result.Message = "one or more pods are stuck in init with a failing init container"
+			msg := fmt.Sprintf("init container %s in pod %s failed with exit code %d", container.Name, pod.ObjectMeta.Name, terminated.ExitCode)
+			if terminated.Reason != "" {
+				msg += fmt.Sprintf(" (%s)", terminated.Reason)
+			}
+			if container.RestartCount > 0 {
+				msg += fmt.Sprintf(", restarted %d times", container.RestartCount)
+			}
+			result.Info = append(result.Info, Info{
+				Name:      container.Name,
+				Namespace: pod.ObjectMeta.Namespace,
+				Message:   msg,
+			})
+		}
+	}
+	return result
+}
+
+// failedTermination returns the termination state of a container that exited
+// with a non-zero exit code, either in its current state or in the last
+// termination while it is waiting to be restarted. It returns nil otherwise.
+func failedTermination(container types.ContainerStatus) *types.ContainerStateTerminated {
+	if t := container.State.Terminated; t != nil && t.ExitCode != 0 {
+		return t
+	}
+	if container.State.Waiting != nil {
+		if t := container.LastTerminationState.Terminated; t != nil && t.ExitCode != 0 {
+			return t
+		}
+	}
+	return nil
+}
+
 // CheckEvents checks all events looking for events which type is not Normal
 // (i.e., Warning or Error).
 func CheckEvents(events types.EventList) CheckResult {
@@ -152,7 +323,7 @@ func CheckEvents(events types.EventList) CheckResult {
 		if event.Type != "Normal" {
 			result.Ok = false
 			result.Message = "errors detected in event log"
-			result.Events = append(result.Events, event)
+			result.Events = append(result.Events, newCheckEvent(event))
 		}
 	}
 	return result
@@ -180,27 +351,73 @@ func CheckDeploymentConfigs(deploymentConfigs types.DeploymentConfigList) CheckR
 	return result
 }
 
+// FilterBySeverity returns a copy of analysisResult with only the checks of
+// severity min or higher.
+func FilterBySeverity(analysisResult AnalysisResult, min Severity) AnalysisResult {
+	keep := func(results []CheckResult) []CheckResult {
+		var filtered []CheckResult
+		for _, r := range results {
+			if r.Severity.Rank() >= min.Rank() {
+				filtered = append(filtered, r)
+			}
+		}
+		return filtered
+	}
+	filtered := AnalysisResult{Platform: keep(analysisResult.Platform)}
+	for _, projectResult := range analysisResult.Projects {
+		if results := keep(projectResult.Results); len(results) > 0 {
+			filtered.Projects = append(filtered.Projects, ProjectResult{Project: projectResult.Project, Results: results})
+		}
+	}
+	return filtered
+}
+
+// A projectIssue is a failed check of a project.
+type projectIssue struct {
+	project string
+	result  CheckResult
+}
+
+// bySeverity sorts issues from the most to the least severe.
+type bySeverity []projectIssue
+
+func (s bySeverity) Len() int      { return len(s) }
+func (s bySeverity) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySeverity) Less(i, j int) bool {
+	return s[i].result.Severity.Rank() > s[j].result.Severity.Rank()
+}
+
 // PrintAnalysisReport writes a summary of problems found in analysisResult to
-// out.
+// out. Problems are listed from the most to the least severe.
 func PrintAnalysisReport(analysisResult AnalysisResult, out io.Writer) {
-	ok := true
+	var issues []projectIssue
 	// TODO: handle analysisResult.Platform.
 	for _, projectResult := range analysisResult.Projects {
 		for _, checkResult := range projectResult.Results {
 			if !checkResult.Ok {
-				ok = false
-				fmt.Fprintf(out, "Potential issue in project %s: %s\n", projectResult.Project, checkResult.CheckName)
-				fmt.Fprintf(out, "  Details:\n")
-				for _, info := range checkResult.Info {
-					fmt.Fprintf(out, "    %s\n", strings.Replace(strings.TrimSpace(info.Message), "\n", "\n    ", -1))
-				}
-				for _, event := range checkResult.Events {
-					fmt.Fprintf(out, "    %s\n", strings.Replace(strings.TrimSpace(event.Message), "\n", "\n    ", -1))
-				}
+				issues = append(issues, projectIssue{projectResult.Project, checkResult})
 			}
 		}
 	}
-	if ok {
+	sort.Stable(bySeverity(issues))
+	for _, issue := range issues {
+		checkResult := issue.result
+		if checkResult.Severity != "" {
+			fmt.Fprintf(out, "[%s] ", checkResult.Severity)
+		}
+		fmt.Fprintf(out, "Potential issue in project %s: %s\n", issue.project, checkResult.CheckName)
+		fmt.Fprintf(out, "  Details:\n")
+		for _, info := range checkResult.Info {
+			fmt.Fprintf(out, "    %s\n", strings.Replace(strings.TrimSpace(info.Message), "\n", "\n    ", -1))
+		}
+		for _, event := range checkResult.Events {
+			fmt.Fprintf(out, "    %s\n", strings.Replace(strings.TrimSpace(event.Message), "\n", "\n    ", -1))
+		}
+		if checkResult.DocURL != "" {
+			fmt.Fprintf(out, "  See: %s\n", checkResult.DocURL)
+		}
+	}
+	if len(issues) == 0 {
 		fmt.Fprintln(out, "No issues found")
 	}
 }
@@ -3,7 +3,11 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -45,6 +49,32 @@ var (
 			},
 		},
 	}
+	podInitFailing = types.Pod{
+		ObjectMeta: types.ObjectMeta{
+			Name:      "fh-mbaas-3-xk2ds",
+			Namespace: "qe-3node-4-1",
+		},
+		Status: types.PodStatus{
+			Phase: types.PodPending,
+			InitContainerStatuses: []types.ContainerStatus{
+				{
+					Name: "wait-for-mongodb",
+					State: types.ContainerState{
+						Waiting: &types.ContainerStateWaiting{
+							Reason: "CrashLoopBackOff",
+						},
+					},
+					LastTerminationState: types.ContainerState{
+						Terminated: &types.ContainerStateTerminated{
+							ExitCode: 1,
+							Reason:   "Error",
+						},
+					},
+					RestartCount: 7,
+				},
+			},
+		},
+	}
 )
 
 var (
@@ -93,7 +123,7 @@ func TestCheckEvents(t *testing.T) {
 				CheckName: "check event log for errors",
 				Ok:        false,
 				Message:   "errors detected in event log",
-				Events:    []types.Event{warningEvent},
+				Events:    []CheckEvent{newCheckEvent(warningEvent)},
 			},
 		},
 	}
@@ -191,6 +221,75 @@ func TestCheckPods(t *testing.T) {
 	}
 }
 
+func TestCheckInitContainers(t *testing.T) {
+	podInitDone := podInitFailing
+	podInitDone.Status = types.PodStatus{
+		Phase: types.PodRunning,
+		InitContainerStatuses: []types.ContainerStatus{
+			{
+				Name: "wait-for-mongodb",
+				State: types.ContainerState{
+					Terminated: &types.ContainerStateTerminated{
+						ExitCode: 0,
+						Reason:   "Completed",
+					},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		description string
+		podList     types.PodList
+		want        CheckResult
+	}{
+		{
+			description: "pods without init containers",
+			podList: types.PodList{
+				Items: []types.Pod{podOk, podWaiting},
+			},
+			want: CheckResult{
+				CheckName: "check pods stuck in init with failing init containers",
+				Ok:        true,
+				Message:   "this issue was not detected",
+			},
+		},
+		{
+			description: "pod with completed init container",
+			podList: types.PodList{
+				Items: []types.Pod{podInitDone},
+			},
+			want: CheckResult{
+				CheckName: "check pods stuck in init with failing init containers",
+				Ok:        true,
+				Message:   "this issue was not detected",
+			},
+		},
+		{
+			description: "pod with failing init container",
+			podList: types.PodList{
+				Items: []types.Pod{podInitFailing},
+			},
+			want: CheckResult{
+				CheckName: "check pods stuck in init with failing init containers",
+				Ok:        false,
+				Message:   "one or more pods are stuck in init with a failing init container",
+				Info: []Info{
+					{
+						Name:      "wait-for-mongodb",
+						Namespace: podInitFailing.ObjectMeta.Namespace,
+						Message:   "init container wait-for-mongodb in pod fh-mbaas-3-xk2ds failed with exit code 1 (Error), restarted 7 times",
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := CheckInitContainers(tt.podList); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: CheckInitContainers(podList) = \n%#v, want \n%#v", tt.description, got, tt.want)
+		}
+	}
+}
+
 func TestCheckProjectTask(t *testing.T) {
 	tests := []struct {
 		project    string
@@ -216,6 +315,11 @@ func TestCheckProjectTask(t *testing.T) {
 					Ok:        true,
 					Message:   "this issue was not detected",
 				},
+				{
+					CheckName: "check pods stuck in init with failing init containers",
+					Ok:        true,
+					Message:   "this issue was not detected",
+				},
 			},
 		},
 		{
@@ -228,7 +332,7 @@ func TestCheckProjectTask(t *testing.T) {
 					Items: []types.DeploymentConfig{dcZeroReplicas},
 				},
 				"pods": types.PodList{
-					Items: []types.Pod{podOk, podWaiting},
+					Items: []types.Pod{podOk, podWaiting, podInitFailing},
 				},
 			},
 			want: []CheckResult{
@@ -236,7 +340,7 @@ func TestCheckProjectTask(t *testing.T) {
 					CheckName: "check event log for errors",
 					Ok:        false,
 					Message:   "errors detected in event log",
-					Events:    []types.Event{warningEvent},
+					Events:    []CheckEvent{newCheckEvent(warningEvent)},
 				},
 				{
 					CheckName: "check number of replicas in deployment configs",
@@ -263,17 +367,42 @@ func TestCheckProjectTask(t *testing.T) {
 						},
 					},
 				},
+				{
+					CheckName: "check pods stuck in init with failing init containers",
+					Ok:        false,
+					Message:   "one or more pods are stuck in init with a failing init container",
+					Info: []Info{
+						{
+							Name:      "wait-for-mongodb",
+							Namespace: podInitFailing.ObjectMeta.Namespace,
+							Message:   "init container wait-for-mongodb in pod fh-mbaas-3-xk2ds failed with exit code 1 (Error), restarted 7 times",
+						},
+					},
+				},
 			},
 		},
 	}
+	checks, err := DefaultChecks.Select([]string{"events", "deploymentconfig-replicas", "pods-waiting", "pods-init", "mongodb-replica-set"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 	for i, tt := range tests {
 		results := make(chan AnalysisResult, 1)
-		task := CheckProjectTask(tt.project, tt.definition, results)
+		env := CheckEnv{Project: tt.project, Definition: tt.definition}
+		task := CheckProjectTask(checks, env, results)
 
 		if err := task(); err != nil {
 			t.Errorf("%d: task() = %v, want %v", i, err, nil)
 		}
 
+		// Checks are run in order, except for the MongoDB check, that
+		// is not applicable since there is no MongoDB data.
+		for j := range tt.want {
+			tt.want[j].CheckID = checks[j].ID()
+			tt.want[j].Severity = checks[j].Severity()
+			tt.want[j].DocURL = checks[j].DocURL()
+		}
+
 		want := AnalysisResult{
 			Projects: []ProjectResult{
 				{
@@ -307,6 +436,119 @@ func (l fakeDefinitionLoader) Err() error {
 
 var _ DefinitionLoader = (*fakeDefinitionLoader)(nil)
 
+func TestCheckProjectTaskError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-check-project-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	definitions := filepath.Join(dir, "projects", "core", "definitions")
+	if err := os.MkdirAll(definitions, 0770); err != nil {
+		t.Fatal(err)
+	}
+	// Events are corrupt, pods are fine and deployment configs could not
+	// be fetched.
+	for name, content := range map[string]string{"events.json": "{", "pods.json": `{"items": []}`, "deploymentconfigs.json": ""} {
+		if err := ioutil.WriteFile(filepath.Join(definitions, name), []byte(content), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := make(chan AnalysisResult, 1)
+	checks, err := DefaultChecks.Select([]string{"events", "deploymentconfig-replicas", "pods-waiting"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := CheckProjectTask(checks, newCheckEnv(dir, "core"), results)
+	if err := task(); err == nil || !strings.Contains(err.Error(), "check events in project core") {
+		t.Errorf("task() = %v, want error about check events", err)
+	}
+	// The check of pods is not affected by the failure to load events, and
+	// the check of deployment configs is not applicable.
+	select {
+	case result := <-results:
+		if len(result.Projects) != 1 || len(result.Projects[0].Results) != 1 || result.Projects[0].Results[0].CheckID != "pods-waiting" {
+			t.Errorf("result = %#v, want only pods-waiting", result)
+		}
+	default:
+		t.Errorf("got no result, want pods-waiting")
+	}
+
+	// Nothing was collected in a missing project, no check is applicable.
+	task = CheckProjectTask(checks, newCheckEnv(dir, "missing-project"), results)
+	if err := task(); err != nil {
+		t.Errorf("task() = %v, want nil", err)
+	}
+	select {
+	case result := <-results:
+		t.Errorf("got result %#v, want none", result)
+	default:
+	}
+}
+
+func TestCheckProjectTaskErrors(t *testing.T) {
+	failing := func(id string) Check {
+		return check{id: id, run: func(env CheckEnv) (CheckResult, error) {
+			return CheckResult{}, errors.New(id + " failed")
+		}}
+	}
+	passing := check{id: "c", run: func(env CheckEnv) (CheckResult, error) {
+		return CheckResult{Ok: true}, nil
+	}}
+	results := make(chan AnalysisResult, 1)
+	task := CheckProjectTask([]Check{failing("a"), passing, failing("b")}, CheckEnv{Project: "core"}, results)
+
+	// Every failing check is attributed, not only the first.
+	tasks := make(chan Task, 1)
+	tasks <- task
+	close(tasks)
+	errs := runTasks(tasks, 1, nopProgress{})
+	var got []string
+	for _, g := range GroupErrors(errs) {
+		got = append(got, g.Source()+": "+g.Errors[0].Error)
+	}
+	want := []string{"check a, project core: a failed", "check b, project core: b failed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+	if result := <-results; len(result.Projects[0].Results) != 1 {
+		t.Errorf("result = %#v, want result of check c", result)
+	}
+}
+
+func TestFilterBySeverity(t *testing.T) {
+	analysisResult := AnalysisResult{
+		Projects: []ProjectResult{
+			{
+				Project: "core",
+				Results: []CheckResult{
+					{CheckID: "a", Severity: SeverityInfo},
+					{CheckID: "b", Severity: SeverityCritical},
+				},
+			},
+			{
+				Project: "mbaas",
+				Results: []CheckResult{
+					{CheckID: "a", Severity: SeverityInfo},
+				},
+			},
+		},
+	}
+	want := AnalysisResult{
+		Projects: []ProjectResult{
+			{
+				Project: "core",
+				Results: []CheckResult{
+					{CheckID: "b", Severity: SeverityCritical},
+				},
+			},
+		},
+	}
+	if got := FilterBySeverity(analysisResult, SeverityWarning); !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterBySeverity() = \n%#v, want \n%#v", got, want)
+	}
+}
+
 func TestPrintAnalysisReport(t *testing.T) {
 	tests := []struct {
 		description    string
@@ -361,17 +603,14 @@ func TestPrintAnalysisReport(t *testing.T) {
 								CheckName: "check event log for errors",
 								Ok:        false,
 								Message:   "errors detected in event log",
-								Events: []types.Event{
+								Events: []CheckEvent{
 									{
-										TypeMeta: types.TypeMeta{Kind: "Event"},
-										InvolvedObject: types.ObjectReference{
-											Namespace: "rhmap-core",
-											Name:      "fh-ngui",
-										},
-										Reason:  "FailedUpdate",
-										Message: "Cannot update deployment rhmap-core/fh-ngui-3 status to Pending: replicationcontrollers \"fh-ngui-3\" cannot be updated: the object has been modified; please apply your changes to the latest version and try again",
-										Count:   1,
-										Type:    "Warning",
+										Namespace: "rhmap-core",
+										Name:      "fh-ngui",
+										Reason:    "FailedUpdate",
+										Message:   "Cannot update deployment rhmap-core/fh-ngui-3 status to Pending: replicationcontrollers \"fh-ngui-3\" cannot be updated: the object has been modified; please apply your changes to the latest version and try again",
+										Count:     1,
+										Type:      "Warning",
 									},
 								},
 							},
@@ -382,6 +621,22 @@ func TestPrintAnalysisReport(t *testing.T) {
 			contains:    []string{"rhmap-core", "fh-ngui", "Cannot update deployment"},
 			notContains: []string{"No issues found"},
 		},
+		{
+			description: "most severe issues first",
+			analysisResult: AnalysisResult{
+				Projects: []ProjectResult{
+					{
+						Project: "core",
+						Results: []CheckResult{
+							{CheckName: "minor", Severity: SeverityInfo},
+							{CheckName: "major", Severity: SeverityCritical, DocURL: "https://example.com/major"},
+						},
+					},
+				},
+			},
+			want: "[critical] Potential issue in project core: major\n  Details:\n  See: https://example.com/major\n" +
+				"[info] Potential issue in project core: minor\n  Details:\n",
+		},
 	}
 	for _, tt := range tests {
 		var out bytes.Buffer
@@ -405,3 +660,19 @@ func TestPrintAnalysisReport(t *testing.T) {
 		}
 	}
 }
+
+func TestAnalysisResultMerge(t *testing.T) {
+	var r AnalysisResult
+	r.Merge(AnalysisResult{Projects: []ProjectResult{{Project: "a", Results: []CheckResult{{CheckName: "1"}}}}})
+	r.Merge(AnalysisResult{Projects: []ProjectResult{{Project: "b", Results: []CheckResult{{CheckName: "2"}}}}})
+	r.Merge(AnalysisResult{Projects: []ProjectResult{{Project: "a", Results: []CheckResult{{CheckName: "3"}}}}})
+	want := AnalysisResult{
+		Projects: []ProjectResult{
+			{Project: "a", Results: []CheckResult{{CheckName: "1"}, {CheckName: "3"}}},
+			{Project: "b", Results: []CheckResult{{CheckName: "2"}}},
+		},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("r = \n%#v, want \n%#v", r, want)
+	}
+}
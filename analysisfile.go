@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/feedhenry/fh-system-dump-tool/openshift/api/types"
+)
+
+// AnalysisSchemaVersion is the version of the format of analysis.json. Within
+// a version, fields are only ever added. Removing, renaming or changing the
+// meaning of a field requires a new version, and ReadAnalysis keeps reading
+// the previous ones.
+//
+// Version 1 had no schemaVersion field and held the check results only, with
+// raw OpenShift events.
+const AnalysisSchemaVersion = 2
+
+// An AnalysisReport is the content of analysis.json: the results of the
+// analysis of a dump, with information about the dump and the cluster.
+type AnalysisReport struct {
+	SchemaVersion     int         `json:"schemaVersion" description:"Version of the format of this file."`
+	ToolVersion       string      `json:"toolVersion" description:"Version of fh-system-dump-tool that produced the dump."`
+	GeneratedAt       time.Time   `json:"generatedAt" description:"Time the file was written."`
+	DumpStartedAt     time.Time   `json:"dumpStartedAt" description:"Time the dump started."`
+	AnalysisStartedAt time.Time   `json:"analysisStartedAt" description:"Time the analysis started, after data was collected."`
+	Cluster           ClusterInfo `json:"cluster" description:"The cluster the dump was taken from."`
+	AnalysisResult
+}
+
+// ClusterInfo identifies the cluster a dump was taken from. Fields are empty
+// if they could not be determined.
+type ClusterInfo struct {
+	Server  string `json:"server,omitempty" description:"URL of the API server."`
+	Version string `json:"version,omitempty" description:"Version of OpenShift running on the API server."`
+}
+
+// readClusterInfo returns the cluster information found in the dump in dir.
+func readClusterInfo(dir string) ClusterInfo {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "meta", "oc_version"))
+	if err != nil {
+		return ClusterInfo{}
+	}
+	return parseClusterInfo(b)
+}
+
+// parseClusterInfo returns the server URL and OpenShift version in the output
+// of oc version. The client version comes first, and is ignored.
+func parseClusterInfo(ocVersion []byte) ClusterInfo {
+	var info ClusterInfo
+	server := false
+	for _, line := range strings.Split(string(ocVersion), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch {
+		case fields[0] == "Server":
+			server = true
+			info.Server = fields[1]
+		case server && fields[0] == "openshift" && info.Version == "":
+			info.Version = fields[1]
+		}
+	}
+	return info
+}
+
+// ReadAnalysis reads the analysis.json file at path, written by this or an
+// earlier version of the tool. Older schema versions are converted to the
+// current one; the SchemaVersion of the result tells the version read.
+func ReadAnalysis(path string) (AnalysisReport, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return AnalysisReport{}, err
+	}
+	var header struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return AnalysisReport{}, fmt.Errorf("%s: %v", path, err)
+	}
+	var report AnalysisReport
+	switch {
+	case header.SchemaVersion == 0:
+		report.AnalysisResult, err = readAnalysisV1(b)
+		report.SchemaVersion = 1
+	case header.SchemaVersion > AnalysisSchemaVersion:
+		return AnalysisReport{}, fmt.Errorf("%s: schema version %d is not supported, the latest known is %d: use a newer version of fh-system-dump-tool", path, header.SchemaVersion, AnalysisSchemaVersion)
+	default:
+		err = json.Unmarshal(b, &report)
+	}
+	if err != nil {
+		return AnalysisReport{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return report, nil
+}
+
+// checkResultV1 is a check result of schema version 1, with raw OpenShift
+// events.
+type checkResultV1 struct {
+	CheckResult
+	Events []types.Event `json:"events,omitempty"`
+}
+
+func (r checkResultV1) convert() CheckResult {
+	result := r.CheckResult
+	result.Events = nil
+	for _, event := range r.Events {
+		result.Events = append(result.Events, newCheckEvent(event))
+	}
+	return result
+}
+
+// readAnalysisV1 decodes analysis results of schema version 1.
+func readAnalysisV1(b []byte) (AnalysisResult, error) {
+	var v1 struct {
+		Platform []checkResultV1 `json:"platform"`
+		Projects []struct {
+			Project string          `json:"project"`
+			Results []checkResultV1 `json:"checks"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal(b, &v1); err != nil {
+		return AnalysisResult{}, err
+	}
+	var result AnalysisResult
+	for _, r := range v1.Platform {
+		result.Platform = append(result.Platform, r.convert())
+	}
+	for _, p := range v1.Projects {
+		projectResult := ProjectResult{Project: p.Project}
+		for _, r := range p.Results {
+			projectResult.Results = append(projectResult.Results, r.convert())
+		}
+		result.Projects = append(result.Projects, projectResult)
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadAnalysis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-analysis-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lastSeen := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	event := CheckEvent{Kind: "Pod", Namespace: "core", Name: "fh-ngui", Type: "Warning", Reason: "FailedSync", Message: "Error syncing pod", Count: 3, LastTimestamp: &lastSeen}
+	result := AnalysisResult{Projects: []ProjectResult{{Project: "core", Results: []CheckResult{
+		{CheckID: "events", CheckName: "check event log for errors", Message: "errors detected in event log", Events: []CheckEvent{event}},
+	}}}}
+
+	tests := []struct {
+		description string
+		content     string
+		want        AnalysisReport
+		wantErr     string
+	}{
+		{
+			description: "schema version 1, with raw events",
+			content: `{"projects": [{"project": "core", "checks": [{"id": "events", "name": "check event log for errors", "ok": false, "message": "errors detected in event log",
+				"events": [{"kind": "Event", "metadata": {"name": "fh-ngui.14a", "namespace": "core"}, "involvedObject": {"kind": "Pod", "namespace": "core", "name": "fh-ngui"},
+				"reason": "FailedSync", "message": "Error syncing pod", "firstTimestamp": null, "lastTimestamp": "2017-03-01T10:00:00Z", "count": 3, "type": "Warning"}]}]}]}`,
+			want: AnalysisReport{SchemaVersion: 1, AnalysisResult: result},
+		},
+		{
+			description: "current schema version",
+			content: `{"schemaVersion": 2, "toolVersion": "1.2.3", "generatedAt": "2017-03-01T10:05:00Z", "dumpStartedAt": "2017-03-01T10:00:00Z", "analysisStartedAt": "2017-03-01T10:04:00Z",
+				"cluster": {"server": "https://master.example.com:8443", "version": "v3.3.1.17"},
+				"projects": [{"project": "core", "checks": [{"id": "events", "name": "check event log for errors", "ok": false, "message": "errors detected in event log",
+				"events": [{"kind": "Pod", "namespace": "core", "name": "fh-ngui", "type": "Warning", "reason": "FailedSync", "message": "Error syncing pod", "count": 3, "lastTimestamp": "2017-03-01T10:00:00Z"}]}]}]}`,
+			want: AnalysisReport{
+				SchemaVersion:     2,
+				ToolVersion:       "1.2.3",
+				GeneratedAt:       time.Date(2017, 3, 1, 10, 5, 0, 0, time.UTC),
+				DumpStartedAt:     time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC),
+				AnalysisStartedAt: time.Date(2017, 3, 1, 10, 4, 0, 0, time.UTC),
+				Cluster:           ClusterInfo{Server: "https://master.example.com:8443", Version: "v3.3.1.17"},
+				AnalysisResult:    result,
+			},
+		},
+		{
+			description: "newer schema version",
+			content:     `{"schemaVersion": 99}`,
+			wantErr:     "schema version 99 is not supported",
+		},
+		{
+			description: "invalid JSON",
+			content:     `{"schemaVersion": `,
+			wantErr:     "analysis.json: unexpected end of JSON input",
+		},
+	}
+	path := filepath.Join(dir, "analysis.json")
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(path, []byte(tt.content), 0660); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadAnalysis(path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: ReadAnalysis() error = %v, want %q", tt.description, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ReadAnalysis() error = %v", tt.description, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ReadAnalysis() = \n%#v, want \n%#v", tt.description, got, tt.want)
+		}
+	}
+
+	if _, err := ReadAnalysis(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("ReadAnalysis(missing file) error = %v, want not exist", err)
+	}
+}
+
+func TestParseClusterInfo(t *testing.T) {
+	tests := []struct {
+		output string
+		want   ClusterInfo
+	}{
+		{ocVersionOutput, ClusterInfo{Server: "https://master.example.com:8443", Version: "v3.3.1.17"}},
+		// Without access to the server, only the client version is
+		// known.
+		{"oc v3.3.1.7\nkubernetes v1.3.0+52492b4\nopenshift v3.3.1.7\n", ClusterInfo{}},
+		{"", ClusterInfo{}},
+	}
+	for _, tt := range tests {
+		if got := parseClusterInfo([]byte(tt.output)); got != tt.want {
+			t.Errorf("parseClusterInfo(%q) = %+v, want %+v", tt.output, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/rsa"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteArchive writes the directory at path to w as a gzip-compressed tar
+// stream. Paths in the archive start with the name of the directory. Only
+// directories and regular files are archived.
+func WriteArchive(w io.Writer, path string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	parent := filepath.Dir(path)
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(parent, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.CopyN(tw, f, hdr.Size)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeArchive writes the directory at path to w as a tar.gz archive,
+// encrypted to key if not nil.
+func writeArchive(w io.Writer, path string, key *rsa.PublicKey) error {
+	if key == nil {
+		return WriteArchive(w, path)
+	}
+	ew, err := NewEncryptWriter(w, key)
+	if err != nil {
+		return err
+	}
+	if err := WriteArchive(ew, path); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// archive archives the directory at path to a tar.gz file at archivePath,
+// encrypted to key if not nil, and returns the SHA-256 checksum of the file.
+// The file is removed if archiving fails.
+func archive(path, archivePath string, key *rsa.PublicKey) (string, error) {
+	f, err := os.OpenFile(archivePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0660)
+	if err != nil {
+		return "", err
+	}
+	w := newHashWriter(f)
+	err = writeArchive(w, path, key)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return "", err
+	}
+	return w.Sum(), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-writearchive-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := filepath.Join(dir, "2017-03-01T10-00-00Z")
+	names := []string{filepath.Join("empty", "file"), filepath.Join("projects", "core", "definitions", "pods.json"), "version"}
+	contents := []string{"", `{"items": []}`, "v1\n"}
+	for i, name := range names {
+		path := filepath.Join(dump, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents[i]), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := WriteArchive(&b, dump); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paths in the archive start with the name of the dump directory.
+	extracted := filepath.Join(dir, "extracted")
+	gz, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := extractTar(gz, extracted); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, name := range names {
+		want = append(want, filepath.Join("2017-03-01T10-00-00Z", name))
+	}
+	if err := dirHasExactFiles(extracted, want, contents); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-archive-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := filepath.Join(dir, "dump")
+	if err := os.Mkdir(dump, 0770); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dump, "version"), []byte("v1\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := dump + ".tar.gz"
+	if _, err := archive(dump, archivePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	opened, cleanup, err := OpenDump(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if err := dirHasExactFiles(opened, []string{"version"}, []string{"v1\n"}); err != nil {
+		t.Error(err)
+	}
+
+	// Existing files are not overwritten.
+	if _, err := archive(dump, archivePath, nil); err == nil {
+		t.Errorf("archive() to existing file = nil, want error")
+	}
+	if _, err := os.Stat(archivePath); err != nil {
+		t.Errorf("existing archive removed: %v", err)
+	}
+}
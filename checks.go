@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/feedhenry/fh-system-dump-tool/openshift/api/types"
+)
+
+// A Severity tells how important an issue detected by a check is.
+type Severity string
+
+// Valid severities, in increasing order of importance.
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Rank returns a number that orders severities by importance. Unknown
+// severities rank lowest.
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	}
+	return 0
+}
+
+// ParseSeverity converts s into a Severity. It is an error if s is not one of
+// the valid severities.
+func ParseSeverity(s string) (Severity, error) {
+	severity := Severity(s)
+	if severity.Rank() == 0 {
+		return "", fmt.Errorf("invalid severity %q, must be one of: %s, %s, %s", s, SeverityInfo, SeverityWarning, SeverityCritical)
+	}
+	return severity, nil
+}
+
+// CheckEnv gives checks access to the data dumped from a project.
+type CheckEnv struct {
+	Project string
+	// Basepath is the root directory of the dump.
+	Basepath string
+	// Definition loads resource definitions of the project.
+	Definition DefinitionLoader
+	// NewDefinition, if set, returns a new loader of the resource
+	// definitions of the project. CheckProjectTask gives each check its
+	// own loader, so that a definition failing to load only affects the
+	// checks that need it.
+	NewDefinition func() DefinitionLoader
+	// Collected, if set, reports whether a kind of resources or data was
+	// collected in the project. Checks requiring data that was not
+	// collected are not applicable.
+	Collected func(kind string) bool
+}
+
+// errNotApplicable is returned by checks when the data they verify is not
+// present in a project, e.g. the project has no MongoDB pods. Such checks
+// produce no result.
+var errNotApplicable = errors.New("check not applicable")
+
+// A Check verifies some aspect of the system conditions.
+type Check interface {
+	// ID uniquely identifies the check. It is used to enable or disable
+	// checks from the command line.
+	ID() string
+	// Title is a short human-readable summary of what is verified.
+	Title() string
+	Description() string
+	// Severity tells how important the issues detected by the check are.
+	Severity() Severity
+	// Requires lists the kinds of resources or collected data the check
+	// needs.
+	Requires() []string
+	// DocURL points to the documentation of the check.
+	DocURL() string
+	// Run runs the check against the data in env.
+	Run(env CheckEnv) (CheckResult, error)
+}
+
+// check is a Check implemented by a function.
+type check struct {
+	id          string
+	title       string
+	description string
+	severity    Severity
+	requires    []string
+	docURL      string
+	run         func(env CheckEnv) (CheckResult, error)
+}
+
+var _ Check = check{}
+
+func (c check) ID() string                            { return c.id }
+func (c check) Title() string                         { return c.title }
+func (c check) Description() string                   { return c.description }
+func (c check) Severity() Severity                    { return c.severity }
+func (c check) Requires() []string                    { return c.requires }
+func (c check) DocURL() string                        { return c.docURL }
+func (c check) Run(env CheckEnv) (CheckResult, error) { return c.run(env) }
+
+// A CheckRegistry holds a list of checks with unique IDs, in the order they
+// were registered.
+type CheckRegistry struct {
+	checks []Check
+}
+
+// Register adds c to the registry. It panics if a check with the same ID is
+// already registered.
+func (r *CheckRegistry) Register(c Check) {
+	if r.Get(c.ID()) != nil {
+		panic(fmt.Sprintf("check %q registered twice", c.ID()))
+	}
+	r.checks = append(r.checks, c)
+}
+
+// Get returns the check with the given ID, or nil if there is no such check.
+func (r *CheckRegistry) Get(id string) Check {
+	for _, c := range r.checks {
+		if c.ID() == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// All returns all registered checks.
+func (r *CheckRegistry) All() []Check {
+	return append([]Check(nil), r.checks...)
+}
+
+// Select returns the registered checks with IDs in enable, or all checks if
+// enable is empty, minus the ones with IDs in skip. It is an error to name an
+// unknown check.
+func (r *CheckRegistry) Select(enable, skip []string) ([]Check, error) {
+	for _, id := range append(append([]string(nil), enable...), skip...) {
+		if r.Get(id) == nil {
+			return nil, fmt.Errorf("unknown check %q, use -list-checks to see the available checks", id)
+		}
+	}
+	var selected []Check
+	for _, c := range r.checks {
+		if len(enable) > 0 && !contains(enable, c.ID()) {
+			continue
+		}
+		if contains(skip, c.ID()) {
+			continue
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+// PrintChecks writes a table describing the given checks to out.
+func PrintChecks(checks []Check, out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSEVERITY\tTITLE")
+	for _, c := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.ID(), c.Severity(), c.Title())
+	}
+	w.Flush()
+}
+
+// docURL returns the URL to the documentation of a check, given the anchor of
+// its section in the README.
+func docURL(anchor string) string {
+	return "https://github.com/feedhenry/fh-system-dump-tool#" + anchor
+}
+
+// DefaultChecks is the registry of all checks known to the dump tool.
+var DefaultChecks = &CheckRegistry{}
+
+func init() {
+	for _, c := range []Check{
+		check{
+			id:          "events",
+			title:       "check event log for errors",
+			description: "Looks for events which type is not Normal, i.e. warnings and errors.",
+			severity:    SeverityInfo,
+			requires:    []string{"events"},
+			docURL:      docURL("check-event-log-for-errors"),
+			run: func(env CheckEnv) (CheckResult, error) {
+				var events types.EventList
+				env.Definition.Load("events", &events)
+				return CheckEvents(events), env.Definition.Err()
+			},
+		},
+		check{
+			id:          "deploymentconfig-replicas",
+			title:       "check number of replicas in deployment configs",
+			description: "Looks for deployment configs with the number of replicas set to 0.",
+			severity:    SeverityWarning,
+			requires:    []string{"deploymentconfigs"},
+			docURL:      docURL("check-number-of-replicas-in-deployment-configs"),
+			run: func(env CheckEnv) (CheckResult, error) {
+				var deploymentConfigs types.DeploymentConfigList
+				env.Definition.Load("deploymentconfigs", &deploymentConfigs)
+				return CheckDeploymentConfigs(deploymentConfigs), env.Definition.Err()
+			},
+		},
+		check{
+			id:          "pods-waiting",
+			title:       "check pods for containers in waiting state",
+			description: "Looks for containers that have not started yet.",
+			severity:    SeverityWarning,
+			requires:    []string{"pods"},
+			docURL:      docURL("check-pods-for-containers-in-waiting-state"),
+			run: func(env CheckEnv) (CheckResult, error) {
+				var pods types.PodList
+				env.Definition.Load("pods", &pods)
+				return CheckPods(pods), env.Definition.Err()
+			},
+		},
+		check{
+			id:          "pods-init",
+			title:       "check pods stuck in init with failing init containers",
+			description: "Looks for pending pods with init containers that exited with a failure.",
+			severity:    SeverityCritical,
+			requires:    []string{"pods"},
+			docURL:      docURL("check-pods-stuck-in-init-with-failing-init-containers"),
+			run: func(env CheckEnv) (CheckResult, error) {
+				var pods types.PodList
+				env.Definition.Load("pods", &pods)
+				return CheckInitContainers(pods), env.Definition.Err()
+			},
+		},
+		check{
+			id:          "mongodb-replica-set",
+			title:       "check MongoDB replica set health",
+			description: "Looks for replica sets without a primary, unhealthy or lagging members and members not matching the configuration.",
+			severity:    SeverityCritical,
+			requires:    []string{"mongodb"},
+			docURL:      docURL("check-mongodb-replica-set-health"),
+			run: func(env CheckEnv) (CheckResult, error) {
+				instances, err := loadMongoDBInstances(env.Basepath, env.Project)
+				if err != nil {
+					return CheckResult{}, err
+				}
+				if len(instances) == 0 {
+					return CheckResult{}, errNotApplicable
+				}
+				return CheckMongoDBReplicaSets(instances), nil
+			},
+		},
+		check{
+			id:          "redis",
+			title:       "check Redis status",
+			description: "Looks for evicted keys, rejected connections, maxmemory reached and persistence failures.",
+			severity:    SeverityWarning,
+			requires:    []string{"redis"},
+			docURL:      docURL("check-redis-status"),
+			run: func(env CheckEnv) (CheckResult, error) {
+				stats, err := loadCacheStats(env.Basepath, env.Project, "redis", "_info", parseRedisInfo)
+				if err != nil {
+					return CheckResult{}, err
+				}
+				if len(stats) == 0 {
+					return CheckResult{}, errNotApplicable
+				}
+				return CheckRedis(stats), nil
+			},
+		},
+		check{
+			id:          "memcached",
+			title:       "check memcached status",
+			description: "Looks for evicted items, rejected connections and the memory limit being reached.",
+			severity:    SeverityWarning,
+			requires:    []string{"memcached"},
+			docURL:      docURL("check-memcached-status"),
+			run: func(env CheckEnv) (CheckResult, error) {
+				stats, err := loadCacheStats(env.Basepath, env.Project, "memcached", "_stats", parseMemcachedStats)
+				if err != nil {
+					return CheckResult{}, err
+				}
+				if len(stats) == 0 {
+					return CheckResult{}, errNotApplicable
+				}
+				return CheckMemcached(stats), nil
+			},
+		},
+		check{
+			id:          "mysql",
+			title:       "check MySQL status",
+			description: "Looks for too many connections, long-running queries and deadlocks.",
+			severity:    SeverityWarning,
+			requires:    []string{"mysql"},
+			docURL:      docURL("check-mysql-status"),
+			run: func(env CheckEnv) (CheckResult, error) {
+				instances, err := loadMySQLInstances(env.Basepath, env.Project)
+				if err != nil {
+					return CheckResult{}, err
+				}
+				if len(instances) == 0 {
+					return CheckResult{}, errNotApplicable
+				}
+				return CheckMySQL(instances), nil
+			},
+		},
+	} {
+		DefaultChecks.Register(c)
+	}
+}
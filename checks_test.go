@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckRegistrySelect(t *testing.T) {
+	r := &CheckRegistry{}
+	for _, id := range []string{"a", "b", "c"} {
+		r.Register(check{id: id})
+	}
+	tests := []struct {
+		enable, skip []string
+		want         []string
+		wantErr      string
+	}{
+		{want: []string{"a", "b", "c"}},
+		{enable: []string{"b"}, want: []string{"b"}},
+		{skip: []string{"a", "c"}, want: []string{"b"}},
+		{enable: []string{"x"}, wantErr: `unknown check "x"`},
+	}
+	for i, tt := range tests {
+		got, err := r.Select(tt.enable, tt.skip)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%d: Select() error = %v, want %q", i, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: Select() error = %v", i, err)
+			continue
+		}
+		var ids []string
+		for _, c := range got {
+			ids = append(ids, c.ID())
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%d: Select() = %v, want %v", i, ids, tt.want)
+		}
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []string{"info", "warning", "critical"} {
+		if got, err := ParseSeverity(s); err != nil || string(got) != s {
+			t.Errorf("ParseSeverity(%q) = %q, %v, want %q, nil", s, got, err, s)
+		}
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Errorf("ParseSeverity(%q) error = nil, want error", "fatal")
+	}
+	if !(SeverityInfo.Rank() < SeverityWarning.Rank() && SeverityWarning.Rank() < SeverityCritical.Rank()) {
+		t.Error("severities are not ranked in increasing order of importance")
+	}
+}
+
+func TestDefaultChecks(t *testing.T) {
+	for _, c := range DefaultChecks.All() {
+		if c.Title() == "" || c.Description() == "" || c.DocURL() == "" || len(c.Requires()) == 0 {
+			t.Errorf("check %q is missing metadata", c.ID())
+		}
+		if c.Severity().Rank() == 0 {
+			t.Errorf("check %q has invalid severity %q", c.ID(), c.Severity())
+		}
+	}
+}
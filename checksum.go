@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// checksumsFile is the name of the file listing the SHA-256 checksums of all
+// files of a dump, in the format of sha256sum.
+const checksumsFile = "SHA256SUMS"
+
+// digestExt is appended to the path of an archive to get the path of the file
+// with its SHA-256 checksum.
+const digestExt = ".sha256"
+
+// Checksums records the SHA-256 checksums of files as they are written. It is
+// safe for concurrent use.
+type Checksums struct {
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+// NewChecksums creates an empty Checksums.
+func NewChecksums() *Checksums {
+	return &Checksums{sums: make(map[string]string)}
+}
+
+// Set records the hex-encoded checksum of the file at path, replacing any
+// previous one.
+func (c *Checksums) Set(path, sum string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sums[filepath.Clean(path)] = sum
+}
+
+// Delete forgets the checksum of the file at path.
+func (c *Checksums) Delete(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sums, filepath.Clean(path))
+}
+
+// Get returns the checksum recorded for the file at path.
+func (c *Checksums) Get(path string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sum, ok := c.sums[filepath.Clean(path)]
+	return sum, ok
+}
+
+// WriteChecksums writes the checksums of all files under dir, except itself,
+// to the checksumsFile in dir. The checksums recorded in sums while files
+// were written are used when available, so that files modified afterwards
+// fail verification; other files are read. Sums may be nil.
+func WriteChecksums(dir string, sums *Checksums) error {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == checksumsFile {
+			return nil
+		}
+		sum, ok := "", false
+		if sums != nil {
+			sum, ok = sums.Get(path)
+		}
+		if !ok {
+			if sum, err = fileSHA256(path); err != nil {
+				return err
+			}
+		}
+		files[rel] = sum
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	f, err := os.Create(filepath.Join(dir, checksumsFile))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s  %s\n", files[name], name)
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadChecksums parses checksums in the format of sha256sum, returning them
+// by file name.
+func ReadChecksums(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		// The separator is two spaces, or a space and an asterisk for
+		// files read in binary mode.
+		if len(line) < sha256.Size*2+3 || line[sha256.Size*2] != ' ' || (line[sha256.Size*2+1] != ' ' && line[sha256.Size*2+1] != '*') {
+			return nil, fmt.Errorf("line %d: invalid checksum line", n)
+		}
+		sum := strings.ToLower(line[:sha256.Size*2])
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, fmt.Errorf("line %d: invalid checksum: %v", n, err)
+		}
+		sums[line[sha256.Size*2+2:]] = sum
+	}
+	return sums, scanner.Err()
+}
+
+// VerifyResult is the outcome of verifying a dump against its checksums.
+type VerifyResult struct {
+	// Verified is the number of files whose checksums match.
+	Verified int
+	// Failed lists files that differ from their checksums.
+	Failed []string
+	// Missing lists files with a checksum that do not exist.
+	Missing []string
+	// Unlisted lists files without a checksum.
+	Unlisted []string
+}
+
+// OK reports whether all files of the dump match their checksums.
+func (r VerifyResult) OK() bool {
+	return len(r.Failed) == 0 && len(r.Missing) == 0 && len(r.Unlisted) == 0
+}
+
+// VerifyDump checks the files of the dump in dir against its checksumsFile.
+func VerifyDump(dir string) (VerifyResult, error) {
+	var result VerifyResult
+	f, err := os.Open(filepath.Join(dir, checksumsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, fmt.Errorf("%s has no %s file, it was created by an older version of the tool", dir, checksumsFile)
+		}
+		return result, err
+	}
+	sums, err := ReadChecksums(f)
+	f.Close()
+	if err != nil {
+		return result, fmt.Errorf("%s: %v", checksumsFile, err)
+	}
+
+	seen := make(map[string]bool)
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == checksumsFile {
+			return nil
+		}
+		want, ok := sums[rel]
+		if !ok {
+			result.Unlisted = append(result.Unlisted, rel)
+			return nil
+		}
+		seen[rel] = true
+		got, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			result.Failed = append(result.Failed, rel)
+			return nil
+		}
+		result.Verified++
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	for name := range sums {
+		if !seen[name] {
+			result.Missing = append(result.Missing, name)
+		}
+	}
+	sort.Strings(result.Missing)
+	return result, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeDigest writes the checksum of the archive at archivePath next to it, in
+// the format of sha256sum.
+func writeDigest(archivePath, sum string) error {
+	return writeNewFile(archivePath+digestExt, []byte(sum+"  "+filepath.Base(archivePath)+"\n"))
+}
+
+// verifyArchiveDigest checks the archive at path against the checksum written
+// next to it, if any. It reports whether there was a checksum to check.
+func verifyArchiveDigest(path string) (bool, error) {
+	f, err := os.Open(path + digestExt)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	sums, err := ReadChecksums(f)
+	f.Close()
+	if err != nil {
+		return true, fmt.Errorf("%s: %v", path+digestExt, err)
+	}
+	want, ok := sums[filepath.Base(path)]
+	if !ok {
+		return true, fmt.Errorf("%s has no checksum for %s", path+digestExt, filepath.Base(path))
+	}
+	got, err := fileSHA256(path)
+	if err != nil {
+		return true, err
+	}
+	if got != want {
+		return true, fmt.Errorf("%s: checksum mismatch: got %s, want %s", path, got, want)
+	}
+	return true, nil
+}
+
+// hashWriter is an io.Writer that hashes what is written to it before passing
+// it to w.
+type hashWriter struct {
+	w    io.Writer
+	hash hash.Hash
+}
+
+func newHashWriter(w io.Writer) *hashWriter {
+	return &hashWriter{w: w, hash: sha256.New()}
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.hash.Write(p[:n])
+	return n, err
+}
+
+// Sum returns the hex-encoded checksum of what was written.
+func (w *hashWriter) Sum() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
+
+// verifyCommand implements the verify subcommand, that checks a dump against
+// its checksums.
+func verifyCommand(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fh-system-dump-tool verify <dump>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Checks that a dump directory, archive or split archive was not truncated or altered.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("verify requires a dump")
+	}
+	path := fs.Arg(0)
+	if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+		if _, split := splitManifestPath(path); !split {
+			checked, err := verifyArchiveDigest(path)
+			if err != nil {
+				return err
+			}
+			if checked {
+				fmt.Printf("OK: %s matches %s\n", path, path+digestExt)
+			}
+		}
+	}
+	dir, cleanup, err := OpenDump(path)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	result, err := VerifyDump(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range result.Failed {
+		fmt.Printf("FAILED: %s\n", name)
+	}
+	for _, name := range result.Missing {
+		fmt.Printf("MISSING: %s\n", name)
+	}
+	for _, name := range result.Unlisted {
+		fmt.Printf("UNLISTED: %s\n", name)
+	}
+	if !result.OK() {
+		return fmt.Errorf("%d files failed verification, %d verified", len(result.Failed)+len(result.Missing)+len(result.Unlisted), result.Verified)
+	}
+	fmt.Printf("OK: %d files verified\n", result.Verified)
+	return nil
+}
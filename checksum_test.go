@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestDump writes a dump with a few files to dir.
+func writeTestDump(t *testing.T, dir string) {
+	files := map[string]string{
+		"version":                      "v1\n",
+		"dump.log":                     "log\n",
+		"projects/core/logs/pod.logs":  "line\n",
+		"projects/core/definitions/dc": "{}",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-checksums-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestDump(t, dir)
+
+	// Recorded checksums take precedence over the contents of files.
+	sums := NewChecksums()
+	sums.Set(filepath.Join(dir, "version"), strings.Repeat("0", 64))
+	if err := WriteChecksums(dir, sums); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, checksumsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadChecksums(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		names = append(names, line[66:])
+	}
+	if wantNames := []string{"dump.log", "projects/core/definitions/dc", "projects/core/logs/pod.logs", "version"}; !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("files = %q, want %q", names, wantNames)
+	}
+	if got["version"] != strings.Repeat("0", 64) {
+		t.Errorf("checksum of version = %q, want recorded checksum", got["version"])
+	}
+	if sum, _ := fileSHA256(filepath.Join(dir, "dump.log")); got["dump.log"] != sum {
+		t.Errorf("checksum of dump.log = %q, want %q", got["dump.log"], sum)
+	}
+}
+
+func TestVerifyDump(t *testing.T) {
+	tests := []struct {
+		modify func(dir string) error
+		want   VerifyResult
+	}{
+		{func(dir string) error { return nil }, VerifyResult{Verified: 4}},
+		{func(dir string) error {
+			return ioutil.WriteFile(filepath.Join(dir, "version"), []byte("v2\n"), 0660)
+		}, VerifyResult{Verified: 3, Failed: []string{"version"}}},
+		{func(dir string) error {
+			return os.Remove(filepath.Join(dir, "projects", "core", "logs", "pod.logs"))
+		}, VerifyResult{Verified: 3, Missing: []string{"projects/core/logs/pod.logs"}}},
+		{func(dir string) error {
+			return ioutil.WriteFile(filepath.Join(dir, "extra"), nil, 0660)
+		}, VerifyResult{Verified: 4, Unlisted: []string{"extra"}}},
+	}
+	for i, tt := range tests {
+		dir, err := ioutil.TempDir("", "test-verify-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestDump(t, dir)
+		if err := WriteChecksums(dir, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.modify(dir); err != nil {
+			t.Fatal(err)
+		}
+		got, err := VerifyDump(dir)
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Errorf("#%d: VerifyDump() error = %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: VerifyDump() = %+v, want %+v", i, got, tt.want)
+		}
+		if got.OK() != (i == 0) {
+			t.Errorf("#%d: OK() = %v, want %v", i, got.OK(), i == 0)
+		}
+	}
+}
+
+func TestReadChecksums(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	got, err := ReadChecksums(strings.NewReader(sum + "  a file\n\n" + strings.ToUpper(sum) + " *b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a file": sum, "b": sum}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadChecksums() = %v, want %v", got, want)
+	}
+	for _, s := range []string{sum + " a", sum[:62] + "  a", "zz" + sum[2:] + "  a", sum + "  "} {
+		if _, err := ReadChecksums(strings.NewReader(s)); err == nil {
+			t.Errorf("ReadChecksums(%q) error = nil, want error", s)
+		}
+	}
+}
+
+func TestVerifyArchiveDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-digest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dump := filepath.Join(dir, "dump")
+	writeTestDump(t, dump)
+
+	archivePath := dump + ".tar.gz"
+	sum, err := archive(dump, archivePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked, err := verifyArchiveDigest(archivePath); checked || err != nil {
+		t.Errorf("verifyArchiveDigest() without digest = %v, %v, want false, nil", checked, err)
+	}
+	if err := writeDigest(archivePath, sum); err != nil {
+		t.Fatal(err)
+	}
+	if checked, err := verifyArchiveDigest(archivePath); !checked || err != nil {
+		t.Errorf("verifyArchiveDigest() = %v, %v, want true, nil", checked, err)
+	}
+	f, err := os.OpenFile(archivePath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("x"))
+	f.Close()
+	if _, err := verifyArchiveDigest(archivePath); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("verifyArchiveDigest(modified archive) error = %v, want checksum mismatch", err)
+	}
+}
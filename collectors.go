@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// A CollectorScope tells whether a collector gathers data about the cluster as
+// a whole or about each project.
+type CollectorScope string
+
+// Valid collector scopes.
+const (
+	ClusterScope CollectorScope = "cluster"
+	ProjectScope CollectorScope = "project"
+)
+
+// CollectorEnv holds what collectors need to know about the system in order to
+// generate tasks.
+type CollectorEnv struct {
+	Runner   Runner
+	Projects []string
+	// MaxLogLines limits how many log lines are fetched per container.
+	MaxLogLines int
+	// ResourceFactory finds resources by name, e.g. to locate the pods
+	// running a certain component.
+	ResourceFactory ResourceMatchFactory
+	// Config holds settings such as the resources to fetch and the paths
+	// of files to copy from pods.
+	Config Config
+}
+
+// A Collector gathers one kind of data from the system, e.g. logs or resource
+// definitions.
+type Collector interface {
+	// Name uniquely identifies the collector. It is used to enable or
+	// disable collectors from the command line.
+	Name() string
+	// Description is a short human-readable explanation of what data is
+	// collected.
+	Description() string
+	Scope() CollectorScope
+	// Tasks sends tasks to collect data down the tasks channel. It
+	// returns after all tasks are sent.
+	Tasks(tasks chan<- Task, env CollectorEnv)
+}
+
+// collector is a Collector implemented by a function.
+type collector struct {
+	name        string
+	description string
+	scope       CollectorScope
+	tasks       func(tasks chan<- Task, env CollectorEnv)
+}
+
+var _ Collector = collector{}
+
+func (c collector) Name() string                              { return c.name }
+func (c collector) Description() string                       { return c.description }
+func (c collector) Scope() CollectorScope                     { return c.scope }
+func (c collector) Tasks(tasks chan<- Task, env CollectorEnv) { c.tasks(tasks, env) }
+
+// NewCollector returns a Collector that generates tasks with the given
+// function.
+func NewCollector(name, description string, scope CollectorScope, tasks func(tasks chan<- Task, env CollectorEnv)) Collector {
+	return collector{
+		name:        name,
+		description: description,
+		scope:       scope,
+		tasks:       tasks,
+	}
+}
+
+// A CollectorRegistry holds a list of collectors with unique names, in the
+// order they were registered.
+type CollectorRegistry struct {
+	collectors []Collector
+}
+
+// Register adds c to the registry. It panics if a collector with the same name
+// is already registered.
+func (r *CollectorRegistry) Register(c Collector) {
+	if r.Get(c.Name()) != nil {
+		panic(fmt.Sprintf("collector %q registered twice", c.Name()))
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// Get returns the collector with the given name, or nil if there is no such
+// collector.
+func (r *CollectorRegistry) Get(name string) Collector {
+	for _, c := range r.collectors {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// All returns all registered collectors.
+func (r *CollectorRegistry) All() []Collector {
+	return append([]Collector(nil), r.collectors...)
+}
+
+// Select returns the registered collectors named in enable, or all collectors
+// if enable is empty, minus the ones named in skip. It is an error to name an
+// unknown collector.
+func (r *CollectorRegistry) Select(enable, skip []string) ([]Collector, error) {
+	for _, name := range append(append([]string(nil), enable...), skip...) {
+		if r.Get(name) == nil {
+			return nil, fmt.Errorf("unknown collector %q, use -list-collectors to see the available collectors", name)
+		}
+	}
+	var selected []Collector
+	for _, c := range r.collectors {
+		if len(enable) > 0 && !contains(enable, c.Name()) {
+			continue
+		}
+		if contains(skip, c.Name()) {
+			continue
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+// PrintCollectors writes a table describing the given collectors to out.
+func PrintCollectors(collectors []Collector, out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCOPE\tDESCRIPTION")
+	for _, c := range collectors {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name(), c.Scope(), c.Description())
+	}
+	w.Flush()
+}
+
+// contains reports whether s is in list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated list, ignoring empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// DefaultCollectors is the registry of all collectors known to the dump tool.
+var DefaultCollectors = &CollectorRegistry{}
+
+func init() {
+	for _, c := range []Collector{
+		NewCollector("metadata", "OpenShift version, current user and its permissions", ClusterScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				GetOpenShiftMetadataTasks(tasks, env.Runner, env.Projects)
+			}),
+		NewCollector("definitions", "JSON definitions of deployment configs, pods, services, events, PVCs and config maps, or of the configured resources", ProjectScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				GetResourceDefinitionTasks(tasks, env.Runner, env.Projects, env.Config.Resources)
+			}),
+		NewCollector("cluster-definitions", "JSON definitions of persistent volumes and nodes", ClusterScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				// For cluster-scoped resources we need only one
+				// task to fetch all definitions, instead of one per
+				// project.
+				for _, resource := range env.Config.ClusterResources {
+					tasks <- ResourceDefinition(env.Runner, "", resource)
+				}
+			}),
+		NewCollector("logs", "current and previous logs of all containers in all pods", ProjectScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				// We should only care about logs for pods, because
+				// they cover all other possible types.
+				resourcesWithLogs := []string{"pods"}
+				GetFetchLogsTasks(tasks, env.Runner, env.Projects, resourcesWithLogs, env.MaxLogLines)
+			}),
+		NewCollector("nagios", "Nagios status and historical data", ProjectScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				GetNagiosTasks(tasks, env.Runner, env.Projects, env.ResourceFactory, env.Config.NagiosStatusFile, env.Config.NagiosArchivesDir)
+			}),
+		NewCollector("millicore", "Millicore configuration", ProjectScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				GetMillicoreConfigTasks(tasks, env.Runner, env.Projects, env.ResourceFactory, env.Config.MillicoreConfigFile)
+			}),
+		NewCollector("mongodb", "MongoDB replica set status and configuration, server and database statistics", ProjectScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				GetMongoDBTasks(tasks, env.Runner, env.Projects, env.ResourceFactory)
+			}),
+		NewCollector("redis", "Redis information and statistics", ProjectScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				GetRedisTasks(tasks, env.Runner, env.Projects, env.ResourceFactory)
+			}),
+		NewCollector("memcached", "memcached statistics", ProjectScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				GetMemcachedTasks(tasks, env.Runner, env.Projects, env.ResourceFactory)
+			}),
+		NewCollector("mysql", "MySQL status, variables, process list, InnoDB and replication status", ProjectScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				GetMySQLTasks(tasks, env.Runner, env.Projects, env.ResourceFactory)
+			}),
+		NewCollector("oc-adm-diagnostics", "output of oc adm diagnostics", ClusterScope,
+			func(tasks chan<- Task, env CollectorEnv) {
+				tasks <- GetOcAdmDiagnosticsTask(env.Runner)
+			}),
+	} {
+		DefaultCollectors.Register(c)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestCollectorRegistry() *CollectorRegistry {
+	r := &CollectorRegistry{}
+	for _, name := range []string{"a", "b", "c"} {
+		r.Register(NewCollector(name, "collector "+name, ProjectScope, func(tasks chan<- Task, env CollectorEnv) {}))
+	}
+	return r
+}
+
+func collectorNamesOf(collectors []Collector) []string {
+	var names []string
+	for _, c := range collectors {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+func TestCollectorRegistrySelect(t *testing.T) {
+	tests := []struct {
+		enable, skip []string
+		want         []string
+		wantErr      string
+	}{
+		{want: []string{"a", "b", "c"}},
+		{enable: []string{"c", "a"}, want: []string{"a", "c"}},
+		{skip: []string{"b"}, want: []string{"a", "c"}},
+		{enable: []string{"a", "b"}, skip: []string{"a"}, want: []string{"b"}},
+		{enable: []string{"x"}, wantErr: `unknown collector "x"`},
+		{skip: []string{"y"}, wantErr: `unknown collector "y"`},
+	}
+	r := newTestCollectorRegistry()
+	for i, tt := range tests {
+		got, err := r.Select(tt.enable, tt.skip)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%d: Select() error = %v, want %q", i, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: Select() error = %v", i, err)
+			continue
+		}
+		if names := collectorNamesOf(got); !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%d: Select() = %v, want %v", i, names, tt.want)
+		}
+	}
+}
+
+func TestCollectorRegistryRegisterTwice(t *testing.T) {
+	r := newTestCollectorRegistry()
+	defer func() {
+		if recover() == nil {
+			t.Error("Register() did not panic for a duplicate collector")
+		}
+	}()
+	r.Register(NewCollector("a", "", ClusterScope, nil))
+}
+
+func TestDefaultCollectors(t *testing.T) {
+	for _, c := range DefaultCollectors.All() {
+		if c.Description() == "" {
+			t.Errorf("collector %q has no description", c.Name())
+		}
+		if c.Scope() != ClusterScope && c.Scope() != ProjectScope {
+			t.Errorf("collector %q has invalid scope %q", c.Name(), c.Scope())
+		}
+	}
+
+	runner := &FakeRunner{}
+	tasks := make(chan Task, 1)
+	DefaultCollectors.Get("oc-adm-diagnostics").Tasks(tasks, CollectorEnv{Runner: runner})
+	if err := (<-tasks)(); err != nil {
+		t.Fatal(err)
+	}
+	want := []RunCall{{[]string{"oc", "adm", "diagnostics"}, "oc_adm_diagnostics"}}
+	if !reflect.DeepEqual(runner.Calls, want) {
+		t.Errorf("runner.Calls = %q, want %q", runner.Calls, want)
+	}
+}
+
+func TestPrintCollectors(t *testing.T) {
+	var b bytes.Buffer
+	PrintCollectors(newTestCollectorRegistry().All(), &b)
+	want := "NAME  SCOPE    DESCRIPTION\na     project  collector a\nb     project  collector b\nc     project  collector c\n"
+	if got := b.String(); got != want {
+		t.Errorf("PrintCollectors() = %q, want %q", got, want)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	if got, want := splitList(" a, ,b,"), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitList() = %q, want %q", got, want)
+	}
+	if got := splitList(""); got != nil {
+		t.Errorf("splitList(\"\") = %q, want nil", got)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Config holds the settings of a dump. Configuration files are JSON
+// representations of a Config, whose fields override the defaults, and may
+// define named profiles, each overriding the top-level settings.
+type Config struct {
+	// Projects limits the dump to these projects. Empty means all
+	// projects visible to the current user.
+	Projects       []string `json:"projects,omitempty"`
+	Collectors     []string `json:"collectors,omitempty"`
+	SkipCollectors []string `json:"skipCollectors,omitempty"`
+	Checks         []string `json:"checks,omitempty"`
+	SkipChecks     []string `json:"skipChecks,omitempty"`
+	MinSeverity    string   `json:"minSeverity,omitempty"`
+	Concurrency    int      `json:"concurrency,omitempty"`
+	MaxLogLines    int      `json:"maxLogLines,omitempty"`
+	// CommandTimeout limits how long each command may run. Zero means no
+	// limit.
+	CommandTimeout Duration `json:"commandTimeout,omitempty"`
+
+	// Resources are the types of resources whose definitions are fetched
+	// in each project, and ClusterResources the cluster-scoped ones.
+	Resources        []string `json:"resources,omitempty"`
+	ClusterResources []string `json:"clusterResources,omitempty"`
+	// PodNames maps components, e.g. mongodb, to the substrings used to
+	// find their pods by name. By default the component name itself is
+	// used.
+	PodNames map[string][]string `json:"podNames,omitempty"`
+
+	NagiosStatusFile    string `json:"nagiosStatusFile,omitempty"`
+	NagiosArchivesDir   string `json:"nagiosArchivesDir,omitempty"`
+	MillicoreConfigFile string `json:"millicoreConfigFile,omitempty"`
+
+	// Redact lists rules to remove sensitive data from collected output.
+	Redact []RedactRule `json:"redact,omitempty"`
+
+	// Profiles holds named configurations selected with -profile. They
+	// are only allowed at the top level of a configuration file.
+	Profiles map[string]Config `json:"profiles,omitempty"`
+}
+
+// DefaultConfig holds the settings used when no configuration file or profile
+// is given.
+var DefaultConfig = Config{
+	MaxLogLines: defaultMaxLogLines,
+	Resources: []string{
+		"deploymentconfigs", "pods", "services",
+		"events", "persistentvolumeclaims", "configmaps",
+	},
+	ClusterResources:    []string{"persistentvolumes", "nodes"},
+	NagiosStatusFile:    "/var/log/nagios/status.dat",
+	NagiosArchivesDir:   "/var/log/nagios/archives",
+	MillicoreConfigFile: "/etc/feedhenry/cluster-override.properties",
+}
+
+// BuiltinProfiles are the profiles available without a configuration file. A
+// configuration file may redefine them.
+var BuiltinProfiles = map[string]Config{
+	// quick gathers definitions and recent logs, skipping commands run
+	// inside pods.
+	"quick": {
+		Collectors:  []string{"metadata", "definitions", "cluster-definitions", "logs"},
+		SkipChecks:  []string{"mongodb-replica-set", "redis", "memcached", "mysql"},
+		MaxLogLines: 200,
+	},
+	// full gathers all data, with longer logs.
+	"full": {
+		MaxLogLines: 5000,
+	},
+	// storage gathers data about volumes and databases.
+	"storage": {
+		Collectors: []string{"metadata", "definitions", "cluster-definitions", "mongodb", "mysql"},
+		Checks:     []string{"pvc-not-bound", "mongodb-replica-set", "mysql"},
+		Resources:  []string{"deploymentconfigs", "pods", "events", "persistentvolumeclaims"},
+	},
+}
+
+// podComponents lists the components whose pods are found by name.
+var podComponents = []string{"nagios", "millicore", "mongodb", "redis", "memcached", "mysql"}
+
+// A Duration is a time.Duration represented in JSON as a string, e.g. "2m30s".
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s, must be a string such as \"30s\"", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadConfig returns the configuration resulting from applying the file in
+// path, if not empty, and then the named profile, if not empty, to
+// DefaultConfig. Profiles are looked up in the file first, then in
+// BuiltinProfiles.
+func LoadConfig(path, profile string) (Config, error) {
+	var file Config
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		if file, err = parseConfig(b); err != nil {
+			return Config{}, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	cfg := DefaultConfig.Merge(file)
+	if profile != "" {
+		p, ok := file.Profiles[profile]
+		if !ok {
+			p, ok = BuiltinProfiles[profile]
+		}
+		if !ok {
+			return Config{}, fmt.Errorf("unknown profile %q, must be one of: %s", profile, strings.Join(profileNames(file), " "))
+		}
+		cfg = cfg.Merge(p)
+	}
+	cfg.Profiles = nil
+	return cfg, cfg.Validate()
+}
+
+// parseConfig parses a configuration file. Unlike json.Unmarshal, unknown
+// fields are an error, to catch misspelled settings.
+func parseConfig(b []byte) (Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return Config{}, err
+	}
+	if err := checkConfigFields(b, ""); err != nil {
+		return Config{}, err
+	}
+	for name, p := range cfg.Profiles {
+		if p.Profiles != nil {
+			return Config{}, fmt.Errorf("profile %q: profiles cannot be nested", name)
+		}
+	}
+	return cfg, nil
+}
+
+// checkConfigFields returns an error if the JSON object in b has fields that
+// are not in Config. Profiles are checked recursively.
+func checkConfigFields(b []byte, profile string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		known[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	for name, v := range fields {
+		if !known[name] {
+			if profile != "" {
+				return fmt.Errorf("profile %q: unknown setting %q", profile, name)
+			}
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		if name == "profiles" && profile == "" {
+			var profiles map[string]json.RawMessage
+			if err := json.Unmarshal(v, &profiles); err != nil {
+				return err
+			}
+			for p, v := range profiles {
+				if err := checkConfigFields(v, p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// profileNames returns the sorted names of the profiles defined in cfg and the
+// built-in profiles.
+func profileNames(cfg Config) []string {
+	var names []string
+	for name := range BuiltinProfiles {
+		names = append(names, name)
+	}
+	for name := range cfg.Profiles {
+		if _, ok := BuiltinProfiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Merge returns a copy of c with the settings of other that are not empty.
+// Pod names are merged per component, and redaction rules are appended, so
+// that a profile cannot accidentally disable redaction.
+func (c Config) Merge(other Config) Config {
+	merged := c
+	setStrings := func(dst *[]string, src []string) {
+		if len(src) > 0 {
+			*dst = src
+		}
+	}
+	setStrings(&merged.Projects, other.Projects)
+	setStrings(&merged.Collectors, other.Collectors)
+	setStrings(&merged.SkipCollectors, other.SkipCollectors)
+	setStrings(&merged.Checks, other.Checks)
+	setStrings(&merged.SkipChecks, other.SkipChecks)
+	setStrings(&merged.Resources, other.Resources)
+	setStrings(&merged.ClusterResources, other.ClusterResources)
+	setString := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	setString(&merged.MinSeverity, other.MinSeverity)
+	setString(&merged.NagiosStatusFile, other.NagiosStatusFile)
+	setString(&merged.NagiosArchivesDir, other.NagiosArchivesDir)
+	setString(&merged.MillicoreConfigFile, other.MillicoreConfigFile)
+	if other.Concurrency != 0 {
+		merged.Concurrency = other.Concurrency
+	}
+	if other.MaxLogLines != 0 {
+		merged.MaxLogLines = other.MaxLogLines
+	}
+	if other.CommandTimeout != 0 {
+		merged.CommandTimeout = other.CommandTimeout
+	}
+	if len(other.PodNames) > 0 {
+		merged.PodNames = make(map[string][]string)
+		for k, v := range c.PodNames {
+			merged.PodNames[k] = v
+		}
+		for k, v := range other.PodNames {
+			merged.PodNames[k] = v
+		}
+	}
+	if len(other.Redact) > 0 {
+		merged.Redact = append(append([]RedactRule(nil), c.Redact...), other.Redact...)
+	}
+	if other.Profiles != nil {
+		merged.Profiles = other.Profiles
+	}
+	return merged
+}
+
+// Validate checks settings that are not validated with the corresponding
+// flags.
+func (c Config) Validate() error {
+	if c.Concurrency < 0 || c.MaxLogLines < 0 || c.CommandTimeout < 0 {
+		return fmt.Errorf("concurrency, maxLogLines and commandTimeout must not be negative")
+	}
+	for component, names := range c.PodNames {
+		if !contains(podComponents, component) {
+			return fmt.Errorf("unknown component %q in podNames, must be one of: %s", component, strings.Join(podComponents, " "))
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("podNames of component %q must not be empty", component)
+		}
+	}
+	if _, err := NewRedactor(c.Redact); err != nil {
+		return err
+	}
+	return nil
+}
+
+// flagValues returns the settings of c that have a corresponding command line
+// flag, as flag values keyed by flag name. Empty settings are left out.
+func (c Config) flagValues() map[string]string {
+	values := make(map[string]string)
+	setList := func(name string, list []string) {
+		if len(list) > 0 {
+			values[name] = strings.Join(list, ",")
+		}
+	}
+	setList("projects", c.Projects)
+	setList("collectors", c.Collectors)
+	setList("skip-collectors", c.SkipCollectors)
+	setList("checks", c.Checks)
+	setList("skip-checks", c.SkipChecks)
+	if c.MinSeverity != "" {
+		values["min-severity"] = c.MinSeverity
+	}
+	if c.Concurrency != 0 {
+		values["p"] = strconv.Itoa(c.Concurrency)
+	}
+	if c.MaxLogLines != 0 {
+		values["max-log-lines"] = strconv.Itoa(c.MaxLogLines)
+	}
+	if c.CommandTimeout != 0 {
+		values["command-timeout"] = time.Duration(c.CommandTimeout).String()
+	}
+	return values
+}
+
+// ApplyConfigFlags sets the flags in fs that correspond to settings of cfg,
+// except for flags given on the command line, which take precedence.
+func ApplyConfigFlags(fs *flag.FlagSet, cfg Config) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, value := range cfg.flagValues() {
+		if set[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for flag -%s: %v", value, name, err)
+		}
+	}
+	return nil
+}
+
+// podNameFactory returns a ResourceMatchFactory that finds the pods of the
+// components in podNames with f, matching any of the configured name
+// substrings instead of the component name.
+func podNameFactory(f ResourceMatchFactory, podNames map[string][]string) ResourceMatchFactory {
+	if len(podNames) == 0 {
+		return f
+	}
+	return func(project, resource, substr string) ([]string, error) {
+		substrs, ok := podNames[substr]
+		if !ok || resource != "pod" {
+			return f(project, resource, substr)
+		}
+		var names []string
+		seen := make(map[string]bool)
+		for _, s := range substrs {
+			matches, err := f(project, resource, s)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range matches {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		return names, nil
+	}
+}
+
+// filterProjects returns the projects in visible that are in only, or all
+// visible projects if only is empty. It is an error if a project in only is
+// not visible.
+func filterProjects(visible, only []string) ([]string, error) {
+	if len(only) == 0 {
+		return visible, nil
+	}
+	for _, p := range only {
+		if !contains(visible, p) {
+			return nil, fmt.Errorf("project %q does not exist or is not visible to the currently logged in user", p)
+		}
+	}
+	var projects []string
+	for _, p := range visible {
+		if contains(only, p) {
+			projects = append(projects, p)
+		}
+	}
+	return projects, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTempConfig writes a configuration file and returns its path.
+func writeTempConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "test-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeTempConfig(t, `{
+    "projects": ["core", "mbaas"],
+    "maxLogLines": 500,
+    "commandTimeout": "2m",
+    "podNames": {"mongodb": ["mongo-"]},
+    "redact": [{"pattern": "password=\\S+"}],
+    "profiles": {
+        "quick": {"maxLogLines": 50},
+        "mine": {
+            "collectors": ["logs"],
+            "podNames": {"mysql": ["mariadb"]},
+            "redact": [{"pattern": "token=\\S+"}]
+        }
+    }
+}`)
+	defer os.Remove(path)
+
+	tests := []struct {
+		profile string
+		check   func(cfg Config) error
+	}{
+		{"", func(cfg Config) error {
+			if !reflect.DeepEqual(cfg.Projects, []string{"core", "mbaas"}) || cfg.MaxLogLines != 500 || cfg.CommandTimeout != Duration(2*time.Minute) {
+				return errors.New("settings of the file not applied")
+			}
+			if !reflect.DeepEqual(cfg.Resources, DefaultConfig.Resources) || cfg.NagiosStatusFile != DefaultConfig.NagiosStatusFile {
+				return errors.New("defaults not kept")
+			}
+			if cfg.Profiles != nil {
+				return errors.New("profiles not removed")
+			}
+			return nil
+		}},
+		// Profiles in the file replace built-in profiles.
+		{"quick", func(cfg Config) error {
+			if cfg.MaxLogLines != 50 || cfg.Collectors != nil {
+				return errors.New("profile of the file not applied")
+			}
+			return nil
+		}},
+		{"storage", func(cfg Config) error {
+			if !reflect.DeepEqual(cfg.Collectors, BuiltinProfiles["storage"].Collectors) || cfg.MaxLogLines != 500 {
+				return errors.New("built-in profile not applied")
+			}
+			return nil
+		}},
+		{"mine", func(cfg Config) error {
+			if want := map[string][]string{"mongodb": {"mongo-"}, "mysql": {"mariadb"}}; !reflect.DeepEqual(cfg.PodNames, want) {
+				return errors.New("pod names not merged")
+			}
+			if len(cfg.Redact) != 2 {
+				return errors.New("redaction rules not appended")
+			}
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		cfg, err := LoadConfig(path, tt.profile)
+		if err != nil {
+			t.Errorf("LoadConfig(%q) error = %v", tt.profile, err)
+			continue
+		}
+		if err := tt.check(cfg); err != nil {
+			t.Errorf("LoadConfig(%q): %v, got %+v", tt.profile, err, cfg)
+		}
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := LoadConfig("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, DefaultConfig) {
+		t.Errorf("LoadConfig() = %+v, want DefaultConfig", cfg)
+	}
+	cfg, err = LoadConfig("", "quick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxLogLines != 200 {
+		t.Errorf("LoadConfig(quick).MaxLogLines = %d, want 200", cfg.MaxLogLines)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		content, profile string
+		wantErr          string
+	}{
+		{`{"maxLogLine": 10}`, "", `unknown setting "maxLogLine"`},
+		{`{"profiles": {"p": {"colectors": []}}}`, "p", `profile "p": unknown setting "colectors"`},
+		{`{"profiles": {"p": {"profiles": {}}}}`, "p", "profiles cannot be nested"},
+		{`{"commandTimeout": 10}`, "", "invalid duration"},
+		{`{"commandTimeout": "10"}`, "", "missing unit"},
+		{`{"podNames": {"mongo": ["mongo"]}}`, "", `unknown component "mongo"`},
+		{`{"podNames": {"mongodb": []}}`, "", "must not be empty"},
+		{`{"redact": [{"pattern": "("}]}`, "", "invalid redaction pattern"},
+		{`{"concurrency": -1}`, "", "must not be negative"},
+		{`{}`, "nope", `unknown profile "nope", must be one of: full quick storage`},
+		{`{`, "", "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		path := writeTempConfig(t, tt.content)
+		_, err := LoadConfig(path, tt.profile)
+		os.Remove(path)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("LoadConfig(%s, %q) error = %v, want %q", tt.content, tt.profile, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyConfigFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	p := fs.Int("p", 4, "")
+	maxLogLines := fs.Int("max-log-lines", 1000, "")
+	collectors := fs.String("collectors", "", "")
+	timeout := fs.Duration("command-timeout", 0, "")
+	if err := fs.Parse([]string{"-p=8"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Concurrency:    2,
+		MaxLogLines:    50,
+		Collectors:     []string{"logs", "nagios"},
+		CommandTimeout: Duration(time.Minute),
+		// There is no flag for this one in fs.
+		SkipChecks: []string{"events"},
+	}
+	if err := ApplyConfigFlags(fs, cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Flags given on the command line take precedence.
+	if *p != 8 {
+		t.Errorf("-p = %d, want 8", *p)
+	}
+	if *maxLogLines != 50 || *collectors != "logs,nagios" || *timeout != time.Minute {
+		t.Errorf("flags = %d, %q, %v, want 50, %q, %v", *maxLogLines, *collectors, *timeout, "logs,nagios", time.Minute)
+	}
+}
+
+func TestPodNameFactory(t *testing.T) {
+	var calls []string
+	f := func(project, resource, substr string) ([]string, error) {
+		calls = append(calls, resource+":"+substr)
+		switch substr {
+		case "mongo-":
+			return []string{"mongo-1", "mongo-2"}, nil
+		case "mongodb":
+			return []string{"mongodb-1", "mongo-1"}, nil
+		}
+		return []string{substr + "-1"}, nil
+	}
+	factory := podNameFactory(f, map[string][]string{"mongodb": {"mongo-", "mongodb"}})
+
+	got, err := factory("p", "pod", "mongodb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"mongo-1", "mongo-2", "mongodb-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("factory(mongodb) = %q, want %q", got, want)
+	}
+	if got, _ := factory("p", "pod", "redis"); !reflect.DeepEqual(got, []string{"redis-1"}) {
+		t.Errorf("factory(redis) = %q, want %q", got, []string{"redis-1"})
+	}
+	if want := []string{"pod:mongo-", "pod:mongodb", "pod:redis"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestFilterProjects(t *testing.T) {
+	visible := []string{"core", "mbaas", "other"}
+	tests := []struct {
+		only    []string
+		want    []string
+		wantErr string
+	}{
+		{nil, visible, ""},
+		{[]string{"mbaas", "core"}, []string{"core", "mbaas"}, ""},
+		{[]string{"core", "missing"}, nil, `project "missing" does not exist`},
+	}
+	for _, tt := range tests {
+		got, err := filterProjects(visible, tt.only)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("filterProjects(%q) error = %v, want %q", tt.only, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterProjects(%q) = %q, %v, want %q", tt.only, got, err, tt.want)
+		}
+	}
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	for name, p := range BuiltinProfiles {
+		if _, err := DefaultCollectors.Select(p.Collectors, p.SkipCollectors); err != nil {
+			t.Errorf("profile %q: %v", name, err)
+		}
+		if _, err := DefaultChecks.Select(p.Checks, p.SkipChecks); err != nil {
+			t.Errorf("profile %q: %v", name, err)
+		}
+		if err := DefaultConfig.Merge(p).Validate(); err != nil {
+			t.Errorf("profile %q: %v", name, err)
+		}
+	}
+}
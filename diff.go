@@ -0,0 +1,469 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// fieldDiffKinds lists the kinds of resources for which changed objects are
+// reported with field-level differences. Objects of other kinds are only
+// reported when added or removed, because they change too often to be useful,
+// e.g. pods and events.
+var fieldDiffKinds = []string{"deploymentconfigs", "configmaps", "services"}
+
+// ignoredDiffFields lists paths of fields, and their subfields, that change
+// without any meaningful change to an object.
+var ignoredDiffFields = []string{
+	"metadata.resourceVersion",
+	"metadata.uid",
+	"metadata.selfLink",
+	"metadata.creationTimestamp",
+	"metadata.generation",
+	"status.conditions",
+	"status.observedGeneration",
+}
+
+// DumpDiff describes the differences between two dumps, A and B.
+type DumpDiff struct {
+	A         string          `json:"a"`
+	B         string          `json:"b"`
+	Resources []ResourceDiff  `json:"resources,omitempty"`
+	Images    []ImageChange   `json:"images,omitempty"`
+	Replicas  []ReplicaChange `json:"replicas,omitempty"`
+	Analysis  []CheckChange   `json:"analysis,omitempty"`
+}
+
+// ResourceDiff lists objects of a kind that were added, removed or changed in
+// a project. Project is empty for cluster-scoped resources.
+type ResourceDiff struct {
+	Project string       `json:"project,omitempty"`
+	Kind    string       `json:"kind"`
+	Added   []string     `json:"added,omitempty"`
+	Removed []string     `json:"removed,omitempty"`
+	Changed []ObjectDiff `json:"changed,omitempty"`
+}
+
+// ObjectDiff lists the fields that changed in an object.
+type ObjectDiff struct {
+	Name   string      `json:"name"`
+	Fields []FieldDiff `json:"fields"`
+}
+
+// FieldDiff is a field with different values in A and B. A missing field has
+// a nil value.
+type FieldDiff struct {
+	Path string      `json:"path"`
+	A    interface{} `json:"a"`
+	B    interface{} `json:"b"`
+}
+
+// ImageChange is a container in a deployment config using a different image
+// in A and B.
+type ImageChange struct {
+	Project          string `json:"project"`
+	DeploymentConfig string `json:"deploymentConfig"`
+	Container        string `json:"container"`
+	A                string `json:"a"`
+	B                string `json:"b"`
+}
+
+// ReplicaChange is a deployment config with a different number of replicas in
+// A and B.
+type ReplicaChange struct {
+	Project          string `json:"project"`
+	DeploymentConfig string `json:"deploymentConfig"`
+	A                int    `json:"a"`
+	B                int    `json:"b"`
+}
+
+// CheckChange is an analysis check with a different outcome in A and B. The
+// outcome is one of ok, failed or missing.
+type CheckChange struct {
+	Project string `json:"project"`
+	Check   string `json:"check"`
+	A       string `json:"a"`
+	B       string `json:"b"`
+}
+
+// Empty reports whether no differences were found.
+func (d DumpDiff) Empty() bool {
+	return len(d.Resources) == 0 && len(d.Images) == 0 && len(d.Replicas) == 0 && len(d.Analysis) == 0
+}
+
+// diffCommand implements the diff command, that compares two dumps.
+func diffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonPath := fs.String("json", "dump-diff.json", "write the JSON diff report to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fh-system-dump-tool diff [flags] <dumpA> <dumpB>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Compares two dumps, given as directories or archives.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("diff requires exactly two dumps")
+	}
+	pathA, pathB := fs.Arg(0), fs.Arg(1)
+
+	dirA, cleanupA, err := OpenDump(pathA)
+	if err != nil {
+		return err
+	}
+	defer cleanupA()
+	dirB, cleanupB, err := OpenDump(pathB)
+	if err != nil {
+		return err
+	}
+	defer cleanupB()
+
+	d, err := DiffDumps(dirA, dirB)
+	if err != nil {
+		return err
+	}
+	d.A, d.B = pathA, pathB
+
+	PrintDumpDiff(d, os.Stdout)
+
+	b, err := json.MarshalIndent(d, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*jsonPath, b, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "JSON diff report written to: %s\n", *jsonPath)
+	return nil
+}
+
+// DiffDumps compares the dumps in directories dirA and dirB.
+func DiffDumps(dirA, dirB string) (DumpDiff, error) {
+	var d DumpDiff
+
+	defsA, err := loadAllDefinitions(dirA)
+	if err != nil {
+		return d, err
+	}
+	defsB, err := loadAllDefinitions(dirB)
+	if err != nil {
+		return d, err
+	}
+	for _, key := range unionKeys(defsA, defsB) {
+		project, kind := splitDefinitionKey(key)
+		rd := diffObjects(defsA[key], defsB[key], contains(fieldDiffKinds, kind))
+		if len(rd.Added) > 0 || len(rd.Removed) > 0 || len(rd.Changed) > 0 {
+			rd.Project, rd.Kind = project, kind
+			d.Resources = append(d.Resources, rd)
+		}
+		if kind == "deploymentconfigs" {
+			images, replicas := diffDeploymentConfigs(project, defsA[key], defsB[key])
+			d.Images = append(d.Images, images...)
+			d.Replicas = append(d.Replicas, replicas...)
+		}
+	}
+
+	checksA, err := loadCheckOutcomes(dirA)
+	if err != nil {
+		return d, err
+	}
+	checksB, err := loadCheckOutcomes(dirB)
+	if err != nil {
+		return d, err
+	}
+	for _, key := range unionKeys(checksA, checksB) {
+		a, b := checksA[key], checksB[key]
+		if a == b {
+			continue
+		}
+		if a == "" {
+			a = "missing"
+		}
+		if b == "" {
+			b = "missing"
+		}
+		project, check := splitDefinitionKey(key)
+		d.Analysis = append(d.Analysis, CheckChange{Project: project, Check: check, A: a, B: b})
+	}
+	return d, nil
+}
+
+// loadAllDefinitions loads the definitions of all resources in a dump. The
+// result maps "project/kind" keys to objects keyed by name. Cluster-scoped
+// resources have an empty project.
+func loadAllDefinitions(dir string) (map[string]map[string]interface{}, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "definitions", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	projectPaths, err := filepath.Glob(filepath.Join(dir, "projects", "*", "definitions", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	defs := make(map[string]map[string]interface{})
+	for _, path := range append(paths, projectPaths...) {
+		var project string
+		if rel, err := filepath.Rel(filepath.Join(dir, "projects"), path); err == nil && !strings.HasPrefix(rel, "..") {
+			project = strings.Split(filepath.ToSlash(rel), "/")[0]
+		}
+		kind := strings.TrimSuffix(filepath.Base(path), ".json")
+
+		var list struct {
+			Items []map[string]interface{} `json:"items"`
+		}
+		if err := load(path, &list); err != nil {
+			// Definitions that could not be fetched are empty
+			// files, there is nothing to compare.
+			continue
+		}
+		objects := make(map[string]interface{}, len(list.Items))
+		for _, item := range list.Items {
+			objects[formatValues(evalPath(item, "{.metadata.name}"))] = item
+		}
+		defs[project+"/"+kind] = objects
+	}
+	return defs, nil
+}
+
+// loadCheckOutcomes loads analysis results from a dump. The result maps
+// "project/check" keys to either ok or failed. A dump without analysis
+// results has no outcomes.
+func loadCheckOutcomes(dir string) (map[string]string, error) {
+	report, err := ReadAnalysis(filepath.Join(dir, "analysis.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	outcomes := make(map[string]string)
+	for _, projectResult := range report.Projects {
+		for _, r := range projectResult.Results {
+			check := r.CheckID
+			if check == "" {
+				check = r.CheckName
+			}
+			outcome := "ok"
+			if !r.Ok {
+				outcome = "failed"
+			}
+			outcomes[projectResult.Project+"/"+check] = outcome
+		}
+	}
+	return outcomes, nil
+}
+
+// splitDefinitionKey splits a "project/name" key.
+func splitDefinitionKey(key string) (project, name string) {
+	i := strings.Index(key, "/")
+	return key[:i], key[i+1:]
+}
+
+// unionKeys returns the sorted union of the keys of a and b, that must be maps
+// with string keys.
+func unionKeys(a, b interface{}) []string {
+	set := make(map[string]bool)
+	for _, m := range []interface{}{a, b} {
+		for _, k := range reflect.ValueOf(m).MapKeys() {
+			set[k.String()] = true
+		}
+	}
+	return sortedKeys(set)
+}
+
+// diffObjects compares objects keyed by name. Changed objects are only
+// compared if withFields is true.
+func diffObjects(a, b map[string]interface{}, withFields bool) ResourceDiff {
+	var rd ResourceDiff
+	for _, name := range unionKeys(a, b) {
+		objA, inA := a[name]
+		objB, inB := b[name]
+		switch {
+		case !inA:
+			rd.Added = append(rd.Added, name)
+		case !inB:
+			rd.Removed = append(rd.Removed, name)
+		case withFields:
+			if fields := diffFields(objA, objB); len(fields) > 0 {
+				rd.Changed = append(rd.Changed, ObjectDiff{Name: name, Fields: fields})
+			}
+		}
+	}
+	return rd
+}
+
+// diffFields returns the fields that differ between a and b.
+func diffFields(a, b interface{}) []FieldDiff {
+	flatA, flatB := make(map[string]interface{}), make(map[string]interface{})
+	flatten("", a, flatA)
+	flatten("", b, flatB)
+	var fields []FieldDiff
+	for _, path := range unionKeys(flatA, flatB) {
+		if ignoredDiffField(path) {
+			continue
+		}
+		if !reflect.DeepEqual(flatA[path], flatB[path]) {
+			fields = append(fields, FieldDiff{Path: path, A: flatA[path], B: flatB[path]})
+		}
+	}
+	return fields
+}
+
+// ignoredDiffField reports whether path is or is within an ignored field.
+func ignoredDiffField(path string) bool {
+	for _, ignored := range ignoredDiffFields {
+		if path == ignored || strings.HasPrefix(path, ignored+".") || strings.HasPrefix(path, ignored+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten stores the leaf values of the JSON value v into out, keyed by their
+// path, e.g. spec.template.spec.containers[0].image.
+func flatten(prefix string, v interface{}, out map[string]interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			out[prefix] = v
+		}
+		for k, elem := range v {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			flatten(path, elem, out)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			out[prefix] = v
+		}
+		for i, elem := range v {
+			flatten(prefix+"["+strconv.Itoa(i)+"]", elem, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+// diffDeploymentConfigs compares the container images and number of replicas
+// of deployment configs present in both a and b.
+func diffDeploymentConfigs(project string, a, b map[string]interface{}) ([]ImageChange, []ReplicaChange) {
+	var (
+		images   []ImageChange
+		replicas []ReplicaChange
+	)
+	for _, name := range unionKeys(a, b) {
+		dcA, inA := a[name]
+		dcB, inB := b[name]
+		if !inA || !inB {
+			continue
+		}
+		imagesA, imagesB := containerImages(dcA), containerImages(dcB)
+		for _, container := range unionKeys(imagesA, imagesB) {
+			if imagesA[container] != imagesB[container] {
+				images = append(images, ImageChange{
+					Project:          project,
+					DeploymentConfig: name,
+					Container:        container,
+					A:                imagesA[container],
+					B:                imagesB[container],
+				})
+			}
+		}
+		replicasA, replicasB := replicaCount(dcA), replicaCount(dcB)
+		if replicasA != replicasB {
+			replicas = append(replicas, ReplicaChange{
+				Project:          project,
+				DeploymentConfig: name,
+				A:                replicasA,
+				B:                replicasB,
+			})
+		}
+	}
+	return images, replicas
+}
+
+// containerImages maps container names to images in a deployment config.
+func containerImages(dc interface{}) map[string]string {
+	images := make(map[string]string)
+	for _, c := range evalPath(dc, "{.spec.template.spec.containers[*]}") {
+		images[formatValues(evalPath(c, "{.name}"))] = formatValues(evalPath(c, "{.image}"))
+	}
+	return images
+}
+
+// replicaCount returns the number of replicas of a deployment config.
+func replicaCount(dc interface{}) int {
+	n, _ := toFloat(formatValues(evalPath(dc, "{.spec.replicas}")))
+	return int(n)
+}
+
+// PrintDumpDiff writes a human-readable summary of d to out.
+func PrintDumpDiff(d DumpDiff, out io.Writer) {
+	if d.Empty() {
+		fmt.Fprintln(out, "No differences found")
+		return
+	}
+	where := func(project string) string {
+		if project == "" {
+			return "cluster"
+		}
+		return "project " + project
+	}
+	if len(d.Resources) > 0 {
+		fmt.Fprintln(out, "Resources:")
+		for _, rd := range d.Resources {
+			fmt.Fprintf(out, "  %s in %s:\n", rd.Kind, where(rd.Project))
+			for _, name := range rd.Added {
+				fmt.Fprintf(out, "    + %s\n", name)
+			}
+			for _, name := range rd.Removed {
+				fmt.Fprintf(out, "    - %s\n", name)
+			}
+			for _, od := range rd.Changed {
+				fmt.Fprintf(out, "    ~ %s\n", od.Name)
+				for _, f := range od.Fields {
+					fmt.Fprintf(out, "        %s: %s -> %s\n", f.Path, formatDiffValue(f.A), formatDiffValue(f.B))
+				}
+			}
+		}
+	}
+	if len(d.Images) > 0 {
+		fmt.Fprintln(out, "Images:")
+		for _, c := range d.Images {
+			fmt.Fprintf(out, "  %s/%s container %s: %s -> %s\n", c.Project, c.DeploymentConfig, c.Container, formatDiffValue(c.A), formatDiffValue(c.B))
+		}
+	}
+	if len(d.Replicas) > 0 {
+		fmt.Fprintln(out, "Replicas:")
+		for _, c := range d.Replicas {
+			fmt.Fprintf(out, "  %s/%s: %d -> %d\n", c.Project, c.DeploymentConfig, c.A, c.B)
+		}
+	}
+	if len(d.Analysis) > 0 {
+		fmt.Fprintln(out, "Analysis:")
+		for _, c := range d.Analysis {
+			fmt.Fprintf(out, "  %s in project %s: %s -> %s\n", c.Check, c.Project, c.A, c.B)
+		}
+	}
+}
+
+// formatDiffValue formats a value for PrintDumpDiff, showing missing values
+// explicitly.
+func formatDiffValue(v interface{}) string {
+	if v == nil || v == "" {
+		return "(none)"
+	}
+	return formatValue(v)
+}
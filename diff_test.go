@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeDumpFiles creates a fake dump in dir with the given files, keyed by
+// path relative to dir.
+func writeDumpFiles(t *testing.T, dir string, files map[string]string) {
+	files["version"] = "RHMAP fh-system-dump-tool test\n"
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiffDumps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-diff-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirA, dirB := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeDumpFiles(t, dirA, map[string]string{
+		"projects/core/definitions/deploymentconfigs.json": `{"items": [
+			{"metadata": {"name": "fh-ngui", "resourceVersion": "1"}, "spec": {"replicas": 1, "template": {"spec": {"containers": [{"name": "fh-ngui", "image": "rhmap/fh-ngui:1.0"}]}}}}
+		]}`,
+		"projects/core/definitions/pods.json": `{"items": [{"metadata": {"name": "fh-ngui-1-aaaaa"}}]}`,
+		"definitions/nodes.json":              `{"items": [{"metadata": {"name": "node-1"}}]}`,
+		"analysis.json":                       `{"projects": [{"project": "core", "checks": [{"id": "events", "name": "check event log for errors", "ok": true}]}]}`,
+	})
+	writeDumpFiles(t, dirB, map[string]string{
+		"projects/core/definitions/deploymentconfigs.json": `{"items": [
+			{"metadata": {"name": "fh-ngui", "resourceVersion": "2"}, "spec": {"replicas": 0, "template": {"spec": {"containers": [{"name": "fh-ngui", "image": "rhmap/fh-ngui:1.1"}]}}}}
+		]}`,
+		"projects/core/definitions/pods.json": `{"items": [{"metadata": {"name": "fh-ngui-2-bbbbb"}}]}`,
+		"definitions/nodes.json":              `{"items": [{"metadata": {"name": "node-1"}}]}`,
+		"analysis.json":                       `{"projects": [{"project": "core", "checks": [{"id": "events", "name": "check event log for errors", "ok": false}]}]}`,
+	})
+
+	got, err := DiffDumps(dirA, dirB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DumpDiff{
+		Resources: []ResourceDiff{
+			{
+				Project: "core",
+				Kind:    "deploymentconfigs",
+				Changed: []ObjectDiff{
+					{
+						Name: "fh-ngui",
+						Fields: []FieldDiff{
+							{Path: "spec.replicas", A: 1.0, B: 0.0},
+							{Path: "spec.template.spec.containers[0].image", A: "rhmap/fh-ngui:1.0", B: "rhmap/fh-ngui:1.1"},
+						},
+					},
+				},
+			},
+			{
+				Project: "core",
+				Kind:    "pods",
+				Added:   []string{"fh-ngui-2-bbbbb"},
+				Removed: []string{"fh-ngui-1-aaaaa"},
+			},
+		},
+		Images: []ImageChange{
+			{Project: "core", DeploymentConfig: "fh-ngui", Container: "fh-ngui", A: "rhmap/fh-ngui:1.0", B: "rhmap/fh-ngui:1.1"},
+		},
+		Replicas: []ReplicaChange{
+			{Project: "core", DeploymentConfig: "fh-ngui", A: 1, B: 0},
+		},
+		Analysis: []CheckChange{
+			{Project: "core", Check: "events", A: "ok", B: "failed"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffDumps() = \n%#v, want \n%#v", got, want)
+	}
+
+	var out bytes.Buffer
+	PrintDumpDiff(got, &out)
+	for _, s := range []string{
+		"deploymentconfigs in project core",
+		"spec.replicas: 1 -> 0",
+		"+ fh-ngui-2-bbbbb",
+		"- fh-ngui-1-aaaaa",
+		"core/fh-ngui container fh-ngui: rhmap/fh-ngui:1.0 -> rhmap/fh-ngui:1.1",
+		"events in project core: ok -> failed",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("PrintDumpDiff() = %q, want to contain %q", out.String(), s)
+		}
+	}
+}
+
+func TestDiffDumpsIdentical(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-diff-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeDumpFiles(t, dir, map[string]string{
+		"projects/core/definitions/services.json": `{"items": [{"metadata": {"name": "fh-ngui"}, "spec": {"ports": [{"port": 8080}]}}]}`,
+	})
+
+	got, err := DiffDumps(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Empty() {
+		t.Errorf("DiffDumps() = %#v, want empty diff", got)
+	}
+	var out bytes.Buffer
+	PrintDumpDiff(got, &out)
+	if out.String() != "No differences found\n" {
+		t.Errorf("PrintDumpDiff() = %q", out.String())
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// A DumpPlan lists the commands a dump would run, as found by a dry run.
+type DumpPlan struct {
+	Projects []string `json:"projects"`
+	// Discovery lists the commands run to find the projects.
+	Discovery  []PlannedCommand `json:"discovery"`
+	Collectors []CollectorPlan  `json:"collectors"`
+}
+
+// A CollectorPlan lists the commands a collector would run.
+type CollectorPlan struct {
+	Collector string           `json:"collector"`
+	Commands  []PlannedCommand `json:"commands"`
+}
+
+// A PlannedCommand is a command a dump would run.
+type PlannedCommand struct {
+	Command []string `json:"command"`
+	// Output is where the output of the command would be written within
+	// the dump.
+	Output string `json:"output,omitempty"`
+	// Discovery tells that the command is read-only and its output is used
+	// to find what data to collect, e.g. the names of pods. Only discovery
+	// commands are run in a dry run.
+	Discovery bool `json:"discovery,omitempty"`
+}
+
+// dryRunRunner is a Runner that records commands instead of running them.
+// Discovery commands are run, without writing their output to disk.
+type dryRunRunner struct {
+	mu       sync.Mutex
+	commands []PlannedCommand
+}
+
+var _ Runner = (*dryRunRunner)(nil)
+
+func (r *dryRunRunner) Run(cmd *exec.Cmd, path string) error {
+	discovery := isDiscoveryCommand(cmd)
+	r.mu.Lock()
+	r.commands = append(r.commands, PlannedCommand{Command: cmd.Args, Output: path, Discovery: discovery})
+	r.mu.Unlock()
+	if !discovery {
+		return nil
+	}
+	var stderr bytes.Buffer
+	if cmd.Stderr == nil {
+		cmd.Stderr = &stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return &CommandError{Args: cmd.Args, Err: err, Stderr: stderr.String()}
+	}
+	return nil
+}
+
+// isDiscoveryCommand reports whether cmd is a read-only command whose output
+// is used by the dump tool to find what data to collect. Other commands write
+// their output only to disk.
+func isDiscoveryCommand(cmd *exec.Cmd) bool {
+	if cmd.Stdout == nil || len(cmd.Args) == 0 || cmd.Args[0] != "oc" {
+		return false
+	}
+	_, _, positional := parseOcArgs(cmd.Args)
+	return len(positional) > 0 && positional[0] == "get"
+}
+
+// PlanDump finds the commands the given collectors would run with the settings
+// in cfg, without running any commands other than discovery commands, and
+// returns them with the errors of discovery commands.
+func PlanDump(collectors []Collector, cfg Config) (DumpPlan, []error) {
+	var plan DumpPlan
+
+	runner := &dryRunRunner{}
+	projects, err := getDumpProjects(runner, cfg.Projects)
+	plan.Discovery = runner.commands
+	if err != nil {
+		return plan, []error{err}
+	}
+	plan.Projects = projects
+
+	var errs []error
+	for _, c := range collectors {
+		runner := &dryRunRunner{}
+		env := CollectorEnv{
+			Runner:          runner,
+			Projects:        projects,
+			MaxLogLines:     cfg.MaxLogLines,
+			ResourceFactory: podNameFactory(resourceMatchFactory(runner), cfg.PodNames),
+			Config:          cfg,
+		}
+		// Generate all tasks before running any of them, so that
+		// discovery commands are listed first.
+		ch := make(chan Task)
+		go func() {
+			defer close(ch)
+			c.Tasks(ch, env)
+		}()
+		var tasks []Task
+		for task := range ch {
+			tasks = append(tasks, task)
+		}
+		for _, task := range tasks {
+			if err := task(); err != nil {
+				errs = append(errs, newTaskError(c.Name(), err))
+			}
+		}
+		plan.Collectors = append(plan.Collectors, CollectorPlan{Collector: c.Name(), Commands: runner.commands})
+	}
+	return plan, errs
+}
+
+// PrintDumpPlan writes a human-readable view of plan to out.
+func PrintDumpPlan(plan DumpPlan, out io.Writer) {
+	printCommands := func(commands []PlannedCommand) {
+		for _, c := range commands {
+			s := "  " + formatCommand(c.Command)
+			if c.Output != "" {
+				s += " > " + c.Output
+			}
+			if c.Discovery {
+				s += " (discovery)"
+			}
+			fmt.Fprintln(out, s)
+		}
+	}
+	fmt.Fprintln(out, "Projects:", strings.Join(plan.Projects, ", "))
+	fmt.Fprintln(out, "Discovery:")
+	printCommands(plan.Discovery)
+	for _, c := range plan.Collectors {
+		fmt.Fprintf(out, "Collector %s:\n", c.Collector)
+		printCommands(c.Commands)
+	}
+}
+
+// WriteDumpPlan writes plan as JSON to path.
+func WriteDumpPlan(plan DumpPlan, path string) error {
+	b, err := json.MarshalIndent(plan, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// formatCommand formats command line arguments as they could be typed in a
+// POSIX shell, quoting arguments as needed.
+func formatCommand(args []string) string {
+	s := make([]string, len(args))
+	for i, arg := range args {
+		s[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'`$\\|&;<>()*?[]{}!#~") {
+			s[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestIsDiscoveryCommand(t *testing.T) {
+	tests := []struct {
+		args   []string
+		stdout bool
+		want   bool
+	}{
+		{[]string{"oc", "get", "pods", "-o=json"}, true, true},
+		{[]string{"oc", "-n", "project", "get", "dc", "-o=jsonpath={.items[*].metadata.name}"}, true, true},
+		// Commands with output written only to disk are not needed to
+		// find what to collect.
+		{[]string{"oc", "-n", "project", "get", "pods", "-o=json"}, false, false},
+		{[]string{"oc", "-n", "project", "exec", "mongodb-1", "--", "mongo", "--eval", "rs.status()"}, true, false},
+		{[]string{"oc", "-n", "project", "logs", "pod/mongodb-1"}, true, false},
+		{[]string{"oc", "adm", "diagnostics"}, true, false},
+		{[]string{"ls", "get"}, true, false},
+	}
+	for _, tt := range tests {
+		cmd := exec.Command(tt.args[0], tt.args[1:]...)
+		if tt.stdout {
+			cmd.Stdout = &bytes.Buffer{}
+		}
+		if got := isDiscoveryCommand(cmd); got != tt.want {
+			t.Errorf("isDiscoveryCommand(%q, stdout=%v) = %v, want %v", tt.args, tt.stdout, got, tt.want)
+		}
+	}
+}
+
+func TestDryRunRunner(t *testing.T) {
+	r := &dryRunRunner{}
+
+	// Commands other than discovery commands are not run.
+	cmd := exec.Command("oc", "-n", "project", "exec", "mongodb-1", "--", "mongo")
+	cmd.Stdout = &bytes.Buffer{}
+	if err := r.Run(cmd, "projects/project/mongodb/mongodb-1.json"); err != nil {
+		t.Errorf("Run(%q) = %v, want nil", cmd.Args, err)
+	}
+	if cmd.ProcessState != nil {
+		t.Errorf("Run(%q) ran the command", cmd.Args)
+	}
+
+	// Discovery commands are run.
+	cmd = exec.Command("oc-does-not-exist", "get", "projects")
+	cmd.Args[0] = "oc"
+	cmd.Stdout = &bytes.Buffer{}
+	err := r.Run(cmd, "")
+	if _, ok := err.(*CommandError); !ok {
+		t.Errorf("Run(%q) = %v, want *CommandError", cmd.Args, err)
+	}
+
+	want := []PlannedCommand{
+		{Command: []string{"oc", "-n", "project", "exec", "mongodb-1", "--", "mongo"}, Output: "projects/project/mongodb/mongodb-1.json"},
+		{Command: []string{"oc", "get", "projects"}, Discovery: true},
+	}
+	if !reflect.DeepEqual(r.commands, want) {
+		t.Errorf("commands = %v, want %v", r.commands, want)
+	}
+}
+
+func TestFormatCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"oc", "get", "pods"}, "oc get pods"},
+		{[]string{"oc", "get", "dc", "-o=jsonpath={.items[*].metadata.name}"}, "oc get dc '-o=jsonpath={.items[*].metadata.name}'"},
+		{[]string{"sh", "-c", "echo $HOME"}, "sh -c 'echo $HOME'"},
+		{[]string{"echo", "it's"}, `echo 'it'\''s'`},
+		{[]string{"echo", ""}, "echo ''"},
+	}
+	for _, tt := range tests {
+		if got := formatCommand(tt.args); got != tt.want {
+			t.Errorf("formatCommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestPrintDumpPlan(t *testing.T) {
+	plan := DumpPlan{
+		Projects: []string{"core", "mbaas"},
+		Discovery: []PlannedCommand{
+			{Command: []string{"oc", "get", "projects", "-o=jsonpath={.items[*].metadata.name}"}, Discovery: true},
+		},
+		Collectors: []CollectorPlan{
+			{
+				Collector: "definitions",
+				Commands: []PlannedCommand{
+					{Command: []string{"oc", "-n", "core", "get", "pods", "-o=json"}, Output: "projects/core/definitions/pods.json"},
+				},
+			},
+		},
+	}
+	var b bytes.Buffer
+	PrintDumpPlan(plan, &b)
+	want := `Projects: core, mbaas
+Discovery:
+  oc get projects '-o=jsonpath={.items[*].metadata.name}' (discovery)
+Collector definitions:
+  oc -n core get pods -o=json > projects/core/definitions/pods.json
+`
+	if got := b.String(); got != want {
+		t.Errorf("PrintDumpPlan() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OpenDump makes the dump at path available as a directory for reading. Path
+// may be the root directory of an extracted dump, a parent directory of it, or
+// a .tar.gz archive created by the dump tool, or the manifest or a volume of a
+// split archive, which are extracted to a temporary directory. The returned
+// cleanup function removes any temporary files and must be called when the
+// dump is no longer needed.
+func OpenDump(path string) (dir string, cleanup func(), err error) {
+	cleanup = func() {}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", cleanup, err
+	}
+	if !fi.IsDir() {
+		tmp, err := ioutil.TempDir("", "fh-system-dump-tool-")
+		if err != nil {
+			return "", cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(tmp) }
+		if err := extractArchive(path, tmp); err != nil {
+			cleanup()
+			return "", func() {}, fmt.Errorf("%s: %v", path, err)
+		}
+		path = tmp
+	}
+	dir, err = findDumpRoot(path)
+	if err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return dir, cleanup, nil
+}
+
+// errDumpRootFound is used to stop walking a directory tree.
+var errDumpRootFound = errors.New("dump root found")
+
+// findDumpRoot returns the first directory under path that looks like the root
+// of a dump, i.e., it contains the version file written by the dump tool.
+func findDumpRoot(path string) (string, error) {
+	var root string
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && fi.Name() == "version" {
+			root = filepath.Dir(p)
+			return errDumpRootFound
+		}
+		return nil
+	})
+	if err == errDumpRootFound {
+		return root, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s does not contain a system dump", path)
+}
+
+// extractArchive extracts the tar.gz file at path, or the split archive it is
+// a manifest or volume of, into dir.
+func extractArchive(path, dir string) error {
+	var f io.ReadCloser
+	var err error
+	if manifest, ok := splitManifestPath(path); ok {
+		f, err = openVolumes(manifest)
+	} else {
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if magic, _ := r.Peek(len(encryptMagic)); string(magic) == encryptMagic {
+		return errors.New("archive is encrypted, decrypt it first with fh-system-dump-tool decrypt")
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	if err := extractTar(gz, dir); err != nil {
+		return err
+	}
+	// Read to the end, so that checksums of volumes are checked.
+	_, err = io.Copy(ioutil.Discard, r)
+	return err
+}
+
+// extractTar extracts regular files and directories from a tar stream into
+// dir. Entries with paths pointing outside of dir are rejected.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0770); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0770); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0660)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
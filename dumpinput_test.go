@@ -0,0 +1,84 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTarGz writes a tar.gz archive to path with the given files, keyed by
+// name within the archive.
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		hdr := &tar.Header{Name: name, Mode: 0660, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenDumpArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-opendump-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dump.tar.gz")
+	writeTarGz(t, path, map[string]string{
+		"rhmap-dumps/2017-03-01T10-00-00Z/version":       "RHMAP fh-system-dump-tool test\n",
+		"rhmap-dumps/2017-03-01T10-00-00Z/analysis.json": "{}",
+	})
+
+	root, cleanup, err := OpenDump(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := filepath.Base(root), "2017-03-01T10-00-00Z"; got != want {
+		t.Errorf("root = %q, want base name %q", root, want)
+	}
+	if _, err := os.Stat(filepath.Join(root, "analysis.json")); err != nil {
+		t.Error(err)
+	}
+	cleanup()
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Errorf("cleanup() did not remove %s", root)
+	}
+}
+
+func TestOpenDumpInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-opendump-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, _, err := OpenDump(dir); err == nil {
+		t.Error("OpenDump(empty directory) error = nil, want error")
+	}
+
+	path := filepath.Join(dir, "evil.tar.gz")
+	writeTarGz(t, path, map[string]string{"../../evil": "x"})
+	if _, _, err := OpenDump(path); err == nil {
+		t.Error("OpenDump(archive with path outside of dir) error = nil, want error")
+	}
+}
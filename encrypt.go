@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// RecipientKey is the public key dumps are encrypted to with -encrypt, as PEM
+// or base64-encoded DER, injected at build time. It is usually the key of the
+// support team.
+var RecipientKey = ""
+
+// Encrypted archives start with encryptMagic and a version byte, followed by
+// the length of the wrapped key as a big-endian uint16 and the key, a random
+// AES-256 key encrypted with RSA-OAEP. The rest of the file is a sequence of
+// chunks, each a big-endian uint32 length followed by up to encryptChunkSize
+// bytes of data sealed with AES-GCM. Nonces are chunk counters, and the last
+// chunk is authenticated as such, so that truncation is detected.
+const (
+	encryptMagic     = "FHSDTENC"
+	encryptVersion   = 1
+	encryptChunkSize = 64 * 1024
+	// encryptExt is the extension of encrypted archives.
+	encryptExt = ".enc"
+)
+
+// encryptLabel is the RSA-OAEP label of wrapped keys.
+var encryptLabel = []byte("fh-system-dump-tool")
+
+// ParsePublicKey parses an RSA public key in PKIX format, either PEM-encoded or
+// base64-encoded DER, as written by openssl rsa -pubout.
+func ParsePublicKey(b []byte) (*rsa.PublicKey, error) {
+	der, err := decodeKey(b)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T, must be RSA", key)
+	}
+	return rsaKey, nil
+}
+
+// ParsePrivateKey parses an RSA private key, either PEM-encoded or
+// base64-encoded DER, in PKCS #1 or PKCS #8 format.
+func ParsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	der, err := decodeKey(b)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T, must be RSA", key)
+	}
+	return rsaKey, nil
+}
+
+// decodeKey returns the DER bytes of a PEM-encoded or base64-encoded key.
+func decodeKey(b []byte) ([]byte, error) {
+	if block, _ := pem.Decode(b); block != nil {
+		if block.Headers["Proc-Type"] != "" {
+			return nil, errors.New("encrypted PEM keys are not supported")
+		}
+		return block.Bytes, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, errors.New("key is neither PEM nor base64-encoded")
+	}
+	return der, nil
+}
+
+// encryptWriter is an io.WriteCloser that encrypts data in chunks.
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	count uint64
+	err   error
+}
+
+// NewEncryptWriter returns a writer that encrypts data written to it to pub,
+// writing the encrypted data to w. Close must be called to write the last
+// chunk; it does not close w.
+func NewEncryptWriter(w io.Writer, pub *rsa.PublicKey) (io.WriteCloser, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, encryptLabel)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newChunkAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(encryptMagic), encryptVersion, 0, 0)
+	binary.BigEndian.PutUint16(header[len(header)-2:], uint16(len(wrapped)))
+	if _, err := w.Write(append(header, wrapped...)); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, encryptChunkSize)}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only written once more data arrives, since
+		// the last chunk must be marked as such.
+		if len(w.buf) == encryptChunkSize {
+			if w.err = w.writeChunk(false); w.err != nil {
+				return n, w.err
+			}
+		}
+		m := copy(w.buf[len(w.buf):encryptChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close writes the last chunk.
+func (w *encryptWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.writeChunk(true)
+	if w.err == nil {
+		w.err = errors.New("write to closed encryptWriter")
+		return nil
+	}
+	return w.err
+}
+
+// writeChunk seals and writes the buffered data.
+func (w *encryptWriter) writeChunk(last bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.aead, w.count), w.buf, chunkAdditionalData(last))
+	w.count++
+	w.buf = w.buf[:0]
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := w.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+// decryptReader is an io.Reader that decrypts data in chunks.
+type decryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	count uint64
+	done  bool
+}
+
+// NewDecryptReader returns a reader that decrypts the data in r, encrypted by
+// an encryptWriter to the public key of priv. Reading returns an error if the
+// data was modified or truncated.
+func NewDecryptReader(r io.Reader, priv *rsa.PrivateKey) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(encryptMagic)+3)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(encryptMagic)]) != encryptMagic {
+		return nil, errors.New("not an encrypted dump archive")
+	}
+	if v := header[len(encryptMagic)]; v != encryptVersion {
+		return nil, fmt.Errorf("unsupported encryption format version %d", v)
+	}
+	wrapped := make([]byte, binary.BigEndian.Uint16(header[len(header)-2:]))
+	if _, err := io.ReadFull(br, wrapped); err != nil {
+		return nil, errors.New("truncated encrypted dump archive")
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, wrapped, encryptLabel)
+	if err != nil {
+		return nil, errors.New("could not decrypt the archive key, was the archive encrypted to another key?")
+	}
+	aead, err := newChunkAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: br, aead: aead}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// readChunk reads and opens the next chunk.
+func (r *decryptReader) readChunk() error {
+	var length [4]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errors.New("truncated encrypted dump archive")
+		}
+		return err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > encryptChunkSize+uint32(r.aead.Overhead()) {
+		return errors.New("corrupt encrypted dump archive")
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		return errors.New("truncated encrypted dump archive")
+	}
+	nonce := chunkNonce(r.aead, r.count)
+	r.count++
+	// Try the chunk as an intermediate chunk first, then as the last.
+	if b, err := r.aead.Open(sealed[:0:0], nonce, sealed, chunkAdditionalData(false)); err == nil {
+		r.buf = b
+		return nil
+	}
+	b, err := r.aead.Open(sealed[:0:0], nonce, sealed, chunkAdditionalData(true))
+	if err != nil {
+		return errors.New("corrupt encrypted dump archive")
+	}
+	if _, err := r.r.Peek(1); err != io.EOF {
+		return errors.New("corrupt encrypted dump archive: data after last chunk")
+	}
+	r.buf = b
+	r.done = true
+	return nil
+}
+
+// newChunkAEAD returns the AES-GCM cipher used to seal chunks.
+func newChunkAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of the chunk with the given counter. Keys are
+// never reused, so counters are unique nonces.
+func chunkNonce(aead cipher.AEAD, count uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], count)
+	return nonce
+}
+
+// chunkAdditionalData returns the additional authenticated data of a chunk,
+// telling whether it is the last one.
+func chunkAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// loadRecipientKey returns the public key to encrypt dumps to: the key in the
+// file at path if not empty, or else the key embedded at build time.
+func loadRecipientKey(path string) (*rsa.PublicKey, error) {
+	if path == "" {
+		if RecipientKey == "" {
+			return nil, errors.New("no recipient key was embedded at build time, use -encrypt-to to give one")
+		}
+		return ParsePublicKey([]byte(RecipientKey))
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+// decryptCommand implements the decrypt subcommand, that decrypts an encrypted
+// dump archive.
+func decryptCommand(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	keyPath := fs.String("key", "", "file with the RSA private key of the recipient, in PEM format (required)")
+	output := fs.String("o", "", "write the decrypted archive to this file, - for stdout (default the archive name without "+encryptExt+")")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fh-system-dump-tool decrypt -key=<private key> [flags] <archive>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Decrypts a dump archive encrypted with -encrypt or -encrypt-to.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *keyPath == "" {
+		fs.Usage()
+		return errors.New("decrypt requires a private key and exactly one archive")
+	}
+	path := fs.Arg(0)
+	out := *output
+	if out == "" {
+		if !strings.HasSuffix(path, encryptExt) {
+			return fmt.Errorf("%s does not end with %s, use -o to name the decrypted archive", path, encryptExt)
+		}
+		out = strings.TrimSuffix(path, encryptExt)
+	}
+
+	b, err := ioutil.ReadFile(*keyPath)
+	if err != nil {
+		return err
+	}
+	key, err := ParsePrivateKey(b)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *keyPath, err)
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := NewDecryptReader(in, key)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if out == "-" {
+		if _, err := io.Copy(os.Stdout, r); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return nil
+	}
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// Do not leave behind partially decrypted data that was not
+		// authenticated.
+		os.Remove(out)
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
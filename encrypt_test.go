@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKey is generated once, since generating RSA keys is slow.
+var testKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func encryptBytes(t *testing.T, data []byte, pub *rsa.PublicKey) []byte {
+	var b bytes.Buffer
+	w, err := NewEncryptWriter(&b, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in odd-sized pieces to cross chunk boundaries.
+	for len(data) > 0 {
+		n := 1000
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func decryptBytes(data []byte, priv *rsa.PrivateKey) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(data), priv)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, encryptChunkSize - 1, encryptChunkSize, encryptChunkSize + 1, 3*encryptChunkSize + 17} {
+		data := make([]byte, size)
+		rand.Read(data)
+		encrypted := encryptBytes(t, data, &testKey.PublicKey)
+		// Short random data may appear in the ciphertext by chance.
+		if size >= 16 && bytes.Contains(encrypted, data) {
+			t.Errorf("size %d: encrypted data contains plaintext", size)
+		}
+		got, err := decryptBytes(encrypted, testKey)
+		if err != nil {
+			t.Errorf("size %d: decrypt error = %v", size, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("size %d: decrypted data differs", size)
+		}
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	data := bytes.Repeat([]byte("secret "), 2*encryptChunkSize/7)
+	encrypted := encryptBytes(t, data, &testKey.PublicKey)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)/2] ^= 1
+
+	tests := []struct {
+		name    string
+		data    []byte
+		key     *rsa.PrivateKey
+		wantErr string
+	}{
+		{"not encrypted", []byte("plain text"), testKey, "not an encrypted dump archive"},
+		{"other key", encrypted, otherKey, "encrypted to another key"},
+		{"tampered", tampered, testKey, "corrupt"},
+		// Cut at a chunk boundary, after the first chunk.
+		{"truncated", encrypted[:len(encrypted)-(len(data)-encryptChunkSize)-16-4], testKey, "truncated"},
+		{"truncated in chunk", encrypted[:len(encrypted)-10], testKey, "truncated"},
+		{"trailing data", append(append([]byte(nil), encrypted...), 0), testKey, "data after last chunk"},
+	}
+	for _, tt := range tests {
+		_, err := decryptBytes(tt.data, tt.key)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: decrypt error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	pubDER, err := x509.MarshalPKIXPublicKey(&testKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range [][]byte{
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+		[]byte(base64.StdEncoding.EncodeToString(pubDER) + "\n"),
+	} {
+		key, err := ParsePublicKey(b)
+		if err != nil {
+			t.Errorf("ParsePublicKey(%q) error = %v", b, err)
+			continue
+		}
+		if key.N.Cmp(testKey.N) != 0 {
+			t.Errorf("ParsePublicKey(%q) returned another key", b)
+		}
+	}
+	if _, err := ParsePublicKey([]byte("not a key")); err == nil {
+		t.Error("ParsePublicKey(invalid) returned no error")
+	}
+
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testKey)})
+	key, err := ParsePrivateKey(privPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.D.Cmp(testKey.D) != 0 {
+		t.Error("ParsePrivateKey() returned another key")
+	}
+}
+
+func TestDecryptCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-decrypt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Encrypt a dump archive, and check that it can be decrypted and
+	// opened.
+	dump := filepath.Join(dir, "dump")
+	if err := os.Mkdir(dump, 0770); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dump, "version"), []byte("v1\n"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := dump + ".tar.gz" + encryptExt
+	if _, err := archive(dump, archivePath, &testKey.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenDump(archivePath); err == nil || !strings.Contains(err.Error(), "archive is encrypted") {
+		t.Errorf("OpenDump(encrypted archive) error = %v, want archive is encrypted", err)
+	}
+
+	keyPath := filepath.Join(dir, "key.pem")
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testKey)})
+	if err := ioutil.WriteFile(keyPath, privPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := decryptCommand([]string{"-key", keyPath, archivePath}); err != nil {
+		t.Fatal(err)
+	}
+	opened, cleanup, err := OpenDump(dump + ".tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if err := dirHasExactFiles(opened, []string{"version"}, []string{"v1\n"}); err != nil {
+		t.Error(err)
+	}
+
+	// The decrypted archive is not overwritten.
+	if err := decryptCommand([]string{"-key", keyPath, archivePath}); err == nil {
+		t.Error("decryptCommand() overwrote the decrypted archive")
+	}
+}
@@ -1,5 +1,14 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+)
+
 // IgnorableError is an error that has an extra method to tell whether it should
 // be ignored. Ignored errors may be omitted from standard program output.
 type IgnorableError interface {
@@ -36,3 +45,292 @@ func MarkErrorAsIgnorable(err error) error {
 	}
 	return &ignoredError{err}
 }
+
+// MultiError holds the errors of a task that fails in several independent
+// ways, such as the checks of a project. They are reported individually.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// flattenErrors returns err as a list of errors, unpacking a MultiError.
+func flattenErrors(err error) []error {
+	if errs, ok := err.(MultiError); ok {
+		return errs
+	}
+	return []error{err}
+}
+
+// CommandError is returned by a DumpRunner when a command fails.
+type CommandError struct {
+	Args []string
+	// Path is where the output of the command was written, relative to
+	// the dump directory.
+	Path   string
+	Err    error
+	Stderr string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command %q: %s: %s", strings.Join(e.Args, " "), e.Err, e.Stderr)
+}
+
+// TaskError is the error of a task, identifying what the task was doing.
+type TaskError struct {
+	// Collector is the name of the collector that generated the task, if
+	// any.
+	Collector string
+	// Check is the ID of the analysis check that failed, if any.
+	Check   string
+	Project string
+	// Resource is what the task was about, e.g. pods or
+	// pods/mongodb-1-abcde, container mongodb.
+	Resource string
+	// Command is the command that failed, if any.
+	Command []string
+	// Path is where the output of the command was written, if any.
+	Path string
+	Err  error
+}
+
+func (e *TaskError) Error() string {
+	var what []string
+	if e.Check != "" {
+		what = append(what, "check "+e.Check)
+	}
+	if e.Collector != "" {
+		what = append(what, "collector "+e.Collector)
+	}
+	if e.Project != "" {
+		what = append(what, "in project "+e.Project)
+	}
+	if e.Resource != "" {
+		what = append(what, "for "+e.Resource)
+	}
+	if len(what) == 0 {
+		return e.Err.Error()
+	}
+	return strings.Join(what, " ") + ": " + e.Err.Error()
+}
+
+// Ignore implements IgnorableError, telling whether the underlying error is
+// ignorable.
+func (e *TaskError) Ignore() bool {
+	ierr, ok := e.Err.(IgnorableError)
+	return ok && ierr.Ignore()
+}
+
+// Assert that TaskError implements the IgnorableError interface.
+var _ IgnorableError = (*TaskError)(nil)
+
+// newTaskError attributes err to collector. The project, resource and command
+// are found from the failed command, if any.
+func newTaskError(collector string, err error) *TaskError {
+	if terr, ok := err.(*TaskError); ok {
+		if terr.Collector == "" {
+			terr.Collector = collector
+		}
+		return terr
+	}
+	terr := &TaskError{Collector: collector, Err: err}
+	if cerr := findCommandError(err); cerr != nil {
+		terr.Command = cerr.Args
+		terr.Path = cerr.Path
+		terr.Project, terr.Resource = describeCommand(cerr.Args)
+	}
+	return terr
+}
+
+// findCommandError returns the CommandError wrapped by err, if any.
+func findCommandError(err error) *CommandError {
+	for {
+		switch e := err.(type) {
+		case *CommandError:
+			return e
+		case *ignoredError:
+			err = e.err
+		case *TaskError:
+			err = e.Err
+		default:
+			return nil
+		}
+	}
+}
+
+// describeCommand returns the project and the resource an oc command is
+// about, e.g. core and pods/mongodb-1-abcde, container mongodb for the command
+// oc -n core logs pods/mongodb-1-abcde -c mongodb.
+func describeCommand(args []string) (project, resource string) {
+	project, container, positional := parseOcArgs(args)
+	if len(positional) == 0 {
+		return project, ""
+	}
+	switch positional[0] {
+	case "get", "logs":
+		resource = strings.Join(positional[1:], "/")
+	case "exec":
+		if len(positional) > 1 {
+			resource = "pod/" + positional[1]
+		}
+	default:
+		resource = strings.Join(positional, " ")
+	}
+	if container != "" {
+		resource += ", container " + container
+	}
+	return project, resource
+}
+
+// parseOcArgs returns the project, the container and the positional arguments
+// of an oc command, e.g. logs and pods/mongodb-1-abcde. Arguments of the
+// command run by oc exec are ignored.
+func parseOcArgs(args []string) (project, container string, positional []string) {
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+		switch arg {
+		case "-n", "--namespace", "-c", "--container", "--tail":
+			// Flags with a separate value.
+			if i+1 < len(args) {
+				i++
+				if arg == "-n" || arg == "--namespace" {
+					project = args[i]
+				}
+				if arg == "-c" || arg == "--container" {
+					container = args[i]
+				}
+			}
+		}
+	}
+	return project, container, positional
+}
+
+// An ErrorGroup lists the task errors of a collector or analysis check in a
+// project. Errors of cluster-scoped tasks have no project.
+type ErrorGroup struct {
+	Collector string        `json:"collector,omitempty"`
+	Check     string        `json:"check,omitempty"`
+	Project   string        `json:"project,omitempty"`
+	Errors    []ErrorRecord `json:"errors"`
+}
+
+// An ErrorRecord describes a task error.
+type ErrorRecord struct {
+	Resource string   `json:"resource,omitempty"`
+	Command  []string `json:"command,omitempty"`
+	// Output is the path to the output of the command within the dump.
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error"`
+	Ignorable bool   `json:"ignorable"`
+}
+
+// Ignorable counts the ignorable errors in g.
+func (g ErrorGroup) Ignorable() int {
+	n := 0
+	for _, e := range g.Errors {
+		if e.Ignorable {
+			n++
+		}
+	}
+	return n
+}
+
+// Source describes the tasks whose errors are in g, e.g. "collector logs,
+// project core".
+func (g ErrorGroup) Source() string {
+	var what []string
+	if g.Collector != "" {
+		what = append(what, "collector "+g.Collector)
+	}
+	if g.Check != "" {
+		what = append(what, "check "+g.Check)
+	}
+	if g.Project != "" {
+		what = append(what, "project "+g.Project)
+	}
+	if len(what) == 0 {
+		return "other tasks"
+	}
+	return strings.Join(what, ", ")
+}
+
+// byAttribution sorts error groups by collector, check and project.
+type byAttribution []ErrorGroup
+
+func (s byAttribution) Len() int      { return len(s) }
+func (s byAttribution) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byAttribution) Less(i, j int) bool {
+	a, b := s[i], s[j]
+	if a.Collector != b.Collector {
+		return a.Collector < b.Collector
+	}
+	if a.Check != b.Check {
+		return a.Check < b.Check
+	}
+	return a.Project < b.Project
+}
+
+// GroupErrors groups task errors by collector or check and project, sorted by
+// collector, check and project.
+func GroupErrors(errs []error) []ErrorGroup {
+	var groups []ErrorGroup
+	index := make(map[[3]string]int)
+	for _, err := range errs {
+		terr := newTaskError("", err)
+		key := [3]string{terr.Collector, terr.Check, terr.Project}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, ErrorGroup{Collector: terr.Collector, Check: terr.Check, Project: terr.Project})
+		}
+		// Attribution is already in the group, only the underlying
+		// error is described.
+		groups[i].Errors = append(groups[i].Errors, ErrorRecord{
+			Resource:  terr.Resource,
+			Command:   terr.Command,
+			Output:    terr.Path,
+			Error:     terr.Err.Error(),
+			Ignorable: terr.Ignore(),
+		})
+	}
+	sort.Stable(byAttribution(groups))
+	return groups
+}
+
+// WriteErrorReport writes the groups of task errors as JSON to path.
+func WriteErrorReport(groups []ErrorGroup, path string) error {
+	if groups == nil {
+		groups = []ErrorGroup{}
+	}
+	b, err := json.MarshalIndent(groups, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0660)
+}
+
+// LogErrorSummary logs the number of errors in each group. Groups with only
+// ignorable errors are only logged to fileOnlyLogger, unless debugging is
+// enabled.
+func LogErrorSummary(groups []ErrorGroup, fileOnlyLogger Logger) {
+	for _, g := range groups {
+		msg := fmt.Sprintf("%d errors in %s (%d ignorable), details in errors.json", len(g.Errors), g.Source(), g.Ignorable())
+		if !showAllErrors && g.Ignorable() == len(g.Errors) {
+			fileOnlyLogger.Printf("%s", msg)
+			continue
+		}
+		log.Print(msg)
+	}
+}
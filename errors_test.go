@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDescribeCommand(t *testing.T) {
+	tests := []struct {
+		args              []string
+		project, resource string
+	}{
+		{
+			args:     []string{"oc", "get", "nodes", "-o=json"},
+			resource: "nodes",
+		},
+		{
+			args:    []string{"oc", "-n", "core", "get", "pod", "mongodb-1-abcde", "-o=json"},
+			project: "core", resource: "pod/mongodb-1-abcde",
+		},
+		{
+			args:    []string{"oc", "-n", "core", "logs", "pods/mongodb-1-abcde", "-c", "mongodb", "--tail", "1000", "--timestamps", "--previous"},
+			project: "core", resource: "pods/mongodb-1-abcde, container mongodb",
+		},
+		{
+			args:    []string{"oc", "-n", "core", "exec", "redis-1-abcde", "--", "redis-cli", "INFO"},
+			project: "core", resource: "pod/redis-1-abcde",
+		},
+		{
+			args:     []string{"oc", "adm", "diagnostics"},
+			resource: "adm diagnostics",
+		},
+	}
+	for _, tt := range tests {
+		project, resource := describeCommand(tt.args)
+		if project != tt.project || resource != tt.resource {
+			t.Errorf("describeCommand(%q) = %q, %q, want %q, %q", tt.args, project, resource, tt.project, tt.resource)
+		}
+	}
+}
+
+func TestNewTaskError(t *testing.T) {
+	cerr := &CommandError{
+		Args:   []string{"oc", "-n", "core", "exec", "redis-1-abcde", "--", "redis-cli", "INFO"},
+		Path:   "projects/core/redis/redis-1-abcde_info",
+		Err:    errors.New("exit status 1"),
+		Stderr: "connection refused",
+	}
+	terr := newTaskError("redis", MarkErrorAsIgnorable(cerr))
+	want := `collector redis in project core for pod/redis-1-abcde: command "oc -n core exec redis-1-abcde -- redis-cli INFO": exit status 1: connection refused`
+	if got := terr.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !terr.Ignore() {
+		t.Errorf("Ignore() = false, want true")
+	}
+	if !reflect.DeepEqual(terr.Command, cerr.Args) || terr.Path != cerr.Path {
+		t.Errorf("Command, Path = %q, %q, want %q, %q", terr.Command, terr.Path, cerr.Args, cerr.Path)
+	}
+
+	// Errors of analysis checks are already attributed.
+	checkErr := &TaskError{Check: "events", Project: "core", Err: errors.New("invalid JSON")}
+	if got := newTaskError("", checkErr); got != checkErr {
+		t.Errorf("newTaskError(\"\", %v) = %v, want the same error", checkErr, got)
+	}
+	if got, want := checkErr.Error(), "check events in project core: invalid JSON"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if checkErr.Ignore() {
+		t.Errorf("Ignore() = true, want false")
+	}
+}
+
+func TestGroupErrors(t *testing.T) {
+	errs := []error{
+		newTaskError("logs", MarkErrorAsIgnorable(&CommandError{
+			Args: []string{"oc", "-n", "core", "logs", "pods/a", "-c", "c", "--previous"},
+			Path: "projects/core/logs-previous/pods_a_c.logs",
+			Err:  errors.New("exit status 1"),
+		})),
+		&TaskError{Check: "events", Project: "core", Err: errors.New("invalid JSON")},
+		newTaskError("definitions", errors.New("failed")),
+		newTaskError("logs", errors.New("no pods")),
+	}
+	want := []ErrorGroup{
+		{Check: "events", Project: "core", Errors: []ErrorRecord{
+			{Error: "invalid JSON"},
+		}},
+		{Collector: "definitions", Errors: []ErrorRecord{
+			{Error: "failed"},
+		}},
+		{Collector: "logs", Errors: []ErrorRecord{
+			{Error: "no pods"},
+		}},
+		{Collector: "logs", Project: "core", Errors: []ErrorRecord{
+			{
+				Resource:  "pods/a, container c",
+				Command:   []string{"oc", "-n", "core", "logs", "pods/a", "-c", "c", "--previous"},
+				Output:    "projects/core/logs-previous/pods_a_c.logs",
+				Error:     `command "oc -n core logs pods/a -c c --previous": exit status 1: `,
+				Ignorable: true,
+			},
+		}},
+	}
+	if got := GroupErrors(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupErrors(...) = %+v, want %+v", got, want)
+	}
+}
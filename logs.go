@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+
+	"github.com/feedhenry/fh-system-dump-tool/openshift/api/types"
 )
 
 // LoggableResource describes an OpenShift resource that produces logs. Even
@@ -76,16 +79,28 @@ func getFetchLogsTasksPerResource(tasks chan<- Task, runner Runner, project, rty
 }
 
 // GetPodContainers returns a list of container names for the named pod in the
-// project.
+// project. Init containers come first, in the order they run, followed by the
+// regular containers. The pod definition, including the status of all of its
+// containers, is saved as a side effect.
 func GetPodContainers(runner Runner, project, name string) ([]string, error) {
-	cmd := exec.Command("oc", "-n", project, "get", "pod", name, "-o=jsonpath={.spec.containers[*].name}")
+	cmd := exec.Command("oc", "-n", project, "get", "pod", name, "-o=json")
 	var b bytes.Buffer
 	cmd.Stdout = &b
-	if err := runner.Run(cmd, filepath.Join("projects", project, "pods", name, "container-names")); err != nil {
+	if err := runner.Run(cmd, filepath.Join("projects", project, "pods", name, "definition.json")); err != nil {
 		return nil, err
 	}
-	names, err := readSpaceSeparated(&b)
-	return names, MarkErrorAsIgnorable(err)
+	var pod types.Pod
+	if err := json.NewDecoder(&b).Decode(&pod); err != nil {
+		return nil, MarkErrorAsIgnorable(err)
+	}
+	var names []string
+	for _, c := range pod.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	for _, c := range pod.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	return names, nil
 }
 
 // FetchLogs is a task factory for tasks that fetch the logs of a
@@ -112,7 +127,9 @@ func ocLogs(r Runner, resource LoggableResource, maxLines int, extraArgs []strin
 			"-n", resource.Project,
 			"logs", name,
 			"-c", resource.Container,
-			"--tail", strconv.Itoa(maxLines)},
+			"--tail", strconv.Itoa(maxLines),
+			// Timestamps allow merging logs into the timeline.
+			"--timestamps"},
 			extraArgs...)...)
 		filename := resource.Name
 		if resource.Type != "" {
@@ -55,11 +55,11 @@ func TestGetFetchLogsTasks(t *testing.T) {
 			return nil
 		},
 		"get pod pod-1": func(cmd *exec.Cmd, path string) error {
-			fmt.Fprintln(cmd.Stdout, "c11", "c12")
+			fmt.Fprintln(cmd.Stdout, `{"spec": {"initContainers": [{"name": "i11"}], "containers": [{"name": "c11"}, {"name": "c12"}]}}`)
 			return nil
 		},
 		"get pod pod-2": func(cmd *exec.Cmd, path string) error {
-			fmt.Fprintln(cmd.Stdout, "c21")
+			fmt.Fprintln(cmd.Stdout, `{"spec": {"containers": [{"name": "c21"}]}}`)
 			return nil
 		},
 		"logs pods/pod-": func(cmd *exec.Cmd, path string) error {
@@ -83,15 +83,17 @@ func TestGetFetchLogsTasks(t *testing.T) {
 	}
 
 	calls := map[string]struct{}{
-		"oc -n test-project get pods -o=jsonpath={.items[*].metadata.name}":       {},
-		"oc -n test-project get pod pod-1 -o=jsonpath={.spec.containers[*].name}": {},
-		"oc -n test-project get pod pod-2 -o=jsonpath={.spec.containers[*].name}": {},
-		"oc -n test-project logs pods/pod-1 -c c11 --tail 42":                     {},
-		"oc -n test-project logs pods/pod-1 -c c11 --tail 42 --previous":          {},
-		"oc -n test-project logs pods/pod-1 -c c12 --tail 42":                     {},
-		"oc -n test-project logs pods/pod-1 -c c12 --tail 42 --previous":          {},
-		"oc -n test-project logs pods/pod-2 -c c21 --tail 42":                     {},
-		"oc -n test-project logs pods/pod-2 -c c21 --tail 42 --previous":          {},
+		"oc -n test-project get pods -o=jsonpath={.items[*].metadata.name}":           {},
+		"oc -n test-project get pod pod-1 -o=json":                                    {},
+		"oc -n test-project get pod pod-2 -o=json":                                    {},
+		"oc -n test-project logs pods/pod-1 -c i11 --tail 42 --timestamps":            {},
+		"oc -n test-project logs pods/pod-1 -c i11 --tail 42 --timestamps --previous": {},
+		"oc -n test-project logs pods/pod-1 -c c11 --tail 42 --timestamps":            {},
+		"oc -n test-project logs pods/pod-1 -c c11 --tail 42 --timestamps --previous": {},
+		"oc -n test-project logs pods/pod-1 -c c12 --tail 42 --timestamps":            {},
+		"oc -n test-project logs pods/pod-1 -c c12 --tail 42 --timestamps --previous": {},
+		"oc -n test-project logs pods/pod-2 -c c21 --tail 42 --timestamps":            {},
+		"oc -n test-project logs pods/pod-2 -c c21 --tail 42 --timestamps --previous": {},
 	}
 	if !reflect.DeepEqual(runner.Seen, calls) {
 		t.Errorf("runner.Calls = %q, want %q", runner.Seen, calls)
@@ -4,6 +4,8 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/rsa"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -18,8 +20,8 @@ import (
 )
 
 const (
-	// dumpDir is a path to the base directory where the output of the tool
-	// goes.
+	// dumpDir is the default path to the base directory where the output
+	// of the tool goes.
 	dumpDir = "rhmap-dumps"
 	// dumpTimestampFormat is a layout for use with Time.Format. Used to
 	// create directories with a timestamp. Based on time.RFC3339.
@@ -33,8 +35,56 @@ var (
 	concurrentTasks = flag.Int("p", runtime.NumCPU(), "number of tasks to run concurrently")
 	maxLogLines     = flag.Int("max-log-lines", defaultMaxLogLines, "max number of log lines fetched with oc logs")
 	printVersion    = flag.Bool("version", false, "print version and exit")
+	collectorNames  = flag.String("collectors", "", "comma-separated list of collectors to run (default all)")
+	skipCollectors  = flag.String("skip-collectors", "", "comma-separated list of collectors not to run")
+	listCollectors  = flag.Bool("list-collectors", false, "print available collectors and exit")
+	checkIDs        = flag.String("checks", "", "comma-separated list of IDs of analysis checks to run (default all)")
+	skipChecks      = flag.String("skip-checks", "", "comma-separated list of IDs of analysis checks not to run")
+	listChecks      = flag.Bool("list-checks", false, "print available analysis checks and exit")
+	rulesDir        = flag.String("rules-dir", "", "directory with additional analysis rules in JSON files")
+	minSeverity     = flag.String("min-severity", string(SeverityInfo), "only report issues of this severity or higher: info, warning or critical")
+	interval        = flag.Duration("interval", 0, "take snapshots of pods, events, nodes and Nagios status this often before the full dump, e.g. 30s (default no snapshots)")
+	snapshotCount   = flag.Int("count", 10, "number of snapshots to take when -interval is set")
+	maxRetries      = flag.Int("max-retries", DefaultRetryPolicy.MaxRetries, "number of times commands failing with transient errors are retried")
+	retryBackoff    = flag.Duration("retry-backoff", DefaultRetryPolicy.InitialBackoff, "delay before retrying a command, doubled for each retry")
+	qps             = flag.Float64("qps", 10, "max number of commands started per second, 0 for no limit")
+	burst           = flag.Int("burst", 20, "max number of commands started at once when below the -qps limit")
+	maxExec         = flag.Int("max-exec", 4, "max number of concurrent oc exec commands, 0 for no limit")
+	maxLogs         = flag.Int("max-logs", 8, "max number of concurrent oc logs commands, 0 for no limit")
+	maxAdm          = flag.Int("max-adm", 1, "max number of concurrent oc adm commands, 0 for no limit")
+	dryRun          = flag.Bool("dry-run", false, "print the commands that would be run to collect data, running only read-only discovery commands, and exit")
+	dryRunJSON      = flag.String("dry-run-json", "", "like -dry-run, but write the commands as JSON to this file, - for stdout")
+	progressMode    = flag.String("progress", ProgressAuto, "how to report progress on stderr: auto, tty, plain, json or none")
+	configPath      = flag.String("config", "", "JSON configuration file, YAML is not supported; flags given on the command line override its settings")
+	profile         = flag.String("profile", "", "named profile from the configuration file or built-in: quick, full or storage")
+	projectNames    = flag.String("projects", "", "comma-separated list of projects to dump (default all visible)")
+	outputDir       = flag.String("output-dir", dumpDir, "directory where dumps are written")
+	archiveName     = flag.String("archive-name", defaultArchiveName, "name of the dump archive and directory, with variables {timestamp} and {cluster}")
+	keepDir         = flag.Bool("keep-dir", false, "keep the dump directory after archiving it")
+	noArchive       = flag.Bool("no-archive", false, "do not archive the dump directory")
+	encrypt         = flag.Bool("encrypt", false, "encrypt the dump archive to the public key of the support team embedded at build time")
+	encryptTo       = flag.String("encrypt-to", "", "encrypt the dump archive to the RSA public key in this PEM file")
+	archiveOutput   = flag.String("o", "", "write the dump archive to this file instead of -output-dir, - for stdout")
+	commandTimeout  = flag.Duration("command-timeout", 0, "kill commands running longer than this, e.g. 5m (default no limit)")
+	reportFormat    = flag.String("report-format", ReportText, "format of the analysis report: text, json, junit or markdown")
+	reportFile      = flag.String("report-file", "", "write the analysis report to this file instead of stdout")
+	splitSize       = flag.String("split-size", "", "split the dump archive into numbered volumes of at most this size, e.g. 25M, with a manifest")
+	uploadTarget    = flag.String("upload", "", "upload the dump archive to this http, https or s3://bucket/key URL; only s3 uploads are chunked and resumable")
+	uploadOptions   = uploadFlags(flag.CommandLine)
 )
 
+// commands maps the names of subcommands to their implementation. Running the
+// tool without a subcommand creates a new dump.
+var commands = map[string]func(args []string) error{
+	"decrypt":  decryptCommand,
+	"diff":     diffCommand,
+	"join":     joinCommand,
+	"schema":   schemaCommand,
+	"timeline": timelineCommand,
+	"upload":   uploadCommand,
+	"verify":   verifyCommand,
+}
+
 // showAllErrors enables printing of ignorable errors, suitable for debugging.
 // This is intentionally not exposed as a flag, and shall stay intentionally
 // undocumented, used for development only.
@@ -78,13 +128,16 @@ func readSpaceSeparated(r io.Reader) ([]string, error) {
 	return words, nil
 }
 
-// archive archives the target path to a tar.gz file.
-func archive(path string) error {
-	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("tar", "-czf", path+".tar.gz", path)
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	return cmd.Run()
+// logTaskErrors logs errs. Ignorable errors are only written to
+// fileOnlyLogger, unless debugging is enabled.
+func logTaskErrors(errs []error, fileOnlyLogger Logger) {
+	for _, err := range errs {
+		if ierr, ok := err.(IgnorableError); !showAllErrors && ok && ierr.Ignore() {
+			fileOnlyLogger.Printf("Task error: %v", err)
+			continue
+		}
+		log.Printf("Task error: %v", err)
+	}
 }
 
 func checkPrerequisites() error {
@@ -107,21 +160,254 @@ func main() {
 		os.Exit(0)
 	}
 
+	if flag.NArg() > 0 {
+		command, ok := commands[flag.Arg(0)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", flag.Arg(0))
+			os.Exit(2)
+		}
+		if err := command(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	cfg, err := LoadConfig(*configPath, *profile)
+	if err == nil {
+		err = ApplyConfigFlags(flag.CommandLine, cfg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: loading configuration:", err)
+		os.Exit(1)
+	}
+
+	if *listCollectors {
+		PrintCollectors(DefaultCollectors.All(), os.Stdout)
+		os.Exit(0)
+	}
+
+	if *rulesDir != "" {
+		rules, err := LoadRulesDir(*rulesDir)
+		if err == nil {
+			err = RegisterRules(DefaultChecks, rules)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: loading rules:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *listChecks {
+		PrintChecks(DefaultChecks.All(), os.Stdout)
+		os.Exit(0)
+	}
+
 	if !(*concurrentTasks > 0) {
 		fmt.Fprintln(os.Stderr, "Error: argument to -p flag must be greater than 0")
 		os.Exit(1)
 	}
 
+	if *interval != 0 && *interval < time.Second {
+		fmt.Fprintln(os.Stderr, "Error: argument to -interval flag must be at least 1s")
+		os.Exit(1)
+	}
+
+	if !(*snapshotCount > 0) {
+		fmt.Fprintln(os.Stderr, "Error: argument to -count flag must be greater than 0")
+		os.Exit(1)
+	}
+
+	if *archiveOutput != "" && *noArchive {
+		fmt.Fprintln(os.Stderr, "Error: -o cannot be used with -no-archive")
+		os.Exit(1)
+	}
+
+	var recipientKey *rsa.PublicKey
+	if *encrypt || *encryptTo != "" {
+		if *noArchive {
+			fmt.Fprintln(os.Stderr, "Error: -encrypt and -encrypt-to cannot be used with -no-archive")
+			os.Exit(1)
+		}
+		if recipientKey, err = loadRecipientKey(*encryptTo); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: loading recipient key:", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := ValidateReportFormat(*reportFormat); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: argument to -report-format flag:", err)
+		os.Exit(1)
+	}
+
+	var volumeSize int64
+	if *splitSize != "" {
+		if *noArchive || *archiveOutput == "-" {
+			fmt.Fprintln(os.Stderr, "Error: -split-size cannot be used with -no-archive or -o -")
+			os.Exit(1)
+		}
+		if volumeSize, err = ParseSize(*splitSize); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: argument to -split-size flag:", err)
+			os.Exit(1)
+		}
+	}
+
+	var uploader Uploader
+	if *uploadTarget != "" {
+		if *noArchive || *archiveOutput == "-" || volumeSize > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -upload cannot be used with -no-archive, -o - or -split-size")
+			os.Exit(1)
+		}
+		if uploader, err = newUploaderFromEnv(*uploadTarget, *uploadOptions); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	// Check the archive name template before running any commands.
+	if _, err := ExpandArchiveName(*archiveName, map[string]string{"timestamp": "t", "cluster": "c"}); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if *commandTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "Error: argument to -command-timeout flag must not be negative")
+		os.Exit(1)
+	}
+
+	// Flags override the configuration.
+	cfg.Projects = splitList(*projectNames)
+	cfg.MaxLogLines = *maxLogLines
+	cfg.CommandTimeout = Duration(*commandTimeout)
+	redactor, err := NewRedactor(cfg.Redact)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if *maxRetries < 0 || *retryBackoff < 0 {
+		fmt.Fprintln(os.Stderr, "Error: arguments to -max-retries and -retry-backoff flags must not be negative")
+		os.Exit(1)
+	}
+	if *qps < 0 || *burst < 0 || *maxExec < 0 || *maxLogs < 0 || *maxAdm < 0 {
+		fmt.Fprintln(os.Stderr, "Error: arguments to -qps, -burst, -max-exec, -max-logs and -max-adm flags must not be negative")
+		os.Exit(1)
+	}
+	limiter := NewRateLimiter(*qps, *burst, map[string]int{
+		ExecClass: *maxExec,
+		LogsClass: *maxLogs,
+		AdmClass:  *maxAdm,
+	})
+
+	retryPolicy := DefaultRetryPolicy
+	retryPolicy.MaxRetries = *maxRetries
+	retryPolicy.InitialBackoff = *retryBackoff
+
+	progress, err := NewProgressReporter(os.Stderr, *progressMode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	collectors, err := DefaultCollectors.Select(splitList(*collectorNames), splitList(*skipCollectors))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	checks, err := DefaultChecks.Select(splitList(*checkIDs), splitList(*skipChecks))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	severity, err := ParseSeverity(*minSeverity)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
 	if err := checkPrerequisites(); err != nil {
 		log.Fatalln("Error:", err)
 	}
 
+	if *dryRun || *dryRunJSON != "" {
+		if *interval > 0 {
+			collectors = append([]Collector{snapshotCollector}, collectors...)
+		}
+		plan, errs := PlanDump(collectors, cfg)
+		for _, err := range errs {
+			log.Printf("Task error: %v", err)
+		}
+		switch *dryRunJSON {
+		case "":
+			PrintDumpPlan(plan, os.Stdout)
+		case "-":
+			b, _ := json.MarshalIndent(plan, "", "    ")
+			fmt.Printf("%s\n", b)
+		default:
+			if err := WriteDumpPlan(plan, *dryRunJSON); err != nil {
+				log.Fatalln("Error:", err)
+			}
+		}
+		os.Exit(0)
+	}
+
 	start := time.Now().UTC()
-	startTimestamp := start.Format(dumpTimestampFormat)
+	nameVars := map[string]string{"timestamp": start.Format(dumpTimestampFormat)}
+	if usesArchiveNameVar(*archiveName, "cluster") {
+		cluster, err := GetClusterName()
+		if err != nil {
+			log.Fatalln("Error: could not find cluster name:", err)
+		}
+		nameVars["cluster"] = cluster
+	}
+	name, err := ExpandArchiveName(*archiveName, nameVars)
+	if err != nil {
+		log.Fatalln("Error:", err)
+	}
 
-	basePath := filepath.Join(dumpDir, startTimestamp)
+	dir := *outputDir
+	archivePath := filepath.Join(dir, name+".tar.gz")
+	if recipientKey != nil {
+		archivePath += encryptExt
+	}
+	if *archiveOutput != "" {
+		archivePath = *archiveOutput
+	}
+	// When streaming the archive to stdout, data is collected in a
+	// temporary directory, removed when done. Stdout is reserved for the
+	// archive.
+	toStdout := archivePath == "-"
+	report := io.Writer(os.Stdout)
+	if toStdout {
+		if isTerminal(os.Stdout) {
+			log.Fatalln("Error: refusing to write the archive to a terminal, redirect stdout to a file or pipe")
+		}
+		report = os.Stderr
+		if dir, err = ioutil.TempDir("", "fh-system-dump-tool-"); err != nil {
+			log.Fatalln("Error:", err)
+		}
+	}
+	basePath := filepath.Join(dir, name)
 
-	if err := os.MkdirAll(basePath, 0770); err != nil {
+	// Never overwrite a previous dump.
+	if !*noArchive && !toStdout {
+		existing := archivePath
+		if volumeSize > 0 {
+			existing += manifestExt
+		}
+		if _, err := os.Stat(existing); err == nil {
+			log.Fatalf("Error: %s already exists, use -o, -output-dir or -archive-name to choose another destination", existing)
+		}
+	}
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		log.Fatalln("Error:", err)
+	}
+	if err := os.Mkdir(basePath, 0770); err != nil {
+		if os.IsExist(err) {
+			log.Fatalf("Error: %s already exists, use -output-dir or -archive-name to choose another destination", basePath)
+		}
 		log.Fatalln("Error:", err)
 	}
 
@@ -139,45 +425,140 @@ func main() {
 	log.SetOutput(io.MultiWriter(os.Stderr, logfile))
 	fileOnlyLogger := log.New(logfile, "", log.LstdFlags)
 
+	checksums := NewChecksums()
+
 	// defer creating a tar.gz file from the dumped output files
 	defer func() {
-		// Write this only to logfile, before we archive it and remove
-		// basePath. After that, logs will go only to stderr.
+		// Write this only to logfile, before we checksum it, archive it
+		// and remove basePath. After that, logs go only to stderr, so
+		// that files match their checksums.
 		fileOnlyLogger.Printf("Dumped system information to: %s", basePath)
+		log.SetOutput(os.Stderr)
+		if err := WriteChecksums(basePath, checksums); err != nil {
+			log.Printf("Could not write checksums: %v", err)
+		}
 
-		if err := archive(basePath); err != nil {
-			fileOnlyLogger.Printf("Could not create data archive: %v", err)
+		if *noArchive {
+			log.Printf("Dumped system information to: %s", basePath)
+			return
+		}
+
+		var err error
+		var manifest ArchiveManifest
+		var digest string
+		if toStdout {
+			w := newHashWriter(os.Stdout)
+			err = writeArchive(w, basePath, recipientKey)
+			digest = w.Sum()
+		} else if volumeSize > 0 {
+			manifest, err = archiveVolumes(basePath, archivePath, recipientKey, volumeSize)
+			digest = manifest.SHA256
+		} else {
+			if digest, err = archive(basePath, archivePath, recipientKey); err == nil {
+				err = writeDigest(archivePath, digest)
+			}
+		}
+		if err != nil {
+			log.Printf("Could not create data archive: %v", err)
 			log.Printf("Could not archive dump data, unarchived data in: %s", basePath)
 			return
 		}
-		// The archive was created successfully, remove basePath. The
-		// error from os.RemoveAll is intentionally ignored, since there
-		// is no useful action we can do, and we don't need to confuse
-		// the user with an error message.
-		os.RemoveAll(basePath)
+		if *keepDir {
+			log.Printf("Unarchived data kept in: %s", basePath)
+		} else {
+			// The archive was created successfully, remove
+			// basePath. The error from os.RemoveAll is
+			// intentionally ignored, since there is no useful
+			// action we can do, and we don't need to confuse the
+			// user with an error message.
+			os.RemoveAll(basePath)
+			if toStdout {
+				os.Remove(dir)
+			}
+		}
 
-		log.Printf("Dumped system information to: %s", basePath+".tar.gz")
+		if toStdout {
+			log.Print("Dumped system information to stdout")
+			log.Printf("SHA-256 of the archive: %s", digest)
+			return
+		}
+		if volumeSize > 0 {
+			log.Printf("Dumped system information to %d volumes listed in: %s", len(manifest.Volumes), archivePath+manifestExt)
+			return
+		}
+		log.Printf("Dumped system information to: %s", archivePath)
+		log.Printf("SHA-256 of the archive: %s, also written to: %s", digest, archivePath+digestExt)
+
+		if uploader != nil {
+			log.Printf("Uploading %s...", archivePath)
+			location, err := uploader.Upload(archivePath)
+			if err != nil {
+				log.Printf("Could not upload the dump archive: %v", err)
+				log.Printf("Retry with: fh-system-dump-tool upload %s %s", archivePath, *uploadTarget)
+				return
+			}
+			log.Printf("Uploaded the dump archive to: %s", location)
+		}
 	}()
 
 	log.Print("Starting RHMAP System Dump Tool...")
 
-	runner := NewDumpRunner(basePath)
+	// Commands are retried on transient failures, and retries are
+	// recorded in the dump. Each attempt waits for the rate limiter, which
+	// is shared by all runners.
+	retryLog := &RetryLog{}
+	newRunner := func(dir string) Runner {
+		dumpRunner := NewDumpRunner(dir)
+		dumpRunner.Timeout = *commandTimeout
+		dumpRunner.Redactor = redactor
+		dumpRunner.Checksums = checksums
+		runner := NewProgressRunner(dumpRunner, progress)
+		return NewRetryRunner(NewLimitRunner(runner, limiter), retryPolicy, retryLog)
+	}
+	runner := newRunner(basePath)
 
-	log.Print("Collecting system information...")
-	errs := RunAllDumpTasks(runner, basePath, *concurrentTasks, os.Stderr)
+	// taskErrs holds the errors of all tasks, for the error report.
+	var taskErrs []error
 
-	for _, err := range errs {
-		if ierr, ok := err.(IgnorableError); !showAllErrors && ok && ierr.Ignore() {
-			fileOnlyLogger.Printf("Task error: %v", err)
-			continue
+	if *interval > 0 {
+		log.Printf("Taking %d snapshots every %v...", *snapshotCount, *interval)
+		errs := RunSnapshots(basePath, newRunner, cfg, *interval, *snapshotCount, *concurrentTasks, progress)
+		logTaskErrors(errs, fileOnlyLogger)
+		taskErrs = append(taskErrs, errs...)
+		if err := WriteSnapshotTimeline(basePath); err != nil {
+			log.Printf("Could not build snapshot timeline: %v", err)
 		}
-		// TODO: there should be a way to identify which task
-		// had an error.
-		log.Printf("Task error: %v", err)
+	}
+
+	log.Print("Collecting system information...")
+	progress.Start("collect")
+	errs := RunAllDumpTasks(runner, collectors, cfg, *concurrentTasks, progress)
+	progress.Finish()
+	logTaskErrors(errs, fileOnlyLogger)
+	taskErrs = append(taskErrs, errs...)
+
+	if err := WriteTimeline(basePath); err != nil {
+		log.Printf("Could not build timeline: %v", err)
 	}
 
 	log.Print("Analyzing data...")
-	analysisResults := RunAllAnalysisTasks(runner, basePath, *concurrentTasks)
+	progress.Start("analyze")
+	analysisResults, errs := RunAllAnalysisTasks(runner, checks, basePath, start, cfg.Projects, *concurrentTasks, progress)
+	progress.Finish()
+	logTaskErrors(errs, fileOnlyLogger)
+	taskErrs = append(taskErrs, errs...)
+
+	errorGroups := GroupErrors(taskErrs)
+	if err := WriteErrorReport(errorGroups, filepath.Join(basePath, "errors.json")); err != nil {
+		log.Printf("Could not write error report: %v", err)
+	}
+	LogErrorSummary(errorGroups, fileOnlyLogger)
+	if err := retryLog.WriteFile(filepath.Join(basePath, "retries.json")); err != nil {
+		log.Printf("Could not write retry log: %v", err)
+	}
+	if err := WriteSummary(basePath); err != nil {
+		log.Printf("Could not write summary: %v", err)
+	}
 
 	delta := time.Since(start)
 	// Remove sub-second precision.
@@ -186,5 +567,16 @@ func main() {
 		log.Printf("Finished in %v", delta)
 	}
 
-	PrintAnalysisReport(analysisResults, os.Stdout)
+	if *reportFile != "" {
+		f, err := os.Create(*reportFile)
+		if err != nil {
+			log.Printf("Could not write analysis report: %v", err)
+			return
+		}
+		defer f.Close()
+		report = f
+	}
+	if err := WriteReport(FilterBySeverity(analysisResults, severity), *reportFormat, report); err != nil {
+		log.Printf("Could not write analysis report: %v", err)
+	}
 }
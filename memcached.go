@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// memcachedStatsScript prints the output of the memcached stats command. It
+// uses bash's /dev/tcp because memcached images do not ship a client.
+const memcachedStatsScript = `exec 3<>/dev/tcp/127.0.0.1/11211 && printf 'stats\r\nquit\r\n' >&3 && cat <&3`
+
+// GetMemcachedTasks sends tasks to dump memcached statistics from all memcached
+// pods in all projects.
+func GetMemcachedTasks(tasks chan<- Task, runner Runner, projects []string, resourceFactory ResourceMatchFactory) {
+	for _, p := range projects {
+		pods, err := resourceFactory(p, "pod", "memcached")
+		if err != nil {
+			tasks <- NewError(err)
+			continue
+		}
+		for _, pod := range pods {
+			tasks <- GetMemcachedStats(runner, p, pod)
+		}
+	}
+}
+
+// GetMemcachedStats is a task factory for tasks that fetch memcached statistics
+// from the given pod in project.
+func GetMemcachedStats(r Runner, project, pod string) Task {
+	return func() error {
+		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "bash", "-c", memcachedStatsScript)
+		path := filepath.Join("projects", project, "memcached", pod+"_stats")
+		return MarkErrorAsIgnorable(r.Run(cmd, path))
+	}
+}
+
+// parseMemcachedStats parses the output of the memcached stats command, made
+// of lines in the form "STAT <name> <value>".
+func parseMemcachedStats(r io.Reader) (map[string]string, error) {
+	stats := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "STAT" {
+			stats[fields[1]] = fields[2]
+		}
+	}
+	return stats, scanner.Err()
+}
+
+// CheckMemcached checks memcached statistics for evicted items, rejected
+// connections and memory usage reaching the configured limit.
+func CheckMemcached(all []CacheStats) CheckResult {
+	result := CheckResult{
+		CheckName: "check memcached status",
+		Ok:        true,
+		Message:   "this issue was not detected",
+	}
+	report := func(s CacheStats, format string, a ...interface{}) {
+		result.Ok = false
+		result.Message = "one or more memcached instances have problems"
+		result.Info = append(result.Info, Info{
+			Name:      s.Pod,
+			Namespace: s.Project,
+			Message:   fmt.Sprintf("memcached in pod %s: ", s.Pod) + fmt.Sprintf(format, a...),
+		})
+	}
+	for _, s := range all {
+		if n := s.Int("evictions"); n > 0 {
+			report(s, "%d items were evicted to free memory", n)
+		}
+		if n := s.Int("rejected_connections"); n > 0 {
+			report(s, "%d connections were rejected due to the connection limit", n)
+		}
+		if n := s.Int("listen_disabled_num"); n > 0 {
+			report(s, "stopped accepting connections %d times after reaching the connection limit", n)
+		}
+		if max := s.Int("limit_maxbytes"); max > 0 && s.Int("bytes") >= max {
+			report(s, "used memory (%d bytes) reached the limit (%d bytes)", s.Int("bytes"), max)
+		}
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetMemcachedTasks(t *testing.T) {
+	tasks := make(chan Task, 1)
+	runner := &FakeRunner{}
+
+	GetMemcachedTasks(tasks, runner, []string{"project1"}, func(project, resource, substr string) ([]string, error) {
+		return []string{"memcached-1-abcde"}, nil
+	})
+
+	task := <-tasks
+	if err := task(); err != nil {
+		t.Fatal(err)
+	}
+	expectedCalls := []RunCall{
+		{
+			[]string{"oc", "-n", "project1", "exec", "memcached-1-abcde", "--", "bash", "-c", memcachedStatsScript},
+			filepath.Join("projects", "project1", "memcached", "memcached-1-abcde_stats"),
+		},
+	}
+	if !reflect.DeepEqual(runner.Calls, expectedCalls) {
+		t.Errorf("runner.Calls = %q, want %q", runner.Calls, expectedCalls)
+	}
+}
+
+func TestCheckMemcached(t *testing.T) {
+	tests := []struct {
+		description string
+		output      string
+		wantInfo    []string
+	}{
+		{
+			description: "healthy",
+			output:      "STAT pid 1\r\nSTAT evictions 0\r\nSTAT bytes 100\r\nSTAT limit_maxbytes 67108864\r\nEND\r\n",
+		},
+		{
+			description: "evictions, rejected connections and memory limit",
+			output:      "STAT evictions 5\r\nSTAT rejected_connections 2\r\nSTAT listen_disabled_num 1\r\nSTAT bytes 1024\r\nSTAT limit_maxbytes 1024\r\nEND\r\n",
+			wantInfo: []string{
+				"memcached in pod memcached-1-abcde: 5 items were evicted to free memory",
+				"memcached in pod memcached-1-abcde: 2 connections were rejected due to the connection limit",
+				"memcached in pod memcached-1-abcde: stopped accepting connections 1 times after reaching the connection limit",
+				"memcached in pod memcached-1-abcde: used memory (1024 bytes) reached the limit (1024 bytes)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		stats, err := parseMemcachedStats(strings.NewReader(tt.output))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.description, err)
+		}
+		got := CheckMemcached([]CacheStats{{Project: "core", Pod: "memcached-1-abcde", Stats: stats}})
+		if got.Ok != (len(tt.wantInfo) == 0) {
+			t.Errorf("%s: Ok = %v, want %v", tt.description, got.Ok, len(tt.wantInfo) == 0)
+		}
+		var gotInfo []string
+		for _, info := range got.Info {
+			gotInfo = append(gotInfo, info.Message)
+		}
+		if !reflect.DeepEqual(gotInfo, tt.wantInfo) {
+			t.Errorf("%s: Info = %q, want %q", tt.description, gotInfo, tt.wantInfo)
+		}
+	}
+}
@@ -8,8 +8,8 @@ import (
 // GetMillicoreConfigTasks will create a function matching the CheckTask
 // interface for each project to retrieve the Millicore config in that
 // property, if the pod exists. The created tasks are sent down the tasks
-// channel.
-func GetMillicoreConfigTasks(tasks chan<- Task, runner Runner, projects []string, resourceFactory ResourceMatchFactory) {
+// channel. The config file is read from the given path in the pod.
+func GetMillicoreConfigTasks(tasks chan<- Task, runner Runner, projects []string, resourceFactory ResourceMatchFactory, configFile string) {
 	for _, p := range projects {
 		pods, err := resourceFactory(p, "pod", "millicore")
 		if err != nil {
@@ -17,17 +17,17 @@ func GetMillicoreConfigTasks(tasks chan<- Task, runner Runner, projects []string
 			continue
 		}
 		for _, pod := range pods {
-			tasks <- GetMillicoreConfig(runner, p, pod)
+			tasks <- GetMillicoreConfig(runner, p, pod, configFile)
 		}
 	}
 }
 
-// GetMillicoreConfig will retrieve the Millicore config from the Millicore
-// container inside the provided pod and project.
-func GetMillicoreConfig(r Runner, project, pod string) Task {
+// GetMillicoreConfig will retrieve the Millicore config file from the
+// Millicore container inside the provided pod and project.
+func GetMillicoreConfig(r Runner, project, pod, configFile string) Task {
 	return func() error {
-		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "cat", "/etc/feedhenry/cluster-override.properties")
-		path := filepath.Join("projects", project, "millicore", pod+"_cluster-override.properties")
+		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "cat", configFile)
+		path := filepath.Join("projects", project, "millicore", pod+"_"+filepath.Base(configFile))
 		return MarkErrorAsIgnorable(r.Run(cmd, path))
 	}
 }
@@ -13,7 +13,7 @@ func TestGetMillicoreConfigTasks(t *testing.T) {
 
 	GetMillicoreConfigTasks(tasks, runner, []string{"project1"}, func(project, resource, substr string) ([]string, error) {
 		return []string{"millicore-1"}, nil
-	})
+	}, "/etc/feedhenry/cluster-override.properties")
 
 	task := <-tasks
 	err := task()
@@ -41,7 +41,7 @@ func TestMillicorePodError(t *testing.T) {
 
 	GetMillicoreConfigTasks(tasks, runner, []string{"project1"}, func(project, resource, substr string) ([]string, error) {
 		return nil, want
-	})
+	}, "/etc/feedhenry/cluster-override.properties")
 
 	task := <-tasks
 	if err := task(); err != want {
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mongoDBMaxReplicationLag is how far behind the primary a secondary member
+// can be before it is reported as lagging.
+const mongoDBMaxReplicationLag = 30 * time.Second
+
+// mongoDBDiagnostics maps the name of a MongoDB diagnostic to the JavaScript
+// expression that produces it. The name is used as part of the output file
+// name.
+var mongoDBDiagnostics = []struct {
+	name, expr string
+}{
+	{"rs.status", "rs.status()"},
+	{"rs.conf", "rs.conf()"},
+	{"serverStatus", "db.serverStatus()"},
+	{"stats", "db.adminCommand('listDatabases').databases.map(function(d) { return db.getSiblingDB(d.name).stats(); })"},
+}
+
+// GetMongoDBTasks sends tasks to dump MongoDB diagnostics from all MongoDB pods
+// in all projects.
+func GetMongoDBTasks(tasks chan<- Task, runner Runner, projects []string, resourceFactory ResourceMatchFactory) {
+	for _, p := range projects {
+		pods, err := resourceFactory(p, "pod", "mongodb")
+		if err != nil {
+			tasks <- NewError(err)
+			continue
+		}
+		for _, pod := range pods {
+			for _, d := range mongoDBDiagnostics {
+				tasks <- GetMongoDBDiagnostic(runner, p, pod, d.name, d.expr)
+			}
+		}
+	}
+}
+
+// GetMongoDBDiagnostic is a task factory for tasks that evaluate expr in the
+// mongo shell inside the given pod and save the result as JSON. The mongo
+// shell authenticates using the admin credentials from the pod environment.
+func GetMongoDBDiagnostic(r Runner, project, pod, name, expr string) Task {
+	return func() error {
+		script := fmt.Sprintf(`mongo admin -u admin -p "$MONGODB_ADMIN_PASSWORD" --quiet --eval "print(JSON.stringify(%s))"`, expr)
+		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "bash", "-c", script)
+		path := filepath.Join("projects", project, "mongodb", pod+"_"+name+".json")
+		return MarkErrorAsIgnorable(r.Run(cmd, path))
+	}
+}
+
+// MongoDBReplSetStatus is the output of rs.status().
+type MongoDBReplSetStatus struct {
+	Set     string                       `json:"set"`
+	Members []MongoDBReplSetStatusMember `json:"members"`
+}
+
+// MongoDBReplSetStatusMember is the status of a replica set member, as seen
+// from the member that reported it.
+type MongoDBReplSetStatusMember struct {
+	ID         int       `json:"_id"`
+	Name       string    `json:"name"`
+	Health     float64   `json:"health"`
+	StateStr   string    `json:"stateStr"`
+	OptimeDate time.Time `json:"optimeDate"`
+	Self       bool      `json:"self,omitempty"`
+}
+
+// MongoDBReplSetConfig is the output of rs.conf().
+type MongoDBReplSetConfig struct {
+	ID      string                       `json:"_id"`
+	Members []MongoDBReplSetConfigMember `json:"members"`
+}
+
+// MongoDBReplSetConfigMember is the configuration of a replica set member.
+type MongoDBReplSetConfigMember struct {
+	ID   int    `json:"_id"`
+	Host string `json:"host"`
+}
+
+// MongoDBInstance holds the replica set data dumped from a MongoDB pod.
+type MongoDBInstance struct {
+	Project string
+	Pod     string
+	Status  MongoDBReplSetStatus
+	Config  MongoDBReplSetConfig
+	// Unreachable is set when the replica set data could not be read from
+	// the pod, typically because it is down or crashlooping.
+	Unreachable bool
+}
+
+// loadMongoDBInstances loads the replica set status and configuration dumped
+// from all MongoDB pods in project. Pods that are not members of a replica
+// set are skipped. Pods whose data is empty or invalid, as left by a failed
+// oc exec, are returned as unreachable.
+func loadMongoDBInstances(basepath, project string) ([]MongoDBInstance, error) {
+	dir := filepath.Join(basepath, "projects", project, "mongodb")
+	const suffix = "_rs.status.json"
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	var instances []MongoDBInstance
+	for _, path := range paths {
+		pod := strings.TrimSuffix(filepath.Base(path), suffix)
+		instance := MongoDBInstance{Project: project, Pod: pod}
+		if err := load(path, &instance.Status); err != nil {
+			instances = append(instances, MongoDBInstance{Project: project, Pod: pod, Unreachable: true})
+			continue
+		}
+		if instance.Status.Set == "" {
+			continue
+		}
+		if err := load(filepath.Join(dir, pod+"_rs.conf.json"), &instance.Config); err != nil {
+			instances = append(instances, MongoDBInstance{Project: project, Pod: pod, Unreachable: true})
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// CheckMongoDBReplicaSets checks the replica sets as seen from each MongoDB
+// instance, looking for sets without a primary, unhealthy members, members
+// lagging behind the primary, members whose host does not match the replica
+// set configuration and pods whose replica set data could not be read.
+func CheckMongoDBReplicaSets(instances []MongoDBInstance) CheckResult {
+	result := CheckResult{
+		CheckName: "check MongoDB replica set health",
+		Ok:        true,
+		Message:   "this issue was not detected",
+	}
+	seen := make(map[string]bool)
+	report := func(instance MongoDBInstance, msg string) {
+		if seen[msg] {
+			return
+		}
+		seen[msg] = true
+		result.Ok = false
+		result.Message = "one or more MongoDB replica sets are unhealthy"
+		result.Info = append(result.Info, Info{
+			Name:      instance.Pod,
+			Namespace: instance.Project,
+			Message:   msg,
+		})
+	}
+	for _, instance := range instances {
+		if instance.Unreachable {
+			report(instance, fmt.Sprintf("could not get the replica set status from pod %s, it may be down", instance.Pod))
+			continue
+		}
+		set := instance.Status.Set
+
+		var primary *MongoDBReplSetStatusMember
+		for i, member := range instance.Status.Members {
+			if member.StateStr == "PRIMARY" {
+				primary = &instance.Status.Members[i]
+			}
+		}
+		if primary == nil {
+			report(instance, fmt.Sprintf("replica set %s has no primary member", set))
+		}
+
+		hosts := make(map[string]bool)
+		for _, member := range instance.Config.Members {
+			hosts[member.Host] = true
+		}
+
+		for _, member := range instance.Status.Members {
+			switch {
+			case member.StateStr == "RECOVERING" || member.StateStr == "DOWN" || member.Health == 0:
+				report(instance, fmt.Sprintf("member %s of replica set %s is in state %s", member.Name, set, member.StateStr))
+			case member.StateStr == "SECONDARY" && primary != nil:
+				if lag := primary.OptimeDate.Sub(member.OptimeDate); lag > mongoDBMaxReplicationLag {
+					report(instance, fmt.Sprintf("member %s of replica set %s is %v behind the primary", member.Name, set, lag))
+				}
+			}
+			if !hosts[member.Name] {
+				report(instance, fmt.Sprintf("member %s of replica set %s is not in the replica set configuration, configured hosts are: %s", member.Name, set, strings.Join(sortedKeys(hosts), ", ")))
+			}
+		}
+	}
+	return result
+}
+
+// sortedKeys returns the keys of m in increasing order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
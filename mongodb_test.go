@@ -0,0 +1,184 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetMongoDBTasks(t *testing.T) {
+	tasks := make(chan Task, len(mongoDBDiagnostics))
+	runner := &FakeRunner{}
+
+	GetMongoDBTasks(tasks, runner, []string{"project1"}, func(project, resource, substr string) ([]string, error) {
+		return []string{"mongodb-1-1-abcde"}, nil
+	})
+	close(tasks)
+
+	for task := range tasks {
+		if err := task(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script := `mongo admin -u admin -p "$MONGODB_ADMIN_PASSWORD" --quiet --eval "print(JSON.stringify(rs.status()))"`
+	want := RunCall{
+		[]string{"oc", "-n", "project1", "exec", "mongodb-1-1-abcde", "--", "bash", "-c", script},
+		filepath.Join("projects", "project1", "mongodb", "mongodb-1-1-abcde_rs.status.json"),
+	}
+	if len(runner.Calls) != len(mongoDBDiagnostics) {
+		t.Fatalf("len(runner.Calls) = %d, want %d", len(runner.Calls), len(mongoDBDiagnostics))
+	}
+	if !reflect.DeepEqual(runner.Calls[0], want) {
+		t.Errorf("runner.Calls[0] = %q, want %q", runner.Calls[0], want)
+	}
+}
+
+func TestLoadMongoDBInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-mongodb-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mongoDir := filepath.Join(dir, "projects", "mbaas", "mongodb")
+	if err := os.MkdirAll(mongoDir, 0770); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"mongodb-1-1-abcde_rs.status.json": `{"set": "rs0", "members": [{"_id": 0, "name": "mongodb-1:27017", "health": 1, "stateStr": "PRIMARY", "optimeDate": "2017-03-01T10:00:00.000Z", "self": true}]}`,
+		"mongodb-1-1-abcde_rs.conf.json":   `{"_id": "rs0", "members": [{"_id": 0, "host": "mongodb-1:27017"}]}`,
+		// Standalone MongoDB instances are not part of a replica set.
+		"mongodb-core_rs.status.json": `{"ok": 0, "errmsg": "not running with --replSet"}`,
+		// A failed oc exec leaves empty files.
+		"mongodb-2-1-fghij_rs.status.json": "",
+		"mongodb-2-1-fghij_rs.conf.json":   "",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(mongoDir, name), []byte(contents), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := loadMongoDBInstances(dir, "mbaas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MongoDBInstance{
+		{
+			Project: "mbaas",
+			Pod:     "mongodb-1-1-abcde",
+			Status: MongoDBReplSetStatus{
+				Set: "rs0",
+				Members: []MongoDBReplSetStatusMember{
+					{ID: 0, Name: "mongodb-1:27017", Health: 1, StateStr: "PRIMARY", OptimeDate: time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC), Self: true},
+				},
+			},
+			Config: MongoDBReplSetConfig{
+				ID:      "rs0",
+				Members: []MongoDBReplSetConfigMember{{ID: 0, Host: "mongodb-1:27017"}},
+			},
+		},
+		{Project: "mbaas", Pod: "mongodb-2-1-fghij", Unreachable: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadMongoDBInstances() = \n%#v, want \n%#v", got, want)
+	}
+}
+
+func TestCheckMongoDBReplicaSets(t *testing.T) {
+	now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	config := MongoDBReplSetConfig{
+		ID: "rs0",
+		Members: []MongoDBReplSetConfigMember{
+			{ID: 0, Host: "mongodb-1:27017"},
+			{ID: 1, Host: "mongodb-2:27017"},
+		},
+	}
+	instance := func(members ...MongoDBReplSetStatusMember) MongoDBInstance {
+		return MongoDBInstance{
+			Project: "mbaas",
+			Pod:     "mongodb-1-1-abcde",
+			Status:  MongoDBReplSetStatus{Set: "rs0", Members: members},
+			Config:  config,
+		}
+	}
+	primary := MongoDBReplSetStatusMember{ID: 0, Name: "mongodb-1:27017", Health: 1, StateStr: "PRIMARY", OptimeDate: now}
+	secondary := MongoDBReplSetStatusMember{ID: 1, Name: "mongodb-2:27017", Health: 1, StateStr: "SECONDARY", OptimeDate: now}
+
+	tests := []struct {
+		description string
+		instances   []MongoDBInstance
+		wantOk      bool
+		wantInfo    []string
+	}{
+		{
+			description: "healthy replica set",
+			instances:   []MongoDBInstance{instance(primary, secondary)},
+			wantOk:      true,
+		},
+		{
+			description: "no primary",
+			instances: []MongoDBInstance{
+				instance(
+					MongoDBReplSetStatusMember{ID: 0, Name: "mongodb-1:27017", Health: 1, StateStr: "SECONDARY", OptimeDate: now},
+					secondary,
+				),
+			},
+			wantInfo: []string{"replica set rs0 has no primary member"},
+		},
+		{
+			description: "recovering member",
+			instances: []MongoDBInstance{
+				instance(primary, MongoDBReplSetStatusMember{ID: 1, Name: "mongodb-2:27017", Health: 1, StateStr: "RECOVERING"}),
+			},
+			wantInfo: []string{"member mongodb-2:27017 of replica set rs0 is in state RECOVERING"},
+		},
+		{
+			description: "lagging secondary",
+			instances: []MongoDBInstance{
+				instance(primary, MongoDBReplSetStatusMember{ID: 1, Name: "mongodb-2:27017", Health: 1, StateStr: "SECONDARY", OptimeDate: now.Add(-5 * time.Minute)}),
+			},
+			wantInfo: []string{"member mongodb-2:27017 of replica set rs0 is 5m0s behind the primary"},
+		},
+		{
+			description: "mismatched host",
+			instances: []MongoDBInstance{
+				instance(primary, MongoDBReplSetStatusMember{ID: 1, Name: "10.1.2.3:27017", Health: 1, StateStr: "SECONDARY", OptimeDate: now}),
+			},
+			wantInfo: []string{"member 10.1.2.3:27017 of replica set rs0 is not in the replica set configuration, configured hosts are: mongodb-1:27017, mongodb-2:27017"},
+		},
+		{
+			description: "same problem reported by several instances",
+			instances: []MongoDBInstance{
+				instance(primary, MongoDBReplSetStatusMember{ID: 1, Name: "mongodb-2:27017", StateStr: "DOWN"}),
+				instance(primary, MongoDBReplSetStatusMember{ID: 1, Name: "mongodb-2:27017", StateStr: "DOWN"}),
+			},
+			wantInfo: []string{"member mongodb-2:27017 of replica set rs0 is in state DOWN"},
+		},
+		{
+			description: "unreachable member",
+			instances: []MongoDBInstance{
+				instance(primary, secondary),
+				{Project: "mbaas", Pod: "mongodb-2-1-fghij", Unreachable: true},
+			},
+			wantInfo: []string{"could not get the replica set status from pod mongodb-2-1-fghij, it may be down"},
+		},
+	}
+	for _, tt := range tests {
+		got := CheckMongoDBReplicaSets(tt.instances)
+		if got.Ok != tt.wantOk {
+			t.Errorf("%s: Ok = %v, want %v", tt.description, got.Ok, tt.wantOk)
+		}
+		var gotInfo []string
+		for _, info := range got.Info {
+			gotInfo = append(gotInfo, info.Message)
+		}
+		if !reflect.DeepEqual(gotInfo, tt.wantInfo) {
+			t.Errorf("%s: Info = %q, want %q", tt.description, gotInfo, tt.wantInfo)
+		}
+	}
+}
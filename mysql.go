@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// mysqlMaxQueryTime is the time in seconds after which a running query
+	// is reported as long-running.
+	mysqlMaxQueryTime = 60
+	// mysqlMaxConnectionsRatio is the fraction of max_connections above
+	// which the number of open connections is reported as too high.
+	mysqlMaxConnectionsRatio = 0.8
+)
+
+// mysqlQueries lists the read-only diagnostic queries run against MySQL. The
+// name is used as part of the output file name.
+var mysqlQueries = []struct {
+	name, query string
+}{
+	{"global-status", "SHOW GLOBAL STATUS"},
+	{"global-variables", "SHOW GLOBAL VARIABLES"},
+	{"processlist", "SHOW FULL PROCESSLIST"},
+	{"innodb-status", "SHOW ENGINE INNODB STATUS"},
+	{"slave-status", "SHOW SLAVE STATUS"},
+}
+
+// GetMySQLTasks sends tasks to dump MySQL diagnostics from all MySQL pods in
+// all projects.
+func GetMySQLTasks(tasks chan<- Task, runner Runner, projects []string, resourceFactory ResourceMatchFactory) {
+	for _, p := range projects {
+		pods, err := resourceFactory(p, "pod", "mysql")
+		if err != nil {
+			tasks <- NewError(err)
+			continue
+		}
+		for _, pod := range pods {
+			for _, q := range mysqlQueries {
+				tasks <- GetMySQLDiagnostic(runner, p, pod, q.name, q.query)
+			}
+		}
+	}
+}
+
+// GetMySQLDiagnostic is a task factory for tasks that run a query with the
+// mysql client inside the given pod. The client connects as root using the
+// password from the pod environment, and the output is tab-separated.
+func GetMySQLDiagnostic(r Runner, project, pod, name, query string) Task {
+	return func() error {
+		script := fmt.Sprintf(`MYSQL_PWD="$MYSQL_ROOT_PASSWORD" mysql -u root --batch -e %q`, query)
+		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "bash", "-c", script)
+		path := filepath.Join("projects", project, "mysql", pod+"_"+name)
+		return MarkErrorAsIgnorable(r.Run(cmd, path))
+	}
+}
+
+// MySQLInstance holds the diagnostics dumped from a MySQL pod.
+type MySQLInstance struct {
+	Project      string
+	Pod          string
+	Status       map[string]string
+	Variables    map[string]string
+	Processes    []map[string]string
+	InnoDBStatus string
+}
+
+// loadMySQLInstances loads the diagnostics dumped from all MySQL pods in
+// project. Diagnostics that could not be dumped are left empty.
+func loadMySQLInstances(basepath, project string) ([]MySQLInstance, error) {
+	dir := filepath.Join(basepath, "projects", project, "mysql")
+	const suffix = "_global-status"
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	var instances []MySQLInstance
+	for _, path := range paths {
+		pod := strings.TrimSuffix(filepath.Base(path), suffix)
+		instance := MySQLInstance{Project: project, Pod: pod}
+
+		status, err := loadMySQLTable(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(status) == 0 {
+			continue
+		}
+		instance.Status = mysqlVariables(status)
+
+		variables, err := loadMySQLTable(filepath.Join(dir, pod+"_global-variables"))
+		if err != nil {
+			return nil, err
+		}
+		instance.Variables = mysqlVariables(variables)
+
+		instance.Processes, err = loadMySQLTable(filepath.Join(dir, pod+"_processlist"))
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, pod+"_innodb-status"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		instance.InnoDBStatus = string(b)
+
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// loadMySQLTable loads a file written by the mysql client in batch mode. A
+// missing file is treated as an empty table.
+func loadMySQLTable(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	rows, err := parseMySQLTable(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rows, nil
+}
+
+// parseMySQLTable parses the tab-separated output of the mysql client in batch
+// mode. The first line holds the column names.
+func parseMySQLTable(r io.Reader) ([]map[string]string, error) {
+	var (
+		columns []string
+		rows    []map[string]string
+	)
+	scanner := bufio.NewScanner(r)
+	// SHOW ENGINE INNODB STATUS produces a single long line.
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if columns == nil {
+			columns = fields
+			continue
+		}
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i < len(fields) {
+				row[column] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// mysqlVariables converts the rows of SHOW STATUS or SHOW VARIABLES into a map
+// of variable names to values.
+func mysqlVariables(rows []map[string]string) map[string]string {
+	m := make(map[string]string, len(rows))
+	for _, row := range rows {
+		m[row["Variable_name"]] = row["Value"]
+	}
+	return m
+}
+
+// CheckMySQL checks MySQL diagnostics for too many connections, long-running
+// queries and deadlocks.
+func CheckMySQL(instances []MySQLInstance) CheckResult {
+	result := CheckResult{
+		CheckName: "check MySQL status",
+		Ok:        true,
+		Message:   "this issue was not detected",
+	}
+	report := func(instance MySQLInstance, format string, a ...interface{}) {
+		result.Ok = false
+		result.Message = "one or more MySQL instances have problems"
+		result.Info = append(result.Info, Info{
+			Name:      instance.Pod,
+			Namespace: instance.Project,
+			Message:   fmt.Sprintf("mysql in pod %s: ", instance.Pod) + fmt.Sprintf(format, a...),
+		})
+	}
+	atoi := func(s string) int64 {
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return n
+	}
+	for _, instance := range instances {
+		connected := atoi(instance.Status["Threads_connected"])
+		if max := atoi(instance.Variables["max_connections"]); max > 0 && float64(connected) >= mysqlMaxConnectionsRatio*float64(max) {
+			report(instance, "%d open connections out of max_connections %d", connected, max)
+		}
+		if n := atoi(instance.Status["Connection_errors_max_connections"]); n > 0 {
+			report(instance, "%d connections were refused due to the max_connections limit", n)
+		}
+		for _, p := range instance.Processes {
+			switch p["Command"] {
+			case "Sleep", "Daemon", "Binlog Dump", "Connect":
+				continue
+			}
+			if t := atoi(p["Time"]); t > mysqlMaxQueryTime {
+				report(instance, "query %s by user %s running for %d seconds: %s", p["Id"], p["User"], t, p["Info"])
+			}
+		}
+		if strings.Contains(instance.InnoDBStatus, "LATEST DETECTED DEADLOCK") {
+			report(instance, "InnoDB detected a deadlock, see SHOW ENGINE INNODB STATUS output for details")
+		}
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetMySQLTasks(t *testing.T) {
+	tasks := make(chan Task, len(mysqlQueries))
+	runner := &FakeRunner{}
+
+	GetMySQLTasks(tasks, runner, []string{"core"}, func(project, resource, substr string) ([]string, error) {
+		return []string{"mysql-1-abcde"}, nil
+	})
+	close(tasks)
+
+	for task := range tasks {
+		if err := task(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := RunCall{
+		[]string{"oc", "-n", "core", "exec", "mysql-1-abcde", "--", "bash", "-c", `MYSQL_PWD="$MYSQL_ROOT_PASSWORD" mysql -u root --batch -e "SHOW GLOBAL STATUS"`},
+		filepath.Join("projects", "core", "mysql", "mysql-1-abcde_global-status"),
+	}
+	if len(runner.Calls) != len(mysqlQueries) {
+		t.Fatalf("len(runner.Calls) = %d, want %d", len(runner.Calls), len(mysqlQueries))
+	}
+	if !reflect.DeepEqual(runner.Calls[0], want) {
+		t.Errorf("runner.Calls[0] = %q, want %q", runner.Calls[0], want)
+	}
+}
+
+func TestCheckMySQL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-mysql-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mysqlDir := filepath.Join(dir, "projects", "core", "mysql")
+	if err := os.MkdirAll(mysqlDir, 0770); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"mysql-1-abcde_global-status":    "Variable_name\tValue\nThreads_connected\t95\nConnection_errors_max_connections\t4\n",
+		"mysql-1-abcde_global-variables": "Variable_name\tValue\nmax_connections\t100\n",
+		"mysql-1-abcde_processlist": "Id\tUser\tHost\tdb\tCommand\tTime\tState\tInfo\n" +
+			"7\tmillicore\tlocalhost\tmillicore\tSleep\t3600\t\tNULL\n" +
+			"8\tmillicore\tlocalhost\tmillicore\tQuery\t120\tSending data\tSELECT * FROM app\n",
+		"mysql-1-abcde_innodb-status": "Type\tName\tStatus\nInnoDB\t\t\\n------------------------\\nLATEST DETECTED DEADLOCK\\n------------------------\\n\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(mysqlDir, name), []byte(contents), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	instances, err := loadMySQLInstances(dir, "core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 {
+		t.Fatalf("len(instances) = %d, want 1", len(instances))
+	}
+
+	got := CheckMySQL(instances)
+	if got.Ok {
+		t.Errorf("Ok = %v, want %v", got.Ok, false)
+	}
+	var gotInfo []string
+	for _, info := range got.Info {
+		gotInfo = append(gotInfo, info.Message)
+	}
+	wantInfo := []string{
+		"mysql in pod mysql-1-abcde: 95 open connections out of max_connections 100",
+		"mysql in pod mysql-1-abcde: 4 connections were refused due to the max_connections limit",
+		"mysql in pod mysql-1-abcde: query 8 by user millicore running for 120 seconds: SELECT * FROM app",
+		"mysql in pod mysql-1-abcde: InnoDB detected a deadlock, see SHOW ENGINE INNODB STATUS output for details",
+	}
+	if !reflect.DeepEqual(gotInfo, wantInfo) {
+		t.Errorf("Info = %q, want %q", gotInfo, wantInfo)
+	}
+}
+
+func TestCheckMySQLHealthy(t *testing.T) {
+	instances := []MySQLInstance{
+		{
+			Project:   "core",
+			Pod:       "mysql-1-abcde",
+			Status:    map[string]string{"Threads_connected": "10"},
+			Variables: map[string]string{"max_connections": "100"},
+			Processes: []map[string]string{
+				{"Id": "1", "User": "root", "Command": "Query", "Time": "0", "Info": "SHOW FULL PROCESSLIST"},
+			},
+		},
+	}
+	if got := CheckMySQL(instances); !got.Ok {
+		t.Errorf("CheckMySQL() = %#v, want Ok", got)
+	}
+}
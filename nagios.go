@@ -1,26 +1,34 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
 	"errors"
+	"io"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // GetNagiosTasks sends tasks to dump Nagios data for each project that contain
-// a Nagios pod. It is an error if no projects contain a Nagios pod.
-func GetNagiosTasks(tasks chan<- Task, runner Runner, projects []string) {
+// a Nagios pod, given the paths of the status file and of the archives
+// directory in the pods. It is an error if no projects contain a Nagios pod.
+func GetNagiosTasks(tasks chan<- Task, runner Runner, projects []string, resourceFactory ResourceMatchFactory, statusFile, archivesDir string) {
 	foundANagiosPod := false
 	for _, p := range projects {
-		pods, err := getResourceNamesBySubstr(p, "pod", "nagios")
+		pods, err := resourceFactory(p, "pod", "nagios")
 		if err != nil {
 			tasks <- NewError(err)
 			continue
 		}
 		for _, pod := range pods {
 			foundANagiosPod = true
-			tasks <- GetNagiosStatusData(runner, p, pod)
-			tasks <- GetNagiosHistoricalData(runner, p, pod)
+			tasks <- GetNagiosStatusData(runner, p, pod, statusFile)
+			tasks <- GetNagiosHistoricalData(runner, p, pod, archivesDir)
 		}
 	}
 	if !foundANagiosPod {
@@ -28,22 +36,22 @@ func GetNagiosTasks(tasks chan<- Task, runner Runner, projects []string) {
 	}
 }
 
-// GetNagiosStatusData is a task factory for tasks that fetch Nagios status from
-// the given pod in project.
-func GetNagiosStatusData(r Runner, project, pod string) Task {
+// GetNagiosStatusData is a task factory for tasks that fetch the Nagios status
+// file from the given pod in project.
+func GetNagiosStatusData(r Runner, project, pod, statusFile string) Task {
 	return func() error {
-		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "cat", "/var/log/nagios/status.dat")
+		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "cat", statusFile)
 		fname := pod + "_status.dat"
 		path := filepath.Join("projects", project, "nagios", fname)
 		return MarkErrorAsIgnorable(r.Run(cmd, path))
 	}
 }
 
-// GetNagiosHistoricalData is a task factory for tasks that fetch Nagios
-// archives from the given pod in project.
-func GetNagiosHistoricalData(r Runner, project, pod string) Task {
+// GetNagiosHistoricalData is a task factory for tasks that fetch the Nagios
+// archives directory from the given pod in project.
+func GetNagiosHistoricalData(r Runner, project, pod, archivesDir string) Task {
 	return func() error {
-		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "tar", "-c", "-C", "/var/log/nagios", "archives")
+		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "tar", "-c", "-C", path.Dir(archivesDir), path.Base(archivesDir))
 		fname := pod + "_history.tar"
 		path := filepath.Join("projects", project, "nagios", fname)
 		return MarkErrorAsIgnorable(r.Run(cmd, path))
@@ -55,30 +63,162 @@ func GetNagiosHistoricalData(r Runner, project, pod string) Task {
 // project which contain the substring in their name.
 type ResourceMatchFactory func(project, resource, substr string) ([]string, error)
 
-// getResourceNamesBySubstr returns a list of names for the provided resource type that contain
-// the provided string, in the provided project.
-func getResourceNamesBySubstr(project, resource, substr string) ([]string, error) {
-	// FIXME: take runner as argument.
-	runner := simpleRunner{}
-	resources, err := GetResourceNames(runner, project, resource)
-	if err != nil {
-		return nil, err
+// resourceMatchFactory returns a ResourceMatchFactory that lists resources
+// using runner. Each kind of resource is listed once per project, however many
+// collectors look for resources of that kind.
+func resourceMatchFactory(runner Runner) ResourceMatchFactory {
+	type listing struct {
+		once  sync.Once
+		names []string
+		err   error
 	}
+	var (
+		mu       sync.Mutex
+		listings = make(map[string]*listing)
+	)
+	return func(project, resource, substr string) ([]string, error) {
+		key := project + "/" + resource
+		mu.Lock()
+		l, ok := listings[key]
+		if !ok {
+			l = &listing{}
+			listings[key] = l
+		}
+		mu.Unlock()
+		l.once.Do(func() {
+			l.names, l.err = GetResourceNames(runner, project, resource)
+		})
+		if l.err != nil {
+			return nil, l.err
+		}
 
-	filtered := resources[:0]
-
-	for _, resource := range resources {
-		if strings.Contains(resource, substr) {
-			filtered = append(filtered, resource)
+		var filtered []string
+		for _, name := range l.names {
+			if strings.Contains(name, substr) {
+				filtered = append(filtered, name)
+			}
 		}
+
+		return filtered, nil
 	}
+}
+
+// nagiosStates maps Nagios service state codes to their names.
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
 
-	return filtered, nil
+// A NagiosStateChange is a change of state of a Nagios host or service check.
+type NagiosStateChange struct {
+	Time    time.Time
+	Host    string
+	Service string
+	State   string
+	Output  string
 }
 
-// FIXME: get rid of this, use a DumpRunner.
-type simpleRunner struct{}
+// parseNagiosStatus parses a Nagios status.dat file, returning the last state
+// change of each service. Services that never changed state are left out.
+func parseNagiosStatus(r io.Reader) ([]NagiosStateChange, error) {
+	var (
+		changes []NagiosStateChange
+		block   string
+		fields  map[string]string
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasSuffix(line, "{"):
+			block = strings.TrimSpace(strings.TrimSuffix(line, "{"))
+			fields = make(map[string]string)
+		case line == "}":
+			if block == "servicestatus" {
+				t, _ := strconv.ParseInt(fields["last_state_change"], 10, 64)
+				state, _ := strconv.Atoi(fields["current_state"])
+				if t > 0 && state >= 0 && state < len(nagiosStates) {
+					changes = append(changes, NagiosStateChange{
+						Time:    time.Unix(t, 0).UTC(),
+						Host:    fields["host_name"],
+						Service: fields["service_description"],
+						State:   nagiosStates[state],
+						Output:  fields["plugin_output"],
+					})
+				}
+			}
+			block = ""
+		case block != "":
+			if i := strings.Index(line, "="); i > 0 {
+				fields[line[:i]] = line[i+1:]
+			}
+		}
+	}
+	return changes, scanner.Err()
+}
 
-func (simpleRunner) Run(cmd *exec.Cmd, path string) error {
-	return cmd.Run()
+// parseNagiosLog parses a Nagios log file, returning the state changes of
+// hosts and services recorded as alerts, e.g.:
+//
+//	[1483264800] SERVICE ALERT: host;service;CRITICAL;HARD;3;output
+//	[1483264800] HOST ALERT: host;DOWN;HARD;1;output
+func parseNagiosLog(r io.Reader) ([]NagiosStateChange, error) {
+	var changes []NagiosStateChange
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		end := strings.Index(line, "] ")
+		if !strings.HasPrefix(line, "[") || end < 0 {
+			continue
+		}
+		t, err := strconv.ParseInt(line[1:end], 10, 64)
+		if err != nil {
+			continue
+		}
+		msg := line[end+2:]
+		var change NagiosStateChange
+		switch {
+		case strings.HasPrefix(msg, "SERVICE ALERT: "):
+			f := strings.SplitN(strings.TrimPrefix(msg, "SERVICE ALERT: "), ";", 6)
+			if len(f) < 6 {
+				continue
+			}
+			change = NagiosStateChange{Host: f[0], Service: f[1], State: f[2], Output: f[5]}
+		case strings.HasPrefix(msg, "HOST ALERT: "):
+			f := strings.SplitN(strings.TrimPrefix(msg, "HOST ALERT: "), ";", 5)
+			if len(f) < 5 {
+				continue
+			}
+			change = NagiosStateChange{Host: f[0], State: f[1], Output: f[4]}
+		default:
+			continue
+		}
+		change.Time = time.Unix(t, 0).UTC()
+		changes = append(changes, change)
+	}
+	return changes, scanner.Err()
+}
+
+// parseNagiosHistory parses the Nagios log files within a tar archive, as
+// dumped by GetNagiosHistoricalData. On error, the state changes parsed so far
+// are returned with the error.
+func parseNagiosHistory(r io.Reader) ([]NagiosStateChange, error) {
+	var changes []NagiosStateChange
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return changes, nil
+		}
+		if err != nil {
+			return changes, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".log") {
+			continue
+		}
+		c, err := parseNagiosLog(tr)
+		changes = append(changes, c...)
+		if err != nil {
+			return changes, err
+		}
+	}
 }
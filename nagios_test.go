@@ -5,12 +5,13 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetNagiosTasks(t *testing.T) {
 	tasks := make(chan Task, 1)
 	runner := &FakeRunner{}
-	GetNagiosTasks(tasks, runner, nil)
+	GetNagiosTasks(tasks, runner, nil, resourceMatchFactory(runner), DefaultConfig.NagiosStatusFile, DefaultConfig.NagiosArchivesDir)
 	task := <-tasks
 
 	want := "Nagios pod could not be found"
@@ -38,7 +39,7 @@ func TestGetNagiosStatusData(t *testing.T) {
 	}
 	for i, tt := range tests {
 		runner := &FakeRunner{}
-		task := GetNagiosStatusData(runner, tt.project, tt.pod)
+		task := GetNagiosStatusData(runner, tt.project, tt.pod, "/var/log/nagios/status.dat")
 		if err := task(); err != nil {
 			t.Errorf("test %d: task() = %v, want %v", i, err, nil)
 		}
@@ -66,7 +67,7 @@ func TestGetNagiosHistoricalData(t *testing.T) {
 	}
 	for i, tt := range tests {
 		runner := &FakeRunner{}
-		task := GetNagiosHistoricalData(runner, tt.project, tt.pod)
+		task := GetNagiosHistoricalData(runner, tt.project, tt.pod, "/var/log/nagios/archives")
 		if err := task(); err != nil {
 			t.Errorf("test %d: task() = %v, want %v", i, err, nil)
 		}
@@ -75,3 +76,21 @@ func TestGetNagiosHistoricalData(t *testing.T) {
 		}
 	}
 }
+
+func TestParseNagiosLog(t *testing.T) {
+	log := "[1483264800] SERVICE ALERT: mongodb;Ping;CRITICAL;SOFT;1;connection refused\n" +
+		"[1483264810] HOST ALERT: mongodb;DOWN;HARD;1;unreachable\n" +
+		"[1483264820] EXTERNAL COMMAND: SCHEDULE_FORCED_SVC_CHECK;mongodb;Ping\n" +
+		"garbage\n"
+	changes, err := parseNagiosLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NagiosStateChange{
+		{Time: time.Unix(1483264800, 0).UTC(), Host: "mongodb", Service: "Ping", State: "CRITICAL", Output: "connection refused"},
+		{Time: time.Unix(1483264810, 0).UTC(), Host: "mongodb", State: "DOWN", Output: "unreachable"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("parseNagiosLog(...) = %+v, want %+v", changes, want)
+	}
+}
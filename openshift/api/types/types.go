@@ -4,6 +4,8 @@
 // https://github.com/openshift/origin/blob/v1.3.0-rc1/pkg/deploy/api/v1/types.go
 package types
 
+import "time"
+
 // TypeMeta describes an individual object in an API response or request
 // with strings representing the type of the object.
 type TypeMeta struct {
@@ -31,9 +33,22 @@ type PodList struct {
 // Pod is a collection of containers that can run on a host.
 type Pod struct {
 	ObjectMeta `json:"metadata,omitempty"`
+	Spec       PodSpec   `json:"spec,omitempty"`
 	Status     PodStatus `json:"status,omitempty"`
 }
 
+// PodSpec is a description of a pod.
+type PodSpec struct {
+	InitContainers []Container `json:"initContainers,omitempty"`
+	Containers     []Container `json:"containers"`
+}
+
+// Container is a single application container that you want to run within a
+// pod.
+type Container struct {
+	Name string `json:"name"`
+}
+
 // EventList is a list of events.
 type EventList struct {
 	Items []Event `json:"items"`
@@ -42,27 +57,48 @@ type EventList struct {
 // Event is a report of an event somewhere in the cluster.
 type Event struct {
 	TypeMeta       `json:",inline"`
+	ObjectMeta     `json:"metadata,omitempty"`
 	InvolvedObject ObjectReference `json:"involvedObject"`
 	Reason         string          `json:"reason,omitempty"`
 	Message        string          `json:"message,omitempty"`
+	FirstTimestamp time.Time       `json:"firstTimestamp,omitempty"`
+	LastTimestamp  time.Time       `json:"lastTimestamp,omitempty"`
 	Count          int32           `json:"count,omitempty"`
 	Type           string          `json:"type,omitempty"`
 }
 
+// PodPhase is a label for the condition of a pod at the current time.
+type PodPhase string
+
+// These are the valid statuses of pods.
+const (
+	PodPending   PodPhase = "Pending"
+	PodRunning   PodPhase = "Running"
+	PodSucceeded PodPhase = "Succeeded"
+	PodFailed    PodPhase = "Failed"
+	PodUnknown   PodPhase = "Unknown"
+)
+
 // PodStatus represents information about the status of a pod.
 type PodStatus struct {
-	ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty"`
+	Phase                 PodPhase          `json:"phase,omitempty"`
+	InitContainerStatuses []ContainerStatus `json:"initContainerStatuses,omitempty"`
+	ContainerStatuses     []ContainerStatus `json:"containerStatuses,omitempty"`
 }
 
 // ContainerStatus contains details for the current status of this container.
 type ContainerStatus struct {
-	Name  string         `json:"name"`
-	State ContainerState `json:"state,omitempty"`
+	Name                 string         `json:"name"`
+	State                ContainerState `json:"state,omitempty"`
+	LastTerminationState ContainerState `json:"lastState,omitempty"`
+	Ready                bool           `json:"ready"`
+	RestartCount         int32          `json:"restartCount"`
 }
 
 // ContainerState holds a possible state of container.
 type ContainerState struct {
-	Waiting *ContainerStateWaiting `json:"waiting,omitempty"`
+	Waiting    *ContainerStateWaiting    `json:"waiting,omitempty"`
+	Terminated *ContainerStateTerminated `json:"terminated,omitempty"`
 }
 
 // ContainerStateWaiting is a waiting state of a container.
@@ -71,6 +107,13 @@ type ContainerStateWaiting struct {
 	Message string `json:"message,omitempty"`
 }
 
+// ContainerStateTerminated is a terminated state of a container.
+type ContainerStateTerminated struct {
+	ExitCode int32  `json:"exitCode"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
 // DeploymentConfigList is a collection of deployment configs.
 type DeploymentConfigList struct {
 	Items []DeploymentConfig `json:"items"`
@@ -87,3 +130,27 @@ type DeploymentConfig struct {
 type DeploymentConfigSpec struct {
 	Replicas int32 `json:"replicas"`
 }
+
+// NodeList is a list of nodes.
+type NodeList struct {
+	Items []Node `json:"items"`
+}
+
+// Node is a worker node in the cluster.
+type Node struct {
+	ObjectMeta `json:"metadata,omitempty"`
+	Status     NodeStatus `json:"status,omitempty"`
+}
+
+// NodeStatus is information about the current status of a node.
+type NodeStatus struct {
+	Conditions []NodeCondition `json:"conditions,omitempty"`
+}
+
+// NodeCondition contains condition information for a node.
+type NodeCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// defaultArchiveName is the default template for the names of dump archives
+// and directories.
+const defaultArchiveName = "{timestamp}"
+
+// archiveNameVar matches variables in archive name templates.
+var archiveNameVar = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// unsafeNameChars matches characters not allowed in expanded variables of
+// archive names.
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// archiveNameVars lists the variables available in archive name templates.
+var archiveNameVars = []string{"timestamp", "cluster"}
+
+// ExpandArchiveName returns the name for a dump archive and directory from
+// template, replacing {name} with vars[name]. Unsafe characters in variables
+// are replaced with underscores. A .tar.gz suffix is removed from the result.
+func ExpandArchiveName(template string, vars map[string]string) (string, error) {
+	var err error
+	name := archiveNameVar.ReplaceAllStringFunc(template, func(s string) string {
+		v := s[1 : len(s)-1]
+		value, ok := vars[v]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("unknown variable %s in archive name, must be one of: {%s}", s, strings.Join(archiveNameVars, "} {"))
+			}
+			return s
+		}
+		return unsafeNameChars.ReplaceAllString(value, "_")
+	})
+	if err != nil {
+		return "", err
+	}
+	name = strings.TrimSuffix(name, ".tar.gz")
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid archive name %q, must be a file name without directories", name)
+	}
+	return name, nil
+}
+
+// usesArchiveNameVar reports whether template uses the named variable.
+func usesArchiveNameVar(template, v string) bool {
+	return strings.Contains(template, "{"+v+"}")
+}
+
+// GetClusterName returns a name for the cluster the current user is logged in
+// to, the host name of its API server.
+func GetClusterName() (string, error) {
+	var stdout bytes.Buffer
+	cmd := exec.Command("oc", "whoami", "--show-server")
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return clusterNameFromServer(strings.TrimSpace(stdout.String()))
+}
+
+// clusterNameFromServer returns the host name of an API server URL.
+func clusterNameFromServer(server string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	// Hosts may have a port, and IPv6 addresses are in brackets.
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" {
+		return "", errors.New("could not find host name in server URL " + server)
+	}
+	return host, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandArchiveName(t *testing.T) {
+	vars := map[string]string{
+		"timestamp": "2017-03-01T10-00-00Z",
+		"cluster":   "master.example.com",
+	}
+	tests := []struct {
+		template string
+		want     string
+		wantErr  string
+	}{
+		{template: "{timestamp}", want: "2017-03-01T10-00-00Z"},
+		{template: "{cluster}-{timestamp}", want: "master.example.com-2017-03-01T10-00-00Z"},
+		{template: "case-1234-{timestamp}.tar.gz", want: "case-1234-2017-03-01T10-00-00Z"},
+		{template: "fixed", want: "fixed"},
+		{template: "{user}", wantErr: "unknown variable {user}"},
+		{template: "dumps/{timestamp}", wantErr: "invalid archive name"},
+		{template: ".tar.gz", wantErr: "invalid archive name"},
+	}
+	for _, tt := range tests {
+		got, err := ExpandArchiveName(tt.template, vars)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExpandArchiveName(%q) error = %v, want %q", tt.template, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ExpandArchiveName(%q) = %q, %v, want %q", tt.template, got, err, tt.want)
+		}
+	}
+
+	// Variables cannot introduce directories.
+	got, err := ExpandArchiveName("{cluster}", map[string]string{"cluster": "../a b/c"})
+	if want := ".._a_b_c"; err != nil || got != want {
+		t.Errorf("ExpandArchiveName() = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestClusterNameFromServer(t *testing.T) {
+	tests := []struct {
+		server, want string
+	}{
+		{"https://master.example.com:8443", "master.example.com"},
+		{"https://master.example.com", "master.example.com"},
+		{"https://[::1]:8443", "::1"},
+		{"https://[::1]", "::1"},
+	}
+	for _, tt := range tests {
+		if got, err := clusterNameFromServer(tt.server); err != nil || got != tt.want {
+			t.Errorf("clusterNameFromServer(%q) = %q, %v, want %q", tt.server, got, err, tt.want)
+		}
+	}
+	if _, err := clusterNameFromServer("master"); err == nil {
+		t.Error("clusterNameFromServer(master) returned no error")
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress reporting modes.
+const (
+	// ProgressAuto selects ProgressTTY when writing to a terminal, and
+	// ProgressPlain otherwise.
+	ProgressAuto = "auto"
+	// ProgressTTY renders a single line that is updated in place.
+	ProgressTTY = "tty"
+	// ProgressPlain writes a line periodically.
+	ProgressPlain = "plain"
+	// ProgressJSON writes a JSON object per line for each progress event,
+	// for use by tools wrapping the dump tool.
+	ProgressJSON = "json"
+	// ProgressNone disables progress reporting.
+	ProgressNone = "none"
+)
+
+// progressModes lists valid progress reporting modes.
+var progressModes = []string{ProgressAuto, ProgressTTY, ProgressPlain, ProgressJSON, ProgressNone}
+
+const (
+	// progressTTYInterval is how often the progress line is redrawn on a
+	// terminal, to keep the elapsed time current.
+	progressTTYInterval = time.Second
+	// progressPlainInterval is how often a progress line is written when
+	// not on a terminal.
+	progressPlainInterval = 10 * time.Second
+)
+
+// A ProgressReporter is notified about the progress of running tasks. Tasks
+// run in phases, e.g. collecting data and analyzing it, and counts are reset
+// at the start of each phase. Methods may be called concurrently.
+type ProgressReporter interface {
+	// Start begins a new phase.
+	Start(phase string)
+	// TaskAdded increments the total number of tasks in the current
+	// phase.
+	TaskAdded()
+	// AllTasksAdded tells that the total number of tasks is final.
+	AllTasksAdded()
+	// TaskDone tells that a task finished, with an eventual error.
+	TaskDone(err error)
+	// CommandStarted and CommandDone surround the execution of external
+	// commands.
+	CommandStarted(args []string)
+	CommandDone(args []string)
+	// Finish ends the current phase.
+	Finish()
+}
+
+// NewProgressReporter returns a ProgressReporter that writes to out in the
+// given mode.
+func NewProgressReporter(out io.Writer, mode string) (ProgressReporter, error) {
+	switch mode {
+	case ProgressAuto:
+		mode = ProgressPlain
+		if isTerminal(out) {
+			mode = ProgressTTY
+		}
+	case ProgressTTY, ProgressPlain, ProgressJSON:
+	case ProgressNone:
+		return nopProgress{}, nil
+	default:
+		return nil, fmt.Errorf("invalid progress mode %q, must be one of: %s", mode, strings.Join(progressModes, " "))
+	}
+	p := &progress{
+		out:   out,
+		mode:  mode,
+		now:   time.Now,
+		width: 80,
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		p.width = n
+	}
+	return p, nil
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// A ProgressEvent is written for each progress event in ProgressJSON mode.
+type ProgressEvent struct {
+	// Event is one of start, task or finish.
+	Event string `json:"event"`
+	Phase string `json:"phase"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	// TotalFinal is false while tasks are still being generated, and
+	// Total may grow.
+	TotalFinal     bool     `json:"totalFinal"`
+	Errors         int      `json:"errors"`
+	ElapsedSeconds float64  `json:"elapsedSeconds"`
+	Running        []string `json:"running,omitempty"`
+	// Error is the error of the finished task, for task events.
+	Error string `json:"error,omitempty"`
+}
+
+// progress is a ProgressReporter that renders progress as text or JSON.
+type progress struct {
+	out   io.Writer
+	mode  string
+	now   func() time.Time
+	width int
+
+	mu      sync.Mutex
+	phase   string
+	start   time.Time
+	total   int
+	done    int
+	errors  int
+	final   bool
+	running []string
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+var _ ProgressReporter = (*progress)(nil)
+
+func (p *progress) Start(phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase = phase
+	p.start = p.now()
+	p.total, p.done, p.errors = 0, 0, 0
+	p.final = false
+	p.running = nil
+	switch p.mode {
+	case ProgressJSON:
+		p.writeEvent("start", "")
+		return
+	case ProgressTTY:
+		p.redraw()
+	}
+	interval := progressPlainInterval
+	if p.mode == ProgressTTY {
+		interval = progressTTYInterval
+	}
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	go p.tick(interval, p.stop, p.stopped)
+}
+
+// tick updates the progress display every interval until stop is closed.
+func (p *progress) tick(interval time.Duration, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.mu.Lock()
+			if p.mode == ProgressTTY {
+				p.redraw()
+			} else {
+				fmt.Fprintln(p.out, p.line())
+			}
+			p.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (p *progress) TaskAdded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total++
+}
+
+func (p *progress) AllTasksAdded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.final = true
+}
+
+func (p *progress) TaskDone(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	var msg string
+	if err != nil {
+		p.errors++
+		msg = err.Error()
+	}
+	switch p.mode {
+	case ProgressJSON:
+		p.writeEvent("task", msg)
+	case ProgressTTY:
+		p.redraw()
+	}
+}
+
+func (p *progress) CommandStarted(args []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = append(p.running, strings.Join(args, " "))
+}
+
+func (p *progress) CommandDone(args []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cmd := strings.Join(args, " ")
+	for i, c := range p.running {
+		if c == cmd {
+			p.running = append(p.running[:i], p.running[i+1:]...)
+			break
+		}
+	}
+}
+
+func (p *progress) Finish() {
+	p.mu.Lock()
+	stop, stopped := p.stop, p.stopped
+	p.stop, p.stopped = nil, nil
+	p.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-stopped
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.final = true
+	p.running = nil
+	switch p.mode {
+	case ProgressJSON:
+		p.writeEvent("finish", "")
+	case ProgressTTY:
+		p.redraw()
+		fmt.Fprintln(p.out)
+	default:
+		fmt.Fprintln(p.out, p.line())
+	}
+}
+
+// line formats the current progress as a line of text, e.g.:
+//
+//	collect: 42/130+ tasks, 1 errors, 1m5s elapsed, running: oc get nodes (+2 more)
+//
+// A plus sign after the total tells that more tasks may be added.
+func (p *progress) line() string {
+	total := strconv.Itoa(p.total)
+	if !p.final {
+		total += "+"
+	}
+	s := fmt.Sprintf("%s: %d/%s tasks, %d errors, %v elapsed", p.phase, p.done, total, p.errors, p.elapsed())
+	if len(p.running) > 0 {
+		s += ", running: " + p.running[0]
+		if len(p.running) > 1 {
+			s += fmt.Sprintf(" (+%d more)", len(p.running)-1)
+		}
+	}
+	return s
+}
+
+// elapsed returns the time since the start of the current phase, without
+// sub-second precision.
+func (p *progress) elapsed() time.Duration {
+	d := p.now().Sub(p.start)
+	return d - d%time.Second
+}
+
+// redraw replaces the current terminal line with the progress line, truncated
+// to the terminal width.
+func (p *progress) redraw() {
+	s := p.line()
+	if len(s) >= p.width {
+		s = s[:p.width-1]
+	}
+	// Return to the beginning of the line, and clear it after the text.
+	fmt.Fprintf(p.out, "\r%s\033[K", s)
+}
+
+// writeEvent writes a progress event as JSON on a line.
+func (p *progress) writeEvent(event, errMsg string) {
+	e := ProgressEvent{
+		Event:          event,
+		Phase:          p.phase,
+		Done:           p.done,
+		Total:          p.total,
+		TotalFinal:     p.final,
+		Errors:         p.errors,
+		ElapsedSeconds: p.now().Sub(p.start).Seconds(),
+		Running:        p.running,
+		Error:          errMsg,
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(p.out, "%s\n", b)
+}
+
+// nopProgress is a ProgressReporter that does nothing.
+type nopProgress struct{}
+
+var _ ProgressReporter = nopProgress{}
+
+func (nopProgress) Start(phase string)           {}
+func (nopProgress) TaskAdded()                   {}
+func (nopProgress) AllTasksAdded()               {}
+func (nopProgress) TaskDone(err error)           {}
+func (nopProgress) CommandStarted(args []string) {}
+func (nopProgress) CommandDone(args []string)    {}
+func (nopProgress) Finish()                      {}
+
+// progressRunner is a Runner that reports the commands it runs.
+type progressRunner struct {
+	runner   Runner
+	progress ProgressReporter
+}
+
+var _ Runner = progressRunner{}
+
+// NewProgressRunner returns a Runner that runs commands with r, reporting them
+// to progress.
+func NewProgressRunner(r Runner, progress ProgressReporter) Runner {
+	return progressRunner{runner: r, progress: progress}
+}
+
+func (r progressRunner) Run(cmd *exec.Cmd, path string) error {
+	r.progress.CommandStarted(cmd.Args)
+	defer r.progress.CommandDone(cmd.Args)
+	return r.runner.Run(cmd, path)
+}
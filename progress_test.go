@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProgress is a ProgressReporter that counts reported events.
+type fakeProgress struct {
+	mu                   sync.Mutex
+	added, done, errors  int
+	final                bool
+	started, commandDone int
+}
+
+func (p *fakeProgress) Start(phase string) {}
+func (p *fakeProgress) Finish()            {}
+
+func (p *fakeProgress) TaskAdded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.added++
+}
+
+func (p *fakeProgress) AllTasksAdded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.final = true
+}
+
+func (p *fakeProgress) TaskDone(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if err != nil {
+		p.errors++
+	}
+}
+
+func (p *fakeProgress) CommandStarted(args []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started++
+}
+
+func (p *fakeProgress) CommandDone(args []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.commandDone++
+}
+
+var _ ProgressReporter = (*fakeProgress)(nil)
+
+func TestRunTasksReportsProgress(t *testing.T) {
+	progress := &fakeProgress{}
+	runner := NewProgressRunner(&FakeRunner{}, progress)
+	tasks := make(chan Task)
+	go func() {
+		defer close(tasks)
+		tasks <- ResourceDefinition(runner, "core", "pods")
+		tasks <- NewError(errors.New("failed"))
+		tasks <- ResourceDefinition(runner, "core", "events")
+	}()
+
+	errs := runTasks(tasks, 2, progress)
+
+	if len(errs) != 1 {
+		t.Errorf("len(errs) = %d, want 1", len(errs))
+	}
+	want := &fakeProgress{added: 3, done: 3, errors: 1, final: true, started: 2, commandDone: 2}
+	if *progress != *want {
+		t.Errorf("progress = %+v, want %+v", progress, want)
+	}
+}
+
+func TestProgressJSON(t *testing.T) {
+	var out bytes.Buffer
+	reporter, err := NewProgressReporter(&out, ProgressJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := reporter.(*progress)
+	start := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	p.now = func() time.Time { return now }
+
+	p.Start("collect")
+	p.TaskAdded()
+	p.TaskAdded()
+	p.CommandStarted([]string{"oc", "get", "nodes"})
+	now = start.Add(1500 * time.Millisecond)
+	p.TaskDone(errors.New("failed"))
+	p.AllTasksAdded()
+	p.CommandDone([]string{"oc", "get", "nodes"})
+	p.TaskDone(nil)
+	now = start.Add(2 * time.Second)
+	p.Finish()
+
+	want := `{"event":"start","phase":"collect","done":0,"total":0,"totalFinal":false,"errors":0,"elapsedSeconds":0}
+{"event":"task","phase":"collect","done":1,"total":2,"totalFinal":false,"errors":1,"elapsedSeconds":1.5,"running":["oc get nodes"],"error":"failed"}
+{"event":"task","phase":"collect","done":2,"total":2,"totalFinal":true,"errors":1,"elapsedSeconds":1.5}
+{"event":"finish","phase":"collect","done":2,"total":2,"totalFinal":true,"errors":1,"elapsedSeconds":2}
+`
+	if got := out.String(); got != want {
+		t.Errorf("output = %s, want %s", got, want)
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	start := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		p    *progress
+		want string
+	}{
+		{
+			p:    &progress{phase: "collect", total: 130, done: 42, errors: 1},
+			want: "collect: 42/130+ tasks, 1 errors, 1m5s elapsed",
+		},
+		{
+			p:    &progress{phase: "analyze", total: 10, done: 10, final: true},
+			want: "analyze: 10/10 tasks, 0 errors, 1m5s elapsed",
+		},
+		{
+			p:    &progress{phase: "collect", total: 3, running: []string{"oc get nodes", "oc get pv", "oc whoami"}},
+			want: "collect: 0/3+ tasks, 0 errors, 1m5s elapsed, running: oc get nodes (+2 more)",
+		},
+	}
+	for _, tt := range tests {
+		tt.p.start = start
+		tt.p.now = func() time.Time { return start.Add(65*time.Second + 300*time.Millisecond) }
+		if got := tt.p.line(); got != tt.want {
+			t.Errorf("line() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNewProgressReporter(t *testing.T) {
+	var out bytes.Buffer
+	for _, mode := range progressModes {
+		if _, err := NewProgressReporter(&out, mode); err != nil {
+			t.Errorf("NewProgressReporter(&out, %q) = %v, want nil error", mode, err)
+		}
+	}
+	// A bytes.Buffer is not a terminal.
+	if p, _ := NewProgressReporter(&out, ProgressAuto); p.(*progress).mode != ProgressPlain {
+		t.Errorf("auto mode = %q, want %q", p.(*progress).mode, ProgressPlain)
+	}
+	if _, err := NewProgressReporter(&out, "dots"); err == nil || !strings.Contains(err.Error(), "invalid progress mode") {
+		t.Errorf("NewProgressReporter(&out, %q) = %v, want invalid progress mode error", "dots", err)
+	}
+}
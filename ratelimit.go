@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Classes of expensive commands, with separate concurrency limits.
+const (
+	ExecClass = "exec"
+	LogsClass = "logs"
+	AdmClass  = "adm"
+)
+
+// commandClass returns the class of an oc command, or an empty string for
+// commands that are not limited by class.
+func commandClass(args []string) string {
+	_, _, positional := parseOcArgs(args)
+	if len(positional) == 0 {
+		return ""
+	}
+	switch positional[0] {
+	case "exec", "rsh":
+		return ExecClass
+	case "logs":
+		return LogsClass
+	case "adm":
+		return AdmClass
+	}
+	return ""
+}
+
+// A RateLimiter limits the rate at which commands start, and how many
+// commands of each class run concurrently, so as not to overload the API
+// server. It is safe for concurrent use.
+type RateLimiter struct {
+	// rate is the number of commands per second, and burst how many
+	// commands can start at once after a period of inactivity. Zero rate
+	// means no rate limit.
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// classes holds a semaphore for each class with a concurrency limit.
+	classes map[string]chan struct{}
+
+	// now and sleep are replaced in tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter allowing qps commands per second with
+// bursts of up to burst commands, and up to classLimits[class] concurrent
+// commands of each class. Zero qps or class limits mean no limit.
+func NewRateLimiter(qps float64, burst int, classLimits map[string]int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &RateLimiter{
+		rate:    qps,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		classes: make(map[string]chan struct{}),
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+	for class, n := range classLimits {
+		if n > 0 {
+			l.classes[class] = make(chan struct{}, n)
+		}
+	}
+	return l
+}
+
+// Acquire blocks until a command with the given arguments may run. The
+// returned function must be called when the command finishes.
+func (l *RateLimiter) Acquire(args []string) (release func()) {
+	release = func() {}
+	// Wait for the class limit first, so that waiting for a rate limit
+	// token does not take from other commands a slot they could use.
+	if sem, ok := l.classes[commandClass(args)]; ok {
+		sem <- struct{}{}
+		release = func() { <-sem }
+	}
+	l.wait()
+	return release
+}
+
+// wait blocks until a token is available in the bucket, and takes it.
+func (l *RateLimiter) wait() {
+	if l.rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	// Take the token now, possibly going into debt, and wait until the
+	// debt is paid off. Later callers wait for their own token after it.
+	l.tokens--
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if d > 0 {
+		l.sleep(d)
+	}
+}
+
+// limitRunner is a Runner that waits for a RateLimiter before running
+// commands.
+type limitRunner struct {
+	runner  Runner
+	limiter *RateLimiter
+}
+
+var _ Runner = limitRunner{}
+
+// NewLimitRunner returns a Runner that runs commands with r as allowed by
+// limiter. A limiter can be shared by multiple runners.
+func NewLimitRunner(r Runner, limiter *RateLimiter) Runner {
+	return limitRunner{runner: r, limiter: limiter}
+}
+
+func (r limitRunner) Run(cmd *exec.Cmd, path string) error {
+	release := r.limiter.Acquire(cmd.Args)
+	defer release()
+	return r.runner.Run(cmd, path)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommandClass(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"oc", "-n", "core", "exec", "redis-1-abcde", "--", "redis-cli", "INFO"}, ExecClass},
+		{[]string{"oc", "-n", "core", "logs", "pods/a", "-c", "c", "--tail", "10"}, LogsClass},
+		{[]string{"oc", "adm", "diagnostics"}, AdmClass},
+		{[]string{"oc", "get", "nodes", "-o=json"}, ""},
+		// The command run by oc exec does not matter.
+		{[]string{"oc", "-n", "core", "get", "pods", "--", "logs"}, ""},
+	}
+	for _, tt := range tests {
+		if got := commandClass(tt.args); got != tt.want {
+			t.Errorf("commandClass(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterRate(t *testing.T) {
+	l := NewRateLimiter(2, 2, nil)
+	now := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	l.now = func() time.Time { return now }
+	l.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	// The burst is allowed right away, then commands are spread at the
+	// given rate.
+	for i := 0; i < 4; i++ {
+		l.Acquire([]string{"oc", "get", "pods"})()
+	}
+	want := []time.Duration{500 * time.Millisecond, time.Second}
+	if !reflect.DeepEqual(slept, want) {
+		t.Errorf("slept %v, want %v", slept, want)
+	}
+
+	// After a while, the bucket is full again, but not above the burst.
+	now = now.Add(time.Minute)
+	slept = nil
+	for i := 0; i < 3; i++ {
+		l.Acquire([]string{"oc", "get", "pods"})()
+	}
+	want = []time.Duration{500 * time.Millisecond}
+	if !reflect.DeepEqual(slept, want) {
+		t.Errorf("slept %v, want %v", slept, want)
+	}
+}
+
+func TestRateLimiterClassLimit(t *testing.T) {
+	l := NewRateLimiter(0, 0, map[string]int{ExecClass: 1})
+	exec := []string{"oc", "-n", "core", "exec", "pod", "--", "true"}
+
+	release := l.Acquire(exec)
+	// Other classes are not limited.
+	l.Acquire([]string{"oc", "get", "pods"})()
+
+	acquired := make(chan struct{})
+	go func() {
+		l.Acquire(exec)()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second exec command started while the first is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second exec command did not start after the first finished")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// defaultRedactReplacement replaces matches of redaction rules without a
+// replacement.
+const defaultRedactReplacement = "[REDACTED]"
+
+// A RedactRule replaces all matches of a regular expression in collected
+// output.
+type RedactRule struct {
+	Pattern string `json:"pattern"`
+	// Replacement may refer to submatches, as in regexp.Regexp.Expand,
+	// e.g. "$1=[REDACTED]". Empty means defaultRedactReplacement.
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// A Redactor applies redaction rules to text.
+type Redactor struct {
+	patterns     []*regexp.Regexp
+	replacements [][]byte
+}
+
+// NewRedactor returns a Redactor for the given rules, or nil if there are no
+// rules.
+func NewRedactor(rules []RedactRule) (*Redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	r := &Redactor{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern: %v", err)
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = defaultRedactReplacement
+		}
+		r.patterns = append(r.patterns, re)
+		r.replacements = append(r.replacements, []byte(replacement))
+	}
+	return r, nil
+}
+
+// Redact returns b with all rules applied in order.
+func (r *Redactor) Redact(b []byte) []byte {
+	for i, re := range r.patterns {
+		b = re.ReplaceAll(b, r.replacements[i])
+	}
+	return b
+}
+
+// redactWriter is an io.Writer that redacts text line by line before writing
+// it to w. Flush must be called to write a last line without a newline.
+type redactWriter struct {
+	w        io.Writer
+	redactor *Redactor
+	buf      []byte
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := w.w.Write(w.redactor.Redact(w.buf[:i+1])); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the buffered text.
+func (w *redactWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.redactor.Redact(w.buf))
+	w.buf = nil
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor([]RedactRule{
+		{Pattern: `(?i)(password|secret)=\S+`, Replacement: "$1=***"},
+		{Pattern: `\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}\b`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"password=abc secret=def", "password=*** secret=***"},
+		{"PASSWORD=abc", "PASSWORD=***"},
+		{"connecting to 10.1.2.3:27017", "connecting to [REDACTED]:27017"},
+		{"nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		if got := string(r.Redact([]byte(tt.in))); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	if r, err := NewRedactor(nil); r != nil || err != nil {
+		t.Errorf("NewRedactor(nil) = %v, %v, want nil, nil", r, err)
+	}
+	if _, err := NewRedactor([]RedactRule{{Pattern: "("}}); err == nil {
+		t.Error("NewRedactor(invalid pattern) returned no error")
+	}
+}
+
+func TestRedactWriter(t *testing.T) {
+	r, err := NewRedactor([]RedactRule{{Pattern: `token=\w+`, Replacement: "token=***"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	w := &redactWriter{w: &b, redactor: r}
+	// Matches split across writes are redacted.
+	for _, s := range []string{"a tok", "en=abc\nb token", "=def\nc token=ghi"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := b.String(), "a token=***\nb token=***\n"; got != want {
+		t.Errorf("before Flush, wrote %q, want %q", got, want)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "a token=***\nb token=***\nc token=***"; got != want {
+		t.Errorf("after Flush, wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GetRedisTasks sends tasks to dump the output of redis-cli INFO from all Redis
+// pods in all projects.
+func GetRedisTasks(tasks chan<- Task, runner Runner, projects []string, resourceFactory ResourceMatchFactory) {
+	for _, p := range projects {
+		pods, err := resourceFactory(p, "pod", "redis")
+		if err != nil {
+			tasks <- NewError(err)
+			continue
+		}
+		for _, pod := range pods {
+			tasks <- GetRedisInfo(runner, p, pod)
+		}
+	}
+}
+
+// GetRedisInfo is a task factory for tasks that fetch Redis information and
+// statistics from the given pod in project.
+func GetRedisInfo(r Runner, project, pod string) Task {
+	return func() error {
+		cmd := exec.Command("oc", "-n", project, "exec", pod, "--", "redis-cli", "INFO")
+		path := filepath.Join("projects", project, "redis", pod+"_info")
+		return MarkErrorAsIgnorable(r.Run(cmd, path))
+	}
+}
+
+// CacheStats holds the statistics dumped from a Redis or memcached pod, keyed
+// by statistic name.
+type CacheStats struct {
+	Project string
+	Pod     string
+	Stats   map[string]string
+}
+
+// Int returns the named statistic as an integer. Missing or non-numeric
+// statistics are reported as 0.
+func (s CacheStats) Int(name string) int64 {
+	n, _ := strconv.ParseInt(s.Stats[name], 10, 64)
+	return n
+}
+
+// loadCacheStats loads statistics from all files with the given suffix under
+// the named directory of project. The pod name is the file name without the
+// suffix.
+func loadCacheStats(basepath, project, dir, suffix string, parse func(io.Reader) (map[string]string, error)) ([]CacheStats, error) {
+	paths, err := filepath.Glob(filepath.Join(basepath, "projects", project, dir, "*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	var all []CacheStats
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		stats, err := parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(stats) == 0 {
+			continue
+		}
+		all = append(all, CacheStats{
+			Project: project,
+			Pod:     strings.TrimSuffix(filepath.Base(path), suffix),
+			Stats:   stats,
+		})
+	}
+	return all, nil
+}
+
+// parseRedisInfo parses the output of redis-cli INFO. Section headers and
+// blank lines are skipped.
+func parseRedisInfo(r io.Reader) (map[string]string, error) {
+	stats := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		stats[line[:i]] = line[i+1:]
+	}
+	return stats, scanner.Err()
+}
+
+// CheckRedis checks Redis statistics for evicted keys, rejected connections,
+// memory usage reaching the configured limit and persistence failures.
+func CheckRedis(all []CacheStats) CheckResult {
+	result := CheckResult{
+		CheckName: "check Redis status",
+		Ok:        true,
+		Message:   "this issue was not detected",
+	}
+	report := func(s CacheStats, format string, a ...interface{}) {
+		result.Ok = false
+		result.Message = "one or more Redis instances have problems"
+		result.Info = append(result.Info, Info{
+			Name:      s.Pod,
+			Namespace: s.Project,
+			Message:   fmt.Sprintf("redis in pod %s: ", s.Pod) + fmt.Sprintf(format, a...),
+		})
+	}
+	for _, s := range all {
+		if n := s.Int("evicted_keys"); n > 0 {
+			report(s, "%d keys were evicted due to the maxmemory limit", n)
+		}
+		if n := s.Int("rejected_connections"); n > 0 {
+			report(s, "%d connections were rejected due to the maxclients limit", n)
+		}
+		if max := s.Int("maxmemory"); max > 0 && s.Int("used_memory") >= max {
+			report(s, "used memory (%d bytes) reached maxmemory (%d bytes)", s.Int("used_memory"), max)
+		}
+		if status, ok := s.Stats["rdb_last_bgsave_status"]; ok && status != "ok" {
+			report(s, "last RDB save failed with status %q", status)
+		}
+		if s.Stats["aof_enabled"] == "1" {
+			for _, name := range []string{"aof_last_bgrewrite_status", "aof_last_write_status"} {
+				if status, ok := s.Stats[name]; ok && status != "ok" {
+					report(s, "%s is %q", name, status)
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetRedisTasks(t *testing.T) {
+	tasks := make(chan Task, 1)
+	runner := &FakeRunner{}
+
+	GetRedisTasks(tasks, runner, []string{"project1"}, func(project, resource, substr string) ([]string, error) {
+		return []string{"redis-1-abcde"}, nil
+	})
+
+	task := <-tasks
+	if err := task(); err != nil {
+		t.Fatal(err)
+	}
+	expectedCalls := []RunCall{
+		{
+			[]string{"oc", "-n", "project1", "exec", "redis-1-abcde", "--", "redis-cli", "INFO"},
+			filepath.Join("projects", "project1", "redis", "redis-1-abcde_info"),
+		},
+	}
+	if !reflect.DeepEqual(runner.Calls, expectedCalls) {
+		t.Errorf("runner.Calls = %q, want %q", runner.Calls, expectedCalls)
+	}
+}
+
+func TestParseRedisInfo(t *testing.T) {
+	info := "# Server\r\nredis_version:2.8.21\r\n\r\n# Stats\r\nevicted_keys:0\r\nrdb_last_bgsave_status:ok\r\n"
+	got, err := parseRedisInfo(strings.NewReader(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"redis_version":          "2.8.21",
+		"evicted_keys":           "0",
+		"rdb_last_bgsave_status": "ok",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRedisInfo() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckRedis(t *testing.T) {
+	tests := []struct {
+		description string
+		stats       map[string]string
+		wantInfo    []string
+	}{
+		{
+			description: "healthy",
+			stats: map[string]string{
+				"evicted_keys":           "0",
+				"rejected_connections":   "0",
+				"maxmemory":              "0",
+				"used_memory":            "1024",
+				"rdb_last_bgsave_status": "ok",
+				"aof_enabled":            "0",
+			},
+		},
+		{
+			description: "evictions and rejected connections",
+			stats: map[string]string{
+				"evicted_keys":         "12",
+				"rejected_connections": "3",
+			},
+			wantInfo: []string{
+				"redis in pod redis-1-abcde: 12 keys were evicted due to the maxmemory limit",
+				"redis in pod redis-1-abcde: 3 connections were rejected due to the maxclients limit",
+			},
+		},
+		{
+			description: "maxmemory reached",
+			stats: map[string]string{
+				"maxmemory":   "1024",
+				"used_memory": "1030",
+			},
+			wantInfo: []string{
+				"redis in pod redis-1-abcde: used memory (1030 bytes) reached maxmemory (1024 bytes)",
+			},
+		},
+		{
+			description: "persistence failures",
+			stats: map[string]string{
+				"rdb_last_bgsave_status":    "err",
+				"aof_enabled":               "1",
+				"aof_last_bgrewrite_status": "ok",
+				"aof_last_write_status":     "err",
+			},
+			wantInfo: []string{
+				`redis in pod redis-1-abcde: last RDB save failed with status "err"`,
+				`redis in pod redis-1-abcde: aof_last_write_status is "err"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := CheckRedis([]CacheStats{{Project: "core", Pod: "redis-1-abcde", Stats: tt.stats}})
+		if got.Ok != (len(tt.wantInfo) == 0) {
+			t.Errorf("%s: Ok = %v, want %v", tt.description, got.Ok, len(tt.wantInfo) == 0)
+		}
+		var gotInfo []string
+		for _, info := range got.Info {
+			gotInfo = append(gotInfo, info.Message)
+		}
+		if !reflect.DeepEqual(gotInfo, tt.wantInfo) {
+			t.Errorf("%s: Info = %q, want %q", tt.description, gotInfo, tt.wantInfo)
+		}
+	}
+}
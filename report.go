@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats of the analysis report.
+const (
+	// ReportText is a human-readable list of issues.
+	ReportText = "text"
+	// ReportJSON lists the results of all checks, loosely following SARIF.
+	ReportJSON = "json"
+	// ReportJUnit maps projects to test suites and checks to test cases.
+	ReportJUnit = "junit"
+	// ReportMarkdown is a table of the results of all checks per project.
+	ReportMarkdown = "markdown"
+)
+
+// reportFormats lists the valid report formats.
+var reportFormats = []string{ReportText, ReportJSON, ReportJUnit, ReportMarkdown}
+
+// platformSuite is the name given to platform-wide checks in reports, in
+// place of a project name.
+const platformSuite = "platform"
+
+// ValidateReportFormat returns an error if format is not a valid report
+// format.
+func ValidateReportFormat(format string) error {
+	for _, f := range reportFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid report format %q, must be one of: %s", format, strings.Join(reportFormats, ", "))
+}
+
+// WriteReport writes analysisResult to out in the given format. The text
+// format lists only issues, the other formats all checks.
+func WriteReport(analysisResult AnalysisResult, format string, out io.Writer) error {
+	switch format {
+	case ReportText:
+		PrintAnalysisReport(analysisResult, out)
+		return nil
+	case ReportJSON:
+		return writeJSONReport(analysisResult, out)
+	case ReportJUnit:
+		return writeJUnitReport(analysisResult, out)
+	case ReportMarkdown:
+		return writeMarkdownReport(analysisResult, out)
+	}
+	return ValidateReportFormat(format)
+}
+
+// reportSuite is a group of check results, platform-wide or of a project.
+type reportSuite struct {
+	name    string
+	results []CheckResult
+}
+
+// reportSuites returns the check results of analysisResult grouped by
+// project, with platform-wide checks first.
+func reportSuites(analysisResult AnalysisResult) []reportSuite {
+	var suites []reportSuite
+	if len(analysisResult.Platform) > 0 {
+		suites = append(suites, reportSuite{platformSuite, analysisResult.Platform})
+	}
+	for _, p := range analysisResult.Projects {
+		suites = append(suites, reportSuite{p.Project, p.Results})
+	}
+	return suites
+}
+
+// checkDetails returns a line for each piece of information and event
+// attached to a check result.
+func checkDetails(result CheckResult) []string {
+	var details []string
+	for _, info := range result.Info {
+		details = append(details, strings.TrimSpace(info.Message))
+	}
+	for _, event := range result.Events {
+		details = append(details, eventDetail(event))
+	}
+	return details
+}
+
+// eventDetail describes an event on a single line.
+func eventDetail(event CheckEvent) string {
+	s := strings.TrimSpace(event.Message)
+	if event.Reason != "" {
+		s = event.Reason + ": " + s
+	}
+	if event.Kind != "" || event.Name != "" {
+		s = fmt.Sprintf("%s %s/%s: %s", event.Kind, event.Namespace, event.Name, s)
+	}
+	if event.Count > 1 {
+		s += fmt.Sprintf(" (x%d)", event.Count)
+	}
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+// checkTestName returns the name of a check in reports, its ID if known.
+func checkTestName(result CheckResult) string {
+	if result.CheckID != "" {
+		return result.CheckID
+	}
+	return result.CheckName
+}
+
+// jsonReport is the JSON report format. Like SARIF, it lists results with a
+// rule ID, level and locations, but is flat and simpler to consume.
+type jsonReport struct {
+	Version string             `json:"version"`
+	Tool    jsonReportTool     `json:"tool"`
+	Summary jsonReportSummary  `json:"summary"`
+	Results []jsonReportResult `json:"results"`
+}
+
+type jsonReportTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type jsonReportSummary struct {
+	Checks int `json:"checks"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+}
+
+type jsonReportResult struct {
+	RuleID    string               `json:"ruleId"`
+	Name      string               `json:"name"`
+	Project   string               `json:"project,omitempty"`
+	Kind      string               `json:"kind"`
+	Level     string               `json:"level"`
+	Severity  Severity             `json:"severity,omitempty"`
+	Message   string               `json:"message"`
+	HelpURI   string               `json:"helpUri,omitempty"`
+	Locations []jsonReportLocation `json:"locations,omitempty"`
+}
+
+type jsonReportLocation struct {
+	Namespace string `json:"namespace,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Message   string `json:"message"`
+}
+
+// sarifLevel maps severities to SARIF levels.
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityCritical:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "note"
+}
+
+func writeJSONReport(analysisResult AnalysisResult, out io.Writer) error {
+	report := jsonReport{
+		Version: "1",
+		Tool:    jsonReportTool{Name: "fh-system-dump-tool", Version: Version},
+		Results: []jsonReportResult{},
+	}
+	for _, suite := range reportSuites(analysisResult) {
+		for _, r := range suite.results {
+			result := jsonReportResult{
+				RuleID:   checkTestName(r),
+				Name:     r.CheckName,
+				Kind:     "pass",
+				Level:    "none",
+				Severity: r.Severity,
+				Message:  r.Message,
+				HelpURI:  r.DocURL,
+			}
+			if suite.name != platformSuite {
+				result.Project = suite.name
+			}
+			report.Summary.Checks++
+			if r.Ok {
+				report.Summary.Passed++
+			} else {
+				report.Summary.Failed++
+				result.Kind = "fail"
+				result.Level = sarifLevel(r.Severity)
+			}
+			for _, info := range r.Info {
+				result.Locations = append(result.Locations, jsonReportLocation{
+					Namespace: info.Namespace,
+					Name:      info.Name,
+					Message:   strings.TrimSpace(info.Message),
+				})
+			}
+			for _, event := range r.Events {
+				result.Locations = append(result.Locations, jsonReportLocation{
+					Namespace: event.Namespace,
+					Kind:      event.Kind,
+					Name:      event.Name,
+					Message:   eventDetail(event),
+				})
+			}
+			report.Results = append(report.Results, result)
+		}
+	}
+	b, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(b, '\n'))
+	return err
+}
+
+// JUnit XML elements, as understood by common CI servers.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnitReport(analysisResult AnalysisResult, out io.Writer) error {
+	report := junitTestSuites{Name: "fh-system-dump-tool"}
+	for _, suite := range reportSuites(analysisResult) {
+		ts := junitTestSuite{Name: suite.name}
+		for _, r := range suite.results {
+			tc := junitTestCase{Name: checkTestName(r), ClassName: suite.name}
+			if !r.Ok {
+				text := r.CheckName + "\n"
+				for _, detail := range checkDetails(r) {
+					text += "  " + detail + "\n"
+				}
+				if r.DocURL != "" {
+					text += "See: " + r.DocURL + "\n"
+				}
+				tc.Failure = &junitFailure{Message: r.Message, Type: string(r.Severity), Text: text}
+				ts.Failures++
+			}
+			ts.Tests++
+			ts.Cases = append(ts.Cases, tc)
+		}
+		report.Tests += ts.Tests
+		report.Failures += ts.Failures
+		report.Suites = append(report.Suites, ts)
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// markdownEscaper escapes text placed in Markdown table cells.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ", "*", `\*`, "_", `\_`, "`", "\\`")
+
+func writeMarkdownReport(analysisResult AnalysisResult, out io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("# RHMAP System Dump Analysis\n")
+	suites := reportSuites(analysisResult)
+	if len(suites) == 0 {
+		b.WriteString("\nNo checks were run.\n")
+	}
+	for _, suite := range suites {
+		if suite.name == platformSuite {
+			b.WriteString("\n## Platform\n\n")
+		} else {
+			fmt.Fprintf(&b, "\n## Project %s\n\n", markdownEscaper.Replace(suite.name))
+		}
+		b.WriteString("| Check | Severity | Result |\n|---|---|---|\n")
+		var failed []CheckResult
+		for _, r := range suite.results {
+			status := "passed"
+			if !r.Ok {
+				status = "**failed**: " + markdownEscaper.Replace(r.Message)
+				failed = append(failed, r)
+			}
+			name := markdownEscaper.Replace(r.CheckName)
+			if r.DocURL != "" {
+				name = fmt.Sprintf("[%s](%s)", name, r.DocURL)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", name, r.Severity, status)
+		}
+		for _, r := range failed {
+			details := checkDetails(r)
+			if len(details) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "\n### %s\n\n", markdownEscaper.Replace(r.CheckName))
+			for _, detail := range details {
+				fmt.Fprintf(&b, "- %s\n", markdownEscaper.Replace(detail))
+			}
+		}
+	}
+	_, err := b.WriteTo(out)
+	return err
+}
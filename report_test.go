@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var reportFixture = AnalysisResult{
+	Platform: []CheckResult{
+		{CheckID: "cluster", CheckName: "check cluster", Severity: SeverityInfo, Ok: true, Message: "this issue was not detected"},
+	},
+	Projects: []ProjectResult{
+		{
+			Project: "core",
+			Results: []CheckResult{
+				{CheckID: "events", CheckName: "check event log for errors", Severity: SeverityWarning, Ok: false, Message: "errors detected in event log", Events: []CheckEvent{newCheckEvent(warningEvent)}},
+				{CheckID: "dc-replicas", CheckName: "check number of replicas in deployment configs", Severity: SeverityCritical, Ok: true, Message: "this issue was not detected"},
+			},
+		},
+		{
+			Project: "mbaas",
+			Results: []CheckResult{
+				{
+					CheckID:   "dc-replicas",
+					CheckName: "check number of replicas in deployment configs",
+					Severity:  SeverityCritical,
+					DocURL:    "https://example.com/dc-replicas",
+					Ok:        false,
+					Message:   "one or more deployment configs has number of replicas set to 0",
+					Info:      []Info{{Name: "fh-mbaas", Namespace: "mbaas", Message: "the replica parameter is set to 0 | fix it"}},
+				},
+			},
+		},
+	},
+}
+
+func TestWriteReportJUnit(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteReport(reportFixture, ReportJUnit, &b); err != nil {
+		t.Fatal(err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, b.String())
+	}
+	if got.Tests != 4 || got.Failures != 2 || len(got.Suites) != 3 {
+		t.Fatalf("tests, failures, suites = %d, %d, %d, want 4, 2, 3", got.Tests, got.Failures, len(got.Suites))
+	}
+	var names []string
+	for _, s := range got.Suites {
+		names = append(names, s.Name)
+	}
+	if want := []string{"platform", "core", "mbaas"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("suites = %q, want %q", names, want)
+	}
+	core := got.Suites[1]
+	if core.Tests != 2 || core.Failures != 1 || core.Cases[0].Name != "events" || core.Cases[0].ClassName != "core" || core.Cases[1].Failure != nil {
+		t.Errorf("core suite = %+v", core)
+	}
+	failure := core.Cases[0].Failure
+	if failure == nil || failure.Message != "errors detected in event log" || failure.Type != "warning" || !strings.Contains(failure.Text, "Pod qe-3node-4-1/mongodb-2-1-x66za: FailedSync: Error syncing pod") {
+		t.Errorf("failure = %+v", failure)
+	}
+	if text := got.Suites[2].Cases[0].Failure.Text; !strings.Contains(text, "See: https://example.com/dc-replicas") {
+		t.Errorf("failure text = %q, want documentation link", text)
+	}
+}
+
+func TestWriteReportJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteReport(reportFixture, ReportJSON, &b); err != nil {
+		t.Fatal(err)
+	}
+	var got jsonReport
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (jsonReportSummary{Checks: 4, Passed: 2, Failed: 2}); got.Summary != want {
+		t.Errorf("summary = %+v, want %+v", got.Summary, want)
+	}
+	var levels []string
+	for _, r := range got.Results {
+		levels = append(levels, r.Project+":"+r.RuleID+":"+r.Kind+":"+r.Level)
+	}
+	want := []string{":cluster:pass:none", "core:events:fail:warning", "core:dc-replicas:pass:none", "mbaas:dc-replicas:fail:error"}
+	if !reflect.DeepEqual(levels, want) {
+		t.Errorf("results = %q, want %q", levels, want)
+	}
+	if locs := got.Results[3].Locations; len(locs) != 1 || locs[0].Name != "fh-mbaas" || locs[0].Namespace != "mbaas" {
+		t.Errorf("locations = %+v", locs)
+	}
+
+	// Results are never null, so that consumers can iterate them.
+	b.Reset()
+	if err := WriteReport(AnalysisResult{}, ReportJSON, &b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"results": []`) {
+		t.Errorf("empty report = %s, want empty results", b.String())
+	}
+}
+
+func TestWriteReportMarkdown(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteReport(reportFixture, ReportMarkdown, &b); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+	for _, want := range []string{
+		"# RHMAP System Dump Analysis\n",
+		"\n## Platform\n",
+		"\n## Project core\n\n| Check | Severity | Result |\n|---|---|---|\n",
+		"| check event log for errors | warning | **failed**: errors detected in event log |\n",
+		"| [check number of replicas in deployment configs](https://example.com/dc-replicas) | critical | **failed**: ",
+		"- the replica parameter is set to 0 \\| fix it\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriteReportText(t *testing.T) {
+	var got, want bytes.Buffer
+	if err := WriteReport(reportFixture, ReportText, &got); err != nil {
+		t.Fatal(err)
+	}
+	PrintAnalysisReport(reportFixture, &want)
+	if got.String() != want.String() {
+		t.Errorf("text report = %q, want %q", got.String(), want.String())
+	}
+}
+
+func TestValidateReportFormat(t *testing.T) {
+	for _, f := range reportFormats {
+		if err := ValidateReportFormat(f); err != nil {
+			t.Errorf("ValidateReportFormat(%q) = %v", f, err)
+		}
+	}
+	if err := WriteReport(reportFixture, "sarif", &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "must be one of: text, json, junit, markdown") {
+		t.Errorf("WriteReport(sarif) error = %v", err)
+	}
+}
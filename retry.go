@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os/exec"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A RetryPolicy tells which command failures are transient and how to retry
+// them.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a command is retried after a
+	// transient failure. Zero disables retries.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry. The delay doubles
+	// for each retry, up to MaxBackoff. A random jitter of up to half the
+	// delay is subtracted, so that concurrent tasks do not retry in
+	// lockstep.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// TransientPatterns match the stderr of transient failures.
+	TransientPatterns []*regexp.Regexp
+	// TransientExitCodes are exit codes of transient failures.
+	TransientExitCodes []int
+}
+
+// DefaultRetryPolicy retries failures caused by the API server or the
+// network being temporarily unavailable.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     2,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	TransientPatterns: []*regexp.Regexp{
+		regexp.MustCompile(`TLS handshake timeout`),
+		regexp.MustCompile(`unable to upgrade connection`),
+		regexp.MustCompile(`\(ServiceUnavailable\)|503 Service Unavailable`),
+		regexp.MustCompile(`the server is currently unable to handle the request`),
+		regexp.MustCompile(`the server was unable to return a response in the time allotted`),
+		regexp.MustCompile(`i/o timeout`),
+		regexp.MustCompile(`connection reset by peer`),
+		regexp.MustCompile(`http2: server sent GOAWAY`),
+	},
+}
+
+// Transient reports whether err is the failure of a command that is likely to
+// succeed if retried.
+func (p RetryPolicy) Transient(err error) bool {
+	cerr := findCommandError(err)
+	if cerr == nil {
+		return false
+	}
+	for _, re := range p.TransientPatterns {
+		if re.MatchString(cerr.Stderr) {
+			return true
+		}
+	}
+	if code, ok := exitCode(cerr.Err); ok {
+		for _, c := range p.TransientExitCodes {
+			if c == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before the given retry, counting from 1. Jitter
+// is a random number in [0, 1).
+func (p RetryPolicy) Backoff(retry int, jitter float64) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d - time.Duration(jitter*float64(d/2))
+}
+
+// exitCode returns the exit code of a command from the error returned by
+// exec.Cmd.Run.
+func exitCode(err error) (int, bool) {
+	eerr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+	status, ok := eerr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 0, false
+	}
+	return status.ExitStatus(), true
+}
+
+// A RetryRecord describes a command that was retried.
+type RetryRecord struct {
+	Command []string `json:"command"`
+	// Path is where the output of the command was written, relative to
+	// the dump or snapshot directory.
+	Path string `json:"path"`
+	// Errors lists the error of each failed attempt.
+	Errors    []string `json:"errors"`
+	Attempts  int      `json:"attempts"`
+	Succeeded bool     `json:"succeeded"`
+}
+
+// A RetryLog records the commands that were retried. It is safe for
+// concurrent use.
+type RetryLog struct {
+	mu      sync.Mutex
+	records []RetryRecord
+}
+
+func (l *RetryLog) add(r RetryRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, r)
+}
+
+// Records returns the records in the order the commands finished.
+func (l *RetryLog) Records() []RetryRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]RetryRecord(nil), l.records...)
+}
+
+// WriteFile writes the records as JSON to path.
+func (l *RetryLog) WriteFile(path string) error {
+	records := l.Records()
+	if records == nil {
+		records = []RetryRecord{}
+	}
+	b, err := json.MarshalIndent(records, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0660)
+}
+
+// RetryRunner is a Runner that retries commands failing with transient errors,
+// with exponential backoff.
+type RetryRunner struct {
+	runner Runner
+	policy RetryPolicy
+	log    *RetryLog
+
+	// sleep and jitter are replaced in tests.
+	sleep  func(time.Duration)
+	jitter func() float64
+}
+
+var _ Runner = (*RetryRunner)(nil)
+
+// NewRetryRunner returns a Runner that runs commands with r, retrying them
+// according to policy. Retried commands are recorded in log, if not nil.
+func NewRetryRunner(r Runner, policy RetryPolicy, log *RetryLog) *RetryRunner {
+	return &RetryRunner{
+		runner: r,
+		policy: policy,
+		log:    log,
+		sleep:  time.Sleep,
+		jitter: rand.Float64,
+	}
+}
+
+// Run runs cmd with the underlying runner, retrying transient failures. Since
+// a command can only run once, each attempt runs a copy of cmd. The stdin of
+// cmd is read once and replayed to every attempt. Output meant for the
+// original stdout and stderr of cmd is buffered and only written for the last
+// attempt.
+func (r *RetryRunner) Run(cmd *exec.Cmd, path string) error {
+	var stdin []byte
+	if cmd.Stdin != nil {
+		var err error
+		if stdin, err = ioutil.ReadAll(cmd.Stdin); err != nil {
+			return err
+		}
+	}
+	var record *RetryRecord
+	for attempt := 1; ; attempt++ {
+		c, stdout, stderr := copyCommand(cmd, stdin)
+		err := r.runner.Run(c, path)
+		last := err == nil || attempt > r.policy.MaxRetries || !r.policy.Transient(err)
+		if last {
+			if cmd.Stdout != nil {
+				io.Copy(cmd.Stdout, stdout)
+			}
+			if cmd.Stderr != nil {
+				io.Copy(cmd.Stderr, stderr)
+			}
+		}
+		if record != nil {
+			record.Attempts = attempt
+			if err != nil {
+				record.Errors = append(record.Errors, err.Error())
+			}
+		}
+		if last {
+			if record != nil && r.log != nil {
+				record.Succeeded = err == nil
+				r.log.add(*record)
+			}
+			return err
+		}
+		if record == nil {
+			record = &RetryRecord{Command: cmd.Args, Path: path, Attempts: attempt, Errors: []string{err.Error()}}
+		}
+		r.sleep(r.policy.Backoff(attempt, r.jitter()))
+	}
+}
+
+// copyCommand returns a copy of cmd that has not run yet. If cmd has stdin, the
+// copy reads stdin from the given contents instead. If cmd has stdout or
+// stderr writers, the copy writes to the returned buffers instead.
+func copyCommand(cmd *exec.Cmd, stdin []byte) (c *exec.Cmd, stdout, stderr *bytes.Buffer) {
+	// exec.Command looks the executable up again, so that the copy fails
+	// to start as cmd would if it was not found.
+	c = exec.Command(cmd.Args[0], cmd.Args[1:]...)
+	c.Env = cmd.Env
+	c.Dir = cmd.Dir
+	c.ExtraFiles = cmd.ExtraFiles
+	c.SysProcAttr = cmd.SysProcAttr
+	if cmd.Stdin != nil {
+		c.Stdin = bytes.NewReader(stdin)
+	}
+	if cmd.Stdout != nil {
+		stdout = new(bytes.Buffer)
+		c.Stdout = stdout
+	}
+	if cmd.Stderr != nil {
+		stderr = new(bytes.Buffer)
+		c.Stderr = stderr
+	}
+	return c, stdout, stderr
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyRunner is a Runner that fails with the given stderr until it ran a
+// number of times.
+type flakyRunner struct {
+	failures int
+	stderr   string
+	runs     int
+}
+
+func (r *flakyRunner) Run(cmd *exec.Cmd, path string) error {
+	r.runs++
+	if cmd.Stdout != nil {
+		fmt.Fprintf(cmd.Stdout, "attempt %d", r.runs)
+	}
+	if r.runs <= r.failures {
+		return &CommandError{Args: cmd.Args, Path: path, Err: errors.New("exit status 1"), Stderr: r.stderr}
+	}
+	return nil
+}
+
+func TestRetryRunner(t *testing.T) {
+	const transient = "Unable to connect to the server: net/http: TLS handshake timeout"
+	tests := []struct {
+		runner    *flakyRunner
+		wantErr   bool
+		wantOut   string
+		wantSleep []time.Duration
+		wantLog   []RetryRecord
+	}{
+		{
+			runner:  &flakyRunner{},
+			wantOut: "attempt 1",
+		},
+		{
+			runner:    &flakyRunner{failures: 2, stderr: transient},
+			wantOut:   "attempt 3",
+			wantSleep: []time.Duration{time.Second, 2 * time.Second},
+			wantLog: []RetryRecord{{
+				Command: []string{"oc", "get", "nodes"},
+				Path:    "definitions/nodes.json",
+				Errors: []string{
+					`command "oc get nodes": exit status 1: ` + transient,
+					`command "oc get nodes": exit status 1: ` + transient,
+				},
+				Attempts:  3,
+				Succeeded: true,
+			}},
+		},
+		{
+			runner:    &flakyRunner{failures: 5, stderr: transient},
+			wantErr:   true,
+			wantOut:   "attempt 3",
+			wantSleep: []time.Duration{time.Second, 2 * time.Second},
+			wantLog: []RetryRecord{{
+				Command: []string{"oc", "get", "nodes"},
+				Path:    "definitions/nodes.json",
+				Errors: []string{
+					`command "oc get nodes": exit status 1: ` + transient,
+					`command "oc get nodes": exit status 1: ` + transient,
+					`command "oc get nodes": exit status 1: ` + transient,
+				},
+				Attempts: 3,
+			}},
+		},
+		{
+			runner:  &flakyRunner{failures: 1, stderr: `Error from server (NotFound): pods "x" not found`},
+			wantErr: true,
+			wantOut: "attempt 1",
+		},
+	}
+	for i, tt := range tests {
+		log := &RetryLog{}
+		r := NewRetryRunner(tt.runner, DefaultRetryPolicy, log)
+		var slept []time.Duration
+		r.sleep = func(d time.Duration) { slept = append(slept, d) }
+		r.jitter = func() float64 { return 0 }
+
+		cmd := exec.Command("oc", "get", "nodes")
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		err := r.Run(cmd, "definitions/nodes.json")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: Run() = %v, want error: %v", i, err, tt.wantErr)
+		}
+		if got := out.String(); got != tt.wantOut {
+			t.Errorf("#%d: stdout = %q, want %q", i, got, tt.wantOut)
+		}
+		if !reflect.DeepEqual(slept, tt.wantSleep) {
+			t.Errorf("#%d: slept %v, want %v", i, slept, tt.wantSleep)
+		}
+		if got := log.Records(); !reflect.DeepEqual(got, tt.wantLog) {
+			t.Errorf("#%d: log.Records() = %+v, want %+v", i, got, tt.wantLog)
+		}
+	}
+}
+
+// stdinRunner is a Runner that records the stdin of every run, failing with a
+// transient error the first time.
+type stdinRunner struct {
+	stdin []string
+	attrs []*syscall.SysProcAttr
+}
+
+func (r *stdinRunner) Run(cmd *exec.Cmd, path string) error {
+	b, _ := ioutil.ReadAll(cmd.Stdin)
+	r.stdin = append(r.stdin, string(b))
+	r.attrs = append(r.attrs, cmd.SysProcAttr)
+	if len(r.stdin) == 1 {
+		return &CommandError{Args: cmd.Args, Path: path, Err: errors.New("exit status 1"), Stderr: "Unable to connect to the server: net/http: TLS handshake timeout"}
+	}
+	return nil
+}
+
+func TestRetryRunnerStdin(t *testing.T) {
+	runner := &stdinRunner{}
+	r := NewRetryRunner(runner, DefaultRetryPolicy, nil)
+	r.sleep = func(time.Duration) {}
+
+	cmd := exec.Command("oc", "exec", "-i", "mongodb-1", "--", "mongo")
+	cmd.Stdin = strings.NewReader("rs.status()")
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if err := r.Run(cmd, "projects/mbaas/mongodb/status"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"rs.status()", "rs.status()"}; !reflect.DeepEqual(runner.stdin, want) {
+		t.Errorf("stdin of attempts = %q, want %q", runner.stdin, want)
+	}
+	for i, attr := range runner.attrs {
+		if attr != cmd.SysProcAttr {
+			t.Errorf("attempt %d: SysProcAttr = %v, want %v", i+1, attr, cmd.SysProcAttr)
+		}
+	}
+}
+
+func TestCopyCommandNotFound(t *testing.T) {
+	cmd := exec.Command("fh-system-dump-tool-no-such-command")
+	want := exec.Command("fh-system-dump-tool-no-such-command").Run()
+	c, _, _ := copyCommand(cmd, nil)
+	// The copy fails to start as the original would, with the error
+	// looking up the executable.
+	if err := c.Run(); err == nil || want == nil || err.Error() != want.Error() {
+		t.Errorf("copy of a command not found: Run() = %v, want %v", err, want)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := []struct {
+		retry  int
+		jitter float64
+		want   time.Duration
+	}{
+		{1, 0, time.Second},
+		{2, 0, 2 * time.Second},
+		{3, 0, 4 * time.Second},
+		{4, 0, 5 * time.Second},
+		{100, 0, 5 * time.Second},
+		{2, 0.5, 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := p.Backoff(tt.retry, tt.jitter); got != tt.want {
+			t.Errorf("Backoff(%d, %v) = %v, want %v", tt.retry, tt.jitter, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("TLS handshake timeout"), false},
+		{&CommandError{Err: errors.New("exit status 1"), Stderr: "error: unable to upgrade connection: container not found"}, true},
+		{MarkErrorAsIgnorable(&CommandError{Err: errors.New("exit status 1"), Stderr: "Error from server (ServiceUnavailable): the server is currently unable to handle the request"}), true},
+		{newTaskError("logs", &CommandError{Err: errors.New("exit status 1"), Stderr: "read tcp 10.0.0.1:443: i/o timeout"}), true},
+		{&CommandError{Err: errors.New("exit status 1"), Stderr: "error: previous terminated container not found"}, false},
+	}
+	for _, tt := range tests {
+		if got := DefaultRetryPolicy.Transient(tt.err); got != tt.want {
+			t.Errorf("Transient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
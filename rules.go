@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Rule is a declarative analysis check. It selects objects from the
+// definitions of a kind of resource and reports the objects that match all of
+// its conditions. Rules are written in JSON, e.g.:
+//
+//	{
+//	  "id": "pvc-not-bound",
+//	  "title": "check persistent volume claims are bound",
+//	  "severity": "critical",
+//	  "kind": "persistentvolumeclaims",
+//	  "select": "{.items[*]}",
+//	  "where": [{"path": "{.status.phase}", "op": "!=", "value": "Bound"}],
+//	  "message": "persistent volume claim {.metadata.name} is {.status.phase}"
+//	}
+type Rule struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Severity    Severity `json:"severity"`
+	DocURL      string   `json:"docURL,omitempty"`
+	// Kind is the kind of resource definitions the rule applies to, e.g.
+	// pods or events.
+	Kind string `json:"kind"`
+	// Select is a path to the objects to be verified, e.g. {.items[*]}.
+	Select string `json:"select"`
+	// Where lists conditions that must all be true for an object to be
+	// reported.
+	Where []RuleCondition `json:"where"`
+	// Summary is the message of failed check results. Defaults to the
+	// rule title.
+	Summary string `json:"summary,omitempty"`
+	// Message describes each reported object. Paths in curly braces are
+	// replaced with values from the object.
+	Message string `json:"message"`
+}
+
+// A RuleCondition compares the values found at a path within an object. The
+// condition is true if any of the values satisfies the comparison.
+type RuleCondition struct {
+	// Path is relative to the selected object, e.g.
+	// {.status.containerStatuses[*].restartCount}.
+	Path string `json:"path"`
+	// Op is one of ==, !=, <, <=, >, >=, =~ (matches regular expression),
+	// !~ (does not match regular expression), exists or notExists.
+	Op    string      `json:"op"`
+	Value interface{} `json:"value,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// ruleOps lists valid comparison operators.
+var ruleOps = []string{"==", "!=", "<", "<=", ">", ">=", "=~", "!~", "exists", "notExists"}
+
+// rulePlaceholder matches paths within rule messages.
+var rulePlaceholder = regexp.MustCompile(`\{\.[^}]*\}`)
+
+// ParseRules parses a list of rules from JSON and validates them.
+func ParseRules(b []byte) ([]*Rule, error) {
+	var rules []*Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// LoadRulesDir loads rules from all JSON files in dir.
+func LoadRulesDir(dir string) ([]*Rule, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var rules []*Rule
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		r, err := ParseRules(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		rules = append(rules, r...)
+	}
+	return rules, nil
+}
+
+// RegisterRules registers rules as checks in registry. It is an error if a
+// check with the same ID as a rule is already registered.
+func RegisterRules(registry *CheckRegistry, rules []*Rule) error {
+	for _, rule := range rules {
+		if registry.Get(rule.ID) != nil {
+			return fmt.Errorf("rule %q: a check with the same ID already exists", rule.ID)
+		}
+		registry.Register(ruleCheck{rule})
+	}
+	return nil
+}
+
+// compile validates the rule and prepares its regular expressions.
+func (r *Rule) compile() error {
+	if r.ID == "" || r.Kind == "" || r.Select == "" {
+		return fmt.Errorf("rule %q: id, kind and select are required", r.ID)
+	}
+	if r.Title == "" {
+		r.Title = r.ID
+	}
+	if r.Summary == "" {
+		r.Summary = r.Title
+	}
+	if r.Severity.Rank() == 0 {
+		return fmt.Errorf("rule %q: invalid severity %q", r.ID, r.Severity)
+	}
+	for i := range r.Where {
+		c := &r.Where[i]
+		if !contains(ruleOps, c.Op) {
+			return fmt.Errorf("rule %q: invalid operator %q, must be one of: %s", r.ID, c.Op, strings.Join(ruleOps, " "))
+		}
+		if c.Op == "=~" || c.Op == "!~" {
+			s, ok := c.Value.(string)
+			if !ok {
+				return fmt.Errorf("rule %q: operator %s requires a string value", r.ID, c.Op)
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return fmt.Errorf("rule %q: %v", r.ID, err)
+			}
+			c.re = re
+		}
+	}
+	return nil
+}
+
+// ruleCheck is a Check implemented by a Rule.
+type ruleCheck struct {
+	rule *Rule
+}
+
+var _ Check = ruleCheck{}
+
+func (c ruleCheck) ID() string          { return c.rule.ID }
+func (c ruleCheck) Title() string       { return c.rule.Title }
+func (c ruleCheck) Description() string { return c.rule.Description }
+func (c ruleCheck) Severity() Severity  { return c.rule.Severity }
+func (c ruleCheck) Requires() []string  { return []string{c.rule.Kind} }
+func (c ruleCheck) DocURL() string      { return c.rule.DocURL }
+
+// Run evaluates the rule against the definitions of its kind in the project.
+// The rule is not applicable if they were not collected.
+func (c ruleCheck) Run(env CheckEnv) (CheckResult, error) {
+	var doc interface{}
+	env.Definition.Load(c.rule.Kind, &doc)
+	if err := env.Definition.Err(); err != nil {
+		if os.IsNotExist(err) {
+			return CheckResult{}, errNotApplicable
+		}
+		return CheckResult{}, err
+	}
+	return c.rule.Evaluate(doc), nil
+}
+
+// Evaluate runs the rule against a resource definition document.
+func (r *Rule) Evaluate(doc interface{}) CheckResult {
+	result := CheckResult{
+		CheckName: r.Title,
+		Ok:        true,
+		Message:   "this issue was not detected",
+	}
+	for _, obj := range evalPath(doc, r.Select) {
+		if !r.matches(obj) {
+			continue
+		}
+		result.Ok = false
+		result.Message = r.Summary
+		result.Info = append(result.Info, Info{
+			Name:      formatValues(evalPath(obj, "{.metadata.name}")),
+			Namespace: formatValues(evalPath(obj, "{.metadata.namespace}")),
+			Message:   expandRuleMessage(r.Message, obj),
+		})
+	}
+	return result
+}
+
+// matches reports whether obj satisfies all conditions of the rule.
+func (r *Rule) matches(obj interface{}) bool {
+	for _, c := range r.Where {
+		if !c.matches(evalPath(obj, c.Path)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether any of values satisfies the condition.
+func (c RuleCondition) matches(values []interface{}) bool {
+	switch c.Op {
+	case "exists":
+		return len(values) > 0
+	case "notExists":
+		return len(values) == 0
+	case "!=", "!~":
+		// Missing values are different from anything.
+		if len(values) == 0 {
+			return true
+		}
+	}
+	for _, v := range values {
+		if c.compare(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare applies the condition operator to v and the condition value.
+func (c RuleCondition) compare(v interface{}) bool {
+	switch c.Op {
+	case "=~":
+		return c.re.MatchString(formatValue(v))
+	case "!~":
+		return !c.re.MatchString(formatValue(v))
+	case "==":
+		return equalValues(v, c.Value)
+	case "!=":
+		return !equalValues(v, c.Value)
+	}
+	a, aok := toFloat(v)
+	b, bok := toFloat(c.Value)
+	if !aok || !bok {
+		return false
+	}
+	switch c.Op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// equalValues compares JSON values, treating numbers and their string
+// representation as equal.
+func equalValues(a, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return af == bf
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	return formatValue(a) == formatValue(b)
+}
+
+// toFloat converts JSON numbers and numeric strings to float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// evalPath evaluates a simplified JSONPath expression against v, returning all
+// values found. The supported syntax is a sequence of field names separated by
+// dots, each optionally followed by an index [n] or a wildcard [*], optionally
+// enclosed in curly braces, e.g. {.items[*].metadata.name}.
+func evalPath(v interface{}, path string) []interface{} {
+	path = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(path), "{"), "}")
+	path = strings.TrimPrefix(path, ".")
+	values := []interface{}{v}
+	if path == "" {
+		return values
+	}
+	for _, step := range strings.Split(path, ".") {
+		field, index := step, ""
+		if i := strings.Index(step, "["); i >= 0 && strings.HasSuffix(step, "]") {
+			field, index = step[:i], step[i+1:len(step)-1]
+		}
+		var next []interface{}
+		for _, v := range values {
+			if field != "" {
+				m, ok := v.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if v, ok = m[field]; !ok {
+					continue
+				}
+			}
+			if index == "" {
+				next = append(next, v)
+				continue
+			}
+			list, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			if index == "*" {
+				next = append(next, list...)
+				continue
+			}
+			if i, err := strconv.Atoi(index); err == nil && i >= 0 && i < len(list) {
+				next = append(next, list[i])
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// expandRuleMessage replaces paths in curly braces within msg with values from
+// obj.
+func expandRuleMessage(msg string, obj interface{}) string {
+	return rulePlaceholder.ReplaceAllStringFunc(msg, func(path string) string {
+		return formatValues(evalPath(obj, path))
+	})
+}
+
+// formatValues formats a list of values as a comma-separated string.
+func formatValues(values []interface{}) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = formatValue(v)
+	}
+	return strings.Join(s, ",")
+}
+
+// formatValue formats a JSON value as a string. Strings are not quoted.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func init() {
+	rules, err := ParseRules([]byte(defaultRules))
+	if err != nil {
+		panic(fmt.Sprintf("invalid default rules: %v", err))
+	}
+	if err := RegisterRules(DefaultChecks, rules); err != nil {
+		panic(err)
+	}
+}
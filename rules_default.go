@@ -0,0 +1,49 @@
+package main
+
+// defaultRules are the rules built into the dump tool. More rules can be
+// loaded from files with the -rules-dir flag.
+const defaultRules = `[
+  {
+    "id": "pvc-not-bound",
+    "title": "check persistent volume claims are bound",
+    "description": "Looks for persistent volume claims that are not bound to a persistent volume. Pods using such claims cannot start.",
+    "severity": "critical",
+    "docURL": "https://github.com/feedhenry/fh-system-dump-tool#check-persistent-volume-claims-are-bound",
+    "kind": "persistentvolumeclaims",
+    "select": "{.items[*]}",
+    "where": [
+      {"path": "{.status.phase}", "op": "!=", "value": "Bound"}
+    ],
+    "summary": "one or more persistent volume claims are not bound",
+    "message": "persistent volume claim {.metadata.name} is in phase {.status.phase}"
+  },
+  {
+    "id": "pods-restarting",
+    "title": "check pods for containers restarting frequently",
+    "description": "Looks for containers that restarted more than 5 times, usually due to crashes or failing liveness probes.",
+    "severity": "warning",
+    "docURL": "https://github.com/feedhenry/fh-system-dump-tool#check-pods-for-containers-restarting-frequently",
+    "kind": "pods",
+    "select": "{.items[*]}",
+    "where": [
+      {"path": "{.status.containerStatuses[*].restartCount}", "op": ">", "value": 5}
+    ],
+    "summary": "one or more pods have containers restarting frequently",
+    "message": "pod {.metadata.name} has containers restarting frequently, restart counts: {.status.containerStatuses[*].restartCount}"
+  },
+  {
+    "id": "pods-failed",
+    "title": "check pods in failed phase",
+    "description": "Looks for pods in which all containers terminated and at least one of them failed.",
+    "severity": "warning",
+    "docURL": "https://github.com/feedhenry/fh-system-dump-tool#check-pods-in-failed-phase",
+    "kind": "pods",
+    "select": "{.items[*]}",
+    "where": [
+      {"path": "{.status.phase}", "op": "==", "value": "Failed"}
+    ],
+    "summary": "one or more pods have failed",
+    "message": "pod {.metadata.name} failed: {.status.reason} {.status.message}"
+  }
+]
+`
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvalPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{"items": [{"metadata": {"name": "a"}, "ports": [1, 2]}, {"metadata": {"name": "b"}}]}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{"{.items[*].metadata.name}", []interface{}{"a", "b"}},
+		{".items[1].metadata.name", []interface{}{"b"}},
+		{"items[0].ports[*]", []interface{}{1.0, 2.0}},
+		{"{.items[*].ports[5]}", nil},
+		{"{.missing.field}", nil},
+		{"{}", []interface{}{doc}},
+	}
+	for _, tt := range tests {
+		if got := evalPath(doc, tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("evalPath(%q) = %#v, want %#v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRuleEvaluate(t *testing.T) {
+	rules, err := ParseRules([]byte(`[{
+		"id": "test",
+		"title": "test rule",
+		"severity": "warning",
+		"kind": "pods",
+		"select": "{.items[*]}",
+		"where": [
+			{"path": "{.status.containerStatuses[*].restartCount}", "op": ">=", "value": 3},
+			{"path": "{.metadata.name}", "op": "=~", "value": "^fh-"}
+		],
+		"message": "pod {.metadata.name} restarted {.status.containerStatuses[*].restartCount} times"
+	}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc interface{}
+	pods := `{"items": [
+		{"metadata": {"name": "fh-mbaas-1", "namespace": "mbaas"}, "status": {"containerStatuses": [{"restartCount": 0}, {"restartCount": 4}]}},
+		{"metadata": {"name": "fh-mbaas-2", "namespace": "mbaas"}, "status": {"containerStatuses": [{"restartCount": 1}]}},
+		{"metadata": {"name": "mongodb-1", "namespace": "mbaas"}, "status": {"containerStatuses": [{"restartCount": 9}]}}
+	]}`
+	if err := json.Unmarshal([]byte(pods), &doc); err != nil {
+		t.Fatal(err)
+	}
+	got := rules[0].Evaluate(doc)
+	want := CheckResult{
+		CheckName: "test rule",
+		Ok:        false,
+		Message:   "test rule",
+		Info: []Info{
+			{Name: "fh-mbaas-1", Namespace: "mbaas", Message: "pod fh-mbaas-1 restarted 0,4 times"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Evaluate() = \n%#v, want \n%#v", got, want)
+	}
+}
+
+func TestRuleConditionOps(t *testing.T) {
+	tests := []struct {
+		op     string
+		value  interface{}
+		values []interface{}
+		want   bool
+	}{
+		{"==", "Bound", []interface{}{"Bound"}, true},
+		{"==", 3.0, []interface{}{"3"}, true},
+		{"!=", "Bound", []interface{}{"Pending"}, true},
+		{"!=", "Bound", nil, true},
+		{"<", 2.0, []interface{}{1.0}, true},
+		{"<=", 2.0, []interface{}{3.0}, false},
+		{">", 2.0, []interface{}{"abc"}, false},
+		{"=~", "^Crash", []interface{}{"CrashLoopBackOff"}, true},
+		{"!~", "^Crash", []interface{}{"ImagePullBackOff"}, true},
+		{"exists", nil, []interface{}{false}, true},
+		{"notExists", nil, nil, true},
+	}
+	for _, tt := range tests {
+		r := &Rule{ID: "x", Kind: "pods", Select: "{}", Severity: SeverityInfo, Where: []RuleCondition{{Op: tt.op, Value: tt.value}}}
+		if err := r.compile(); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Where[0].matches(tt.values); got != tt.want {
+			t.Errorf("%q %v %v = %v, want %v", tt.op, tt.value, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	tests := []struct {
+		rules string
+		want  string
+	}{
+		{`[{"id": "a", "severity": "info", "select": "{}"}]`, "required"},
+		{`[{"id": "a", "kind": "pods", "select": "{}", "severity": "fatal"}]`, "invalid severity"},
+		{`[{"id": "a", "kind": "pods", "select": "{}", "severity": "info", "where": [{"op": "~"}]}]`, "invalid operator"},
+		{`[{"id": "a", "kind": "pods", "select": "{}", "severity": "info", "where": [{"op": "=~", "value": "("}]}]`, "missing closing )"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseRules([]byte(tt.rules)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseRules(%s) error = %v, want %q", tt.rules, err, tt.want)
+		}
+	}
+}
+
+func TestLoadRulesDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-rules-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rules := `[{"id": "custom", "title": "custom rule", "severity": "info", "kind": "services", "select": "{.items[*]}", "message": "{.metadata.name}"}]`
+	if err := ioutil.WriteFile(filepath.Join(dir, "custom.json"), []byte(rules), 0660); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRulesDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := &CheckRegistry{}
+	if err := RegisterRules(registry, loaded); err != nil {
+		t.Fatal(err)
+	}
+	c := registry.Get("custom")
+	if c == nil {
+		t.Fatal("rule was not registered")
+	}
+	if got, want := c.Requires(), []string{"services"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Requires() = %q, want %q", got, want)
+	}
+	if err := RegisterRules(registry, loaded); err == nil {
+		t.Error("RegisterRules() with duplicate ID error = nil, want error")
+	}
+
+	env := CheckEnv{
+		Project: "core",
+		Definition: fakeDefinitionLoader{
+			"services": map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"metadata": map[string]interface{}{"name": "fh-ngui"}},
+				},
+			},
+		},
+	}
+	result, err := c.Run(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ok || len(result.Info) != 1 || result.Info[0].Message != "fh-ngui" {
+		t.Errorf("Run() = %#v, want one failure for fh-ngui", result)
+	}
+}
+
+func TestRuleCheckNotCollected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-rules-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	definitions := filepath.Join(dir, "projects", "core", "definitions")
+	if err := os.MkdirAll(definitions, 0770); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(definitions, "pods.json"), []byte(`{"items": []}`), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	c := ruleCheck{&Rule{ID: "widgets", Title: "check widgets", Kind: "widgets", Select: "{.items[*]}"}}
+	env := newCheckEnv(dir, "core")
+	env.Definition = env.NewDefinition()
+	if _, err := c.Run(env); err != errNotApplicable {
+		t.Errorf("Run() error = %v, want %v", err, errNotApplicable)
+	}
+
+	// Rules on kinds that were not collected do not affect other checks.
+	results := make(chan AnalysisResult, 1)
+	task := CheckProjectTask([]Check{c, DefaultChecks.Get("pods-waiting")}, newCheckEnv(dir, "core"), results)
+	if err := task(); err != nil {
+		t.Errorf("task() = %v, want nil", err)
+	}
+	if result := <-results; len(result.Projects[0].Results) != 1 || result.Projects[0].Results[0].CheckID != "pods-waiting" {
+		t.Errorf("result = %#v, want only pods-waiting", result)
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	for _, id := range []string{"pvc-not-bound", "pods-restarting", "pods-failed"} {
+		if DefaultChecks.Get(id) == nil {
+			t.Errorf("default rule %q is not registered", id)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 // A Runner runs commands.
@@ -19,6 +20,15 @@ type Runner interface {
 // DumpRunner is a Runner that dumps command execution output to disk.
 type DumpRunner struct {
 	dir string
+
+	// Timeout, if positive, limits how long commands may run. Commands
+	// running longer are killed.
+	Timeout time.Duration
+	// Redactor, if not nil, redacts the output written to disk. Tar
+	// archives are written unchanged.
+	Redactor *Redactor
+	// Checksums, if not nil, records the checksums of the files written.
+	Checksums *Checksums
 }
 
 var _ Runner = (*DumpRunner)(nil)
@@ -50,23 +60,74 @@ func (r *DumpRunner) Run(cmd *exec.Cmd, path string) error {
 	defer stdout.Close()
 
 	var pathStderr = path + ".stderr"
+	// Remove stderr of a previous run of the same command, which would
+	// otherwise be left behind if this run has no stderr.
+	if err := os.Remove(filepath.Join(r.dir, pathStderr)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	stderr := &lazyFileWriter{path: filepath.Join(r.dir, pathStderr)}
 	defer stderr.Close()
 
-	cmd.Stdout = io.MultiWriter(filterWriters(cmd.Stdout, stdout)...)
-	cmd.Stderr = io.MultiWriter(filterWriters(cmd.Stderr, stderr)...)
+	var (
+		out, errOut io.Writer = stdout, stderr
+		flush                 = func() {}
+	)
+	if r.Checksums != nil {
+		hashedOut, hashedErr := newHashWriter(stdout), newHashWriter(stderr)
+		out, errOut = hashedOut, hashedErr
+		defer func() {
+			r.Checksums.Set(stdout.Name(), hashedOut.Sum())
+			if stderr.file != nil {
+				r.Checksums.Set(stderr.path, hashedErr.Sum())
+			} else {
+				r.Checksums.Delete(stderr.path)
+			}
+		}()
+	}
+	if r.Redactor != nil && filepath.Ext(path) != ".tar" {
+		redactedOut := &redactWriter{w: out, redactor: r.Redactor}
+		redactedErr := &redactWriter{w: errOut, redactor: r.Redactor}
+		out, errOut = redactedOut, redactedErr
+		flush = func() {
+			redactedOut.Flush()
+			redactedErr.Flush()
+		}
+	}
+
+	cmd.Stdout = io.MultiWriter(filterWriters(cmd.Stdout, out)...)
+	cmd.Stderr = io.MultiWriter(filterWriters(cmd.Stderr, errOut)...)
 
-	if err := cmd.Run(); err != nil {
+	err = r.run(cmd)
+	flush()
+	if err != nil {
 		var b []byte
 		if stderr.file != nil {
 			stderr.file.Seek(0, os.SEEK_SET)
 			b, _ = ioutil.ReadAll(stderr.file)
 		}
-		return fmt.Errorf("command %q: %s: %s", strings.Join(cmd.Args, " "), err, b)
+		return &CommandError{Args: cmd.Args, Path: path, Err: err, Stderr: string(b)}
 	}
 	return nil
 }
 
+// run runs cmd, killing it if it runs longer than r.Timeout.
+func (r *DumpRunner) run(cmd *exec.Cmd) error {
+	if r.Timeout <= 0 {
+		return cmd.Run()
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(r.Timeout, func() {
+		cmd.Process.Kill()
+	})
+	err := cmd.Wait()
+	if !timer.Stop() {
+		return fmt.Errorf("timed out after %v", r.Timeout)
+	}
+	return err
+}
+
 // filterWriters filters out nil writers.
 func filterWriters(writers ...io.Writer) []io.Writer {
 	ws := make([]io.Writer, len(writers))
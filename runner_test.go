@@ -11,6 +11,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Use `go test -tree` to debug DumpRunner tests.
@@ -68,9 +69,13 @@ func TestDumpRunner(t *testing.T) {
 	names = append(names, "out2", "out2.stderr")
 	contents = append(contents, "", "some stderr text\n")
 
-	if err := dr.Run(cmd, names[len(names)-2]); err == nil || !strings.Contains(err.Error(), wantErrMsg) {
+	err = dr.Run(cmd, names[len(names)-2])
+	if err == nil || !strings.Contains(err.Error(), wantErrMsg) {
 		t.Errorf("Run(\"stderrfail\") = %v, want %v", err, wantErrMsg)
 	}
+	if cerr, ok := err.(*CommandError); !ok || cerr.Path != "out2" {
+		t.Errorf("Run(\"stderrfail\") = %#v, want *CommandError with Path %q", err, "out2")
+	}
 	if err := dirHasExactFiles(dir, names, contents); err != nil {
 		t.Error(err)
 	}
@@ -102,6 +107,110 @@ func TestDumpRunner(t *testing.T) {
 	}
 }
 
+func TestDumpRunnerTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-dumprunner-timeout-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dr := NewDumpRunner(dir)
+	// Leave a large margin for fast commands, the helper process can be
+	// slow to start and exit, especially with the race detector.
+	dr.Timeout = 30 * time.Second
+
+	if err := dr.Run(helperCommand("echo", "ok"), "fast"); err != nil {
+		t.Errorf("Run(fast command) = %v, want nil", err)
+	}
+	dr.Timeout = time.Second
+	cmd := helperCommand("sleep", "60s")
+	start := time.Now()
+	err = dr.Run(cmd, "slow")
+	if err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Errorf("Run(slow command) = %v, want timeout error", err)
+	}
+	if _, ok := err.(*CommandError); !ok {
+		t.Errorf("Run(slow command) = %T, want *CommandError", err)
+	}
+	if d := time.Since(start); d > 30*time.Second {
+		t.Errorf("Run(slow command) took %v, want it killed after the timeout", d)
+	}
+}
+
+func TestDumpRunnerRedactor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-dumprunner-redactor-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dr := NewDumpRunner(dir)
+	dr.Redactor, err = NewRedactor([]RedactRule{{Pattern: `password=\S+`, Replacement: "password=***"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The original stdout of the command is not redacted, only what is
+	// written to disk.
+	cmd := helperCommand("echo", "password=secret")
+	var b bytes.Buffer
+	cmd.Stdout = &b
+	if err := dr.Run(cmd, "out"); err != nil {
+		t.Fatal(err)
+	}
+	// Tar archives are binary data, and are not redacted.
+	if err := dr.Run(helperCommand("echo", "password=secret"), "out.tar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dirHasExactFiles(dir, []string{"out", "out.tar"}, []string{"password=***\n", "password=secret\n"}); err != nil {
+		t.Error(err)
+	}
+	if got, want := b.String(), "password=secret\n"; got != want {
+		t.Errorf("original stdout = %q, want %q", got, want)
+	}
+}
+
+func TestDumpRunnerChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-dumprunner-checksums-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dr := NewDumpRunner(dir)
+	dr.Checksums = NewChecksums()
+	dr.Redactor, err = NewRedactor([]RedactRule{{Pattern: `secret`, Replacement: "***"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dr.Run(helperCommand("echo", "secret"), "out"); err != nil {
+		t.Fatal(err)
+	}
+	dr.Run(helperCommand("stderrfail"), "fail")
+
+	// Checksums are of what is written to disk.
+	for _, name := range []string{"out", "fail", "fail.stderr"} {
+		want, err := fileSHA256(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := dr.Checksums.Get(filepath.Join(dir, name)); got != want {
+			t.Errorf("checksum of %s = %q, %v, want %q", name, got, ok, want)
+		}
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "out")); string(b) != "***\n" {
+		t.Errorf("out = %q, want redacted output", b)
+	}
+
+	// A rerun without stderr forgets the checksum of the old stderr file.
+	if err := dr.Run(helperCommand("echo", "ok"), "fail"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dr.Checksums.Get(filepath.Join(dir, "fail.stderr")); ok {
+		t.Error("checksum of removed stderr file kept")
+	}
+}
+
 func tree(dir string) string {
 	b, _ := exec.Command("tree", "-Fah", dir).CombinedOutput()
 	return string(b)
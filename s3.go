@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the size of the parts of S3 multipart uploads. All parts but
+// the last must be at least 5 MiB.
+const s3PartSize = 16 << 20
+
+// uploadStateExt is appended to the path of an archive to get the path of the
+// file recording an unfinished S3 upload, used to resume it.
+const uploadStateExt = ".upload"
+
+// emptySHA256 is the hex-encoded SHA-256 checksum of no data.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Credentials are the credentials used to sign S3 requests.
+type s3Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// s3Uploader uploads to an S3-compatible object store with multipart uploads,
+// using path-style URLs so that any endpoint works.
+type s3Uploader struct {
+	client   *http.Client
+	endpoint *url.URL
+	region   string
+	bucket   string
+	key      string
+	creds    s3Credentials
+	partSize int64
+	now      func() time.Time
+	sleep    func(time.Duration)
+}
+
+var _ Uploader = (*s3Uploader)(nil)
+
+// uploadState records an unfinished S3 upload.
+type uploadState struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"uploadId"`
+}
+
+// s3Part is a part of a multipart upload.
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+// Upload uploads the file at path in parts, retrying failed requests. While
+// the upload is unfinished, its ID is saved next to the file so that running
+// Upload again skips the parts already uploaded. The MD5 checksum of each
+// part is sent in the Content-MD5 header and compared to the ETag returned.
+func (u *s3Uploader) Upload(path string) (string, error) {
+	key := u.key
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += filepath.Base(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	statePath := path + uploadStateExt
+	uploadID, uploaded := u.resume(statePath, key)
+	if uploadID == "" {
+		uploadID, err = u.createUpload(key)
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(uploadState{u.bucket, key, uploadID})
+		if err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(statePath, b, 0660); err != nil {
+			return "", err
+		}
+	}
+
+	var parts []s3Part
+	size := fi.Size()
+	for n, off := 1, int64(0); off < size || n == 1; n, off = n+1, off+u.partSize {
+		length := u.partSize
+		if size-off < length {
+			length = size - off
+		}
+		section := io.NewSectionReader(f, off, length)
+		md5h, sha := md5.New(), sha256.New()
+		if _, err := io.Copy(io.MultiWriter(md5h, sha), section); err != nil {
+			return "", err
+		}
+		sum := md5h.Sum(nil)
+		etag := hex.EncodeToString(sum)
+		if strings.EqualFold(uploaded[n], etag) {
+			parts = append(parts, s3Part{n, uploaded[n]})
+			continue
+		}
+		got, err := u.uploadPart(key, uploadID, n, section, sum, hex.EncodeToString(sha.Sum(nil)))
+		if err != nil {
+			return "", fmt.Errorf("part %d: %v", n, err)
+		}
+		if err := checkETag(got, sum); err != nil {
+			return "", fmt.Errorf("part %d: %v", n, err)
+		}
+		parts = append(parts, s3Part{n, got})
+	}
+
+	if err := u.completeUpload(key, uploadID, parts); err != nil {
+		return "", err
+	}
+	os.Remove(statePath)
+	return "s3://" + u.bucket + "/" + key, nil
+}
+
+// resume returns the ID of the unfinished upload of key recorded in the file
+// at statePath and the ETags of its uploaded parts, or an empty ID if there
+// is no upload to resume.
+func (u *s3Uploader) resume(statePath, key string) (string, map[int]string) {
+	b, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		return "", nil
+	}
+	var state uploadState
+	if err := json.Unmarshal(b, &state); err != nil || state.Bucket != u.bucket || state.Key != key || state.UploadID == "" {
+		return "", nil
+	}
+	parts, err := u.listParts(key, state.UploadID)
+	if err != nil {
+		// The upload may have been completed or aborted, start over.
+		return "", nil
+	}
+	return state.UploadID, parts
+}
+
+// createUpload starts a multipart upload of key and returns its ID.
+func (u *s3Uploader) createUpload(key string) (string, error) {
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	query := url.Values{"uploads": {""}}
+	if err := u.do("POST", key, query, nil, &result); err != nil {
+		return "", err
+	}
+	if result.UploadID == "" {
+		return "", errors.New("S3 did not return an upload ID")
+	}
+	return result.UploadID, nil
+}
+
+// listParts returns the ETags of the uploaded parts of an upload by part
+// number.
+func (u *s3Uploader) listParts(key, uploadID string) (map[int]string, error) {
+	parts := make(map[int]string)
+	marker := ""
+	for {
+		var result struct {
+			Parts                []s3Part `xml:"Part"`
+			IsTruncated          bool
+			NextPartNumberMarker string
+		}
+		query := url.Values{"uploadId": {uploadID}}
+		if marker != "" {
+			query.Set("part-number-marker", marker)
+		}
+		if err := u.do("GET", key, query, nil, &result); err != nil {
+			return nil, err
+		}
+		for _, p := range result.Parts {
+			parts[p.PartNumber] = strings.Trim(p.ETag, `"`)
+		}
+		if !result.IsTruncated || result.NextPartNumberMarker == "" {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// uploadPart uploads a part of an upload and returns its ETag.
+func (u *s3Uploader) uploadPart(key, uploadID string, n int, body io.ReadSeeker, sum []byte, sha string) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+	header := http.Header{
+		"Content-Md5":          {base64.StdEncoding.EncodeToString(sum)},
+		"X-Amz-Content-Sha256": {sha},
+	}
+	var etag string
+	err := u.retry(func() (*http.Response, error) {
+		if _, err := body.Seek(0, os.SEEK_SET); err != nil {
+			return nil, err
+		}
+		return u.send("PUT", key, query, body, header)
+	}, func(resp *http.Response) error {
+		etag = resp.Header.Get("ETag")
+		return nil
+	})
+	return etag, err
+}
+
+// completeUpload completes an upload from its parts.
+func (u *s3Uploader) completeUpload(key, uploadID string, parts []s3Part) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	return u.do("POST", key, url.Values{"uploadId": {uploadID}}, body, &struct{}{})
+}
+
+// do sends a request with body and decodes the XML response into result.
+// S3 may report errors in the body of successful responses, those are
+// returned too.
+func (u *s3Uploader) do(method, key string, query url.Values, body []byte, result interface{}) error {
+	sum := sha256.Sum256(body)
+	h := http.Header{"X-Amz-Content-Sha256": {hex.EncodeToString(sum[:])}}
+	return u.retry(func() (*http.Response, error) {
+		return u.send(method, key, query, bytes.NewReader(body), h)
+	}, func(resp *http.Response) error {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if err := s3Error(b); err != nil {
+			return err
+		}
+		return xml.Unmarshal(b, result)
+	})
+}
+
+// retry sends requests with send until one succeeds and handle accepts its
+// response, retrying network errors and server errors.
+func (u *s3Uploader) retry(send func() (*http.Response, error), handle func(*http.Response) error) error {
+	return retryUpload(u.sleep, func() (bool, error) {
+		resp, err := send()
+		if err != nil {
+			return true, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+			if err := s3Error(b); err != nil {
+				return retryableStatus(resp.StatusCode), fmt.Errorf("%s: %v", resp.Status, err)
+			}
+			return retryableStatus(resp.StatusCode), fmt.Errorf("upload failed: %s", resp.Status)
+		}
+		if err := handle(resp); err != nil {
+			e, ok := err.(*s3ErrorResponse)
+			return ok && e.Code == "InternalError", err
+		}
+		return false, nil
+	})
+}
+
+// send sends a signed request for key.
+func (u *s3Uploader) send(method, key string, query url.Values, body io.ReadSeeker, header http.Header) (*http.Response, error) {
+	target := *u.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + u.bucket + "/" + key
+	target.RawPath = ""
+	target.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	// http.NewRequest only knows the length of some readers.
+	if req.ContentLength, err = body.Seek(0, os.SEEK_END); err != nil {
+		return nil, err
+	}
+	if _, err := body.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	if req.ContentLength == 0 {
+		req.Body = nil
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	signV4(req, u.creds, u.region, "s3", u.now())
+	return u.client.Do(req)
+}
+
+// s3ErrorResponse is an error returned by S3.
+type s3ErrorResponse struct {
+	Code    string
+	Message string
+}
+
+func (e *s3ErrorResponse) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// s3Error returns the error in an S3 response body, or nil if it has none.
+func s3Error(body []byte) error {
+	var e struct {
+		XMLName xml.Name
+		s3ErrorResponse
+	}
+	if err := xml.Unmarshal(body, &e); err != nil || e.XMLName.Local != "Error" {
+		return nil
+	}
+	return &e.s3ErrorResponse
+}
+
+// signV4 signs req with AWS Signature Version 4 at time t. The host, the
+// Content-Type and Content-MD5 headers and all X-Amz headers are signed. The
+// checksum of the payload is taken from the X-Amz-Content-Sha256 header, if
+// set.
+func signV4(req *http.Request, creds s3Credentials, region, service string, t time.Time) {
+	t = t.UTC()
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = emptySHA256
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "content-type" || k == "content-md5" {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns query encoded as required by AWS Signature Version
+// 4, sorted by key with all reserved characters escaped.
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for k, vs := range query {
+		for _, v := range vs {
+			pairs = append(pairs, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode escapes all characters of s but unreserved ones, and slashes
+// unless encodeSlash is set.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
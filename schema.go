@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// analysisSchemaFile is the published JSON Schema of analysis.json, in the
+// root of the repository.
+const analysisSchemaFile = "analysis.schema.json"
+
+// A jsonSchema is a JSON Schema (draft-07) or a subschema.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 interface{}            `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	Definitions          map[string]*jsonSchema `json:"definitions,omitempty"`
+}
+
+// AnalysisSchema returns the JSON Schema of analysis.json, generated from
+// AnalysisReport. Properties are documented by the description tags of struct
+// fields.
+func AnalysisSchema() ([]byte, error) {
+	g := schemaGenerator{definitions: make(map[string]*jsonSchema)}
+	g.schema(reflect.TypeOf(AnalysisReport{}))
+	root := g.definitions["AnalysisReport"]
+	delete(g.definitions, "AnalysisReport")
+	root.Schema = "http://json-schema.org/draft-07/schema#"
+	root.Title = "RHMAP System Dump Analysis"
+	root.Description = fmt.Sprintf("Results of the analysis of an RHMAP system dump, written to analysis.json. Schema version %d.", AnalysisSchemaVersion)
+	root.Properties["schemaVersion"].Enum = []interface{}{AnalysisSchemaVersion}
+	root.Definitions = g.definitions
+	b, err := json.MarshalIndent(root, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// schemaGenerator generates JSON Schemas of Go types, as encoded by
+// encoding/json. Structs are added to definitions and referenced by name.
+type schemaGenerator struct {
+	definitions map[string]*jsonSchema
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	severityType = reflect.TypeOf(Severity(""))
+)
+
+func (g *schemaGenerator) schema(t reflect.Type) *jsonSchema {
+	switch t {
+	case timeType:
+		return &jsonSchema{Type: "string", Format: "date-time"}
+	case severityType:
+		return &jsonSchema{Type: "string", Enum: []interface{}{SeverityInfo, SeverityWarning, SeverityCritical}}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := g.definitions[name]; !ok {
+			s := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema)}
+			// Register the definition before its fields, for
+			// recursive types.
+			g.definitions[name] = s
+			g.addFields(s, t)
+		}
+		return &jsonSchema{Ref: "#/definitions/" + name}
+	}
+	// Interfaces can hold any value.
+	return &jsonSchema{}
+}
+
+// addFields adds the exported fields of the struct type t to the properties of
+// s. Fields of embedded structs without a JSON name are inlined, as
+// encoding/json does.
+func (g *schemaGenerator) addFields(s *jsonSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.addFields(s, f.Type)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := g.schema(f.Type)
+		fs.Description = f.Tag.Get("description")
+		if strings.Contains(opts, ",omitempty") {
+			s.Properties[name] = fs
+			continue
+		}
+		// encoding/json writes nil slices and maps as null.
+		if k := f.Type.Kind(); k == reflect.Slice || k == reflect.Map {
+			fs.Type = []interface{}{fs.Type, "null"}
+		}
+		s.Properties[name] = fs
+		s.Required = append(s.Required, name)
+	}
+}
+
+func schemaCommand(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fh-system-dump-tool schema")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "Prints the JSON Schema of analysis.json, schema version %d.\n", AnalysisSchemaVersion)
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("schema takes no arguments")
+	}
+	b, err := AnalysisSchema()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAnalysisSchemaUpToDate(t *testing.T) {
+	want, err := AnalysisSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(analysisSchemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s is out of date, regenerate it with: make schema", analysisSchemaFile)
+	}
+}
+
+func TestSchemaGenerator(t *testing.T) {
+	type inner struct {
+		Name string `json:"name"`
+	}
+	type embedded struct {
+		ID int `json:"id"`
+	}
+	type outer struct {
+		embedded
+		Inner    *inner            `json:"inner,omitempty" description:"An inner value."`
+		List     []inner           `json:"list"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		When     time.Time         `json:"when"`
+		Severity Severity          `json:"severity"`
+		Any      interface{}       `json:"any,omitempty"`
+		Plain    bool
+		Ignored  string `json:"-"`
+		private  string
+	}
+	g := schemaGenerator{definitions: make(map[string]*jsonSchema)}
+	if got := g.schema(reflect.TypeOf(outer{})); got.Ref != "#/definitions/outer" {
+		t.Errorf("schema(outer) = %+v, want reference", got)
+	}
+	b, err := json.Marshal(g.definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"inner":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]},` +
+		`"outer":{"type":"object","properties":{` +
+		`"Plain":{"type":"boolean"},` +
+		`"any":{},` +
+		`"id":{"type":"integer"},` +
+		`"inner":{"$ref":"#/definitions/inner","description":"An inner value."},` +
+		`"labels":{"type":"object","additionalProperties":{"type":"string"}},` +
+		`"list":{"type":["array","null"],"items":{"$ref":"#/definitions/inner"}},` +
+		`"severity":{"type":"string","enum":["info","warning","critical"]},` +
+		`"when":{"type":"string","format":"date-time"}},` +
+		`"required":["id","list","when","severity","Plain"]}}`
+	if string(b) != want {
+		t.Errorf("definitions = %s, want %s", b, want)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/feedhenry/fh-system-dump-tool/openshift/api/types"
+)
+
+// snapshotsDir is the directory within a dump where snapshots are stored, one
+// subdirectory per snapshot named after its sequence number and the time it
+// was taken, see snapshotDirName.
+const snapshotsDir = "snapshots"
+
+// snapshotDirName returns the name of the directory of snapshot i of count,
+// taken at t. The zero-padded sequence number keeps names unique and sorted,
+// even when snapshots are taken within the same second.
+func snapshotDirName(i, count int, t time.Time) string {
+	return fmt.Sprintf("%0*d_%s", len(strconv.Itoa(count)), i+1, t.UTC().Format(dumpTimestampFormat))
+}
+
+// parseSnapshotDirName returns the time a snapshot was taken from the name of
+// its directory, as returned by snapshotDirName.
+func parseSnapshotDirName(name string) (time.Time, error) {
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("%s: not a snapshot directory", name)
+	}
+	if _, err := strconv.Atoi(name[:i]); err != nil {
+		return time.Time{}, fmt.Errorf("%s: not a snapshot directory", name)
+	}
+	return time.Parse(dumpTimestampFormat, name[i+1:])
+}
+
+// snapshotCollector gathers the lightweight data stored in each snapshot. It
+// is not part of DefaultCollectors, since it only runs in snapshot mode.
+var snapshotCollector = NewCollector("snapshot", "pods, events, node conditions and Nagios status", ProjectScope,
+	func(tasks chan<- Task, env CollectorEnv) {
+		GetSnapshotTasks(tasks, env.Runner, env.Projects, env.ResourceFactory, env.Config.NagiosStatusFile)
+	})
+
+// GetSnapshotTasks sends tasks to fetch the definitions of nodes, and of pods
+// and events in all projects, and the Nagios status file from all Nagios pods.
+func GetSnapshotTasks(tasks chan<- Task, runner Runner, projects []string, resourceFactory ResourceMatchFactory, nagiosStatusFile string) {
+	tasks <- ResourceDefinition(runner, "", "nodes")
+	for _, p := range projects {
+		tasks <- ResourceDefinition(runner, p, "pods")
+		tasks <- ResourceDefinition(runner, p, "events")
+		pods, err := resourceFactory(p, "pod", "nagios")
+		if err != nil {
+			tasks <- NewError(err)
+			continue
+		}
+		for _, pod := range pods {
+			tasks <- GetNagiosStatusData(runner, p, pod, nagiosStatusFile)
+		}
+	}
+}
+
+// RunSnapshots takes count snapshots, one every interval, into numbered and
+// timestamped subdirectories of the snapshots directory within basepath, and
+// returns task errors. Commands are run with runners returned by newRunner for
+// each snapshot directory, with the projects and paths set in cfg. Each
+// snapshot is reported to progress as a separate phase.
+func RunSnapshots(basepath string, newRunner func(dir string) Runner, cfg Config, interval time.Duration, count, workers int, progress ProgressReporter) []error {
+	var errs []error
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		if d := start.Add(time.Duration(i) * interval).Sub(time.Now()); d > 0 {
+			time.Sleep(d)
+		}
+		dir := filepath.Join(basepath, snapshotsDir, snapshotDirName(i, count, time.Now()))
+		progress.Start(fmt.Sprintf("snapshot %d/%d", i+1, count))
+		errs = append(errs, RunAllDumpTasks(newRunner(dir), []Collector{snapshotCollector}, cfg, workers, progress)...)
+		progress.Finish()
+	}
+	return errs
+}
+
+// WriteSnapshotTimeline builds the timeline of the snapshots within basepath
+// and writes it to snapshots/timeline.json.
+func WriteSnapshotTimeline(basepath string) error {
+	dir := filepath.Join(basepath, snapshotsDir)
+	timeline, err := BuildSnapshotTimeline(dir)
+	if err != nil {
+		return err
+	}
+	return writeTimeline(timeline, filepath.Join(dir, "timeline.json"))
+}
+
+// podSnapshot is the state of a pod relevant to the timeline.
+type podSnapshot struct {
+	phase    types.PodPhase
+	restarts map[string]int32
+}
+
+// BuildSnapshotTimeline builds a timeline from the snapshots in dir, listing
+// the state of pods and nodes in the first snapshot, changes of pod phase,
+// container restarts and node readiness between snapshots, and the events
+// recorded in any snapshot. Definitions that could not be fetched are skipped.
+func BuildSnapshotTimeline(dir string) (Timeline, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		timeline Timeline
+		pods     = make(map[string]podSnapshot)
+		nodes    = make(map[string]string)
+		events   = make(map[string]bool)
+		first    = true
+	)
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		t, err := parseSnapshotDirName(fi.Name())
+		if err != nil {
+			continue
+		}
+		snapshot := filepath.Join(dir, fi.Name())
+		add := func(project, object, source, format string, a ...interface{}) {
+			timeline = append(timeline, TimelineEntry{
+				Time:    t,
+				Project: project,
+				Object:  object,
+				Source:  source,
+				Message: fmt.Sprintf(format, a...),
+			})
+		}
+
+		var nodeList types.NodeList
+		if err := load(filepath.Join(snapshot, "definitions", "nodes.json"), &nodeList); err == nil {
+			for _, node := range nodeList.Items {
+				ready := "Unknown"
+				for _, c := range node.Status.Conditions {
+					if c.Type == "Ready" {
+						ready = c.Status
+					}
+				}
+				if prev, ok := nodes[node.Name]; !ok || prev != ready {
+					add("", "node/"+node.Name, "snapshot", "node Ready condition is %s", ready)
+				}
+				nodes[node.Name] = ready
+			}
+		}
+
+		podPaths, err := filepath.Glob(filepath.Join(snapshot, "projects", "*", "definitions", "pods.json"))
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		fetched := make(map[string]bool)
+		for _, path := range podPaths {
+			project := filepath.Base(filepath.Dir(filepath.Dir(path)))
+			var podList types.PodList
+			if err := load(path, &podList); err != nil {
+				continue
+			}
+			fetched[project] = true
+			for _, pod := range podList.Items {
+				key := project + "/" + pod.Name
+				seen[key] = true
+				cur := podSnapshot{phase: pod.Status.Phase, restarts: make(map[string]int32)}
+				for _, s := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+					cur.restarts[s.Name] = s.RestartCount
+				}
+				prev, ok := pods[key]
+				switch {
+				case !ok && first:
+					add(project, "pod/"+pod.Name, "snapshot", "pod is %s", cur.phase)
+				case !ok:
+					add(project, "pod/"+pod.Name, "snapshot", "pod appeared in phase %s", cur.phase)
+				case prev.phase != cur.phase:
+					add(project, "pod/"+pod.Name, "snapshot", "pod phase changed from %s to %s", prev.phase, cur.phase)
+				}
+				if ok {
+					for _, name := range sortedContainerNames(cur.restarts) {
+						if n := cur.restarts[name]; n > prev.restarts[name] {
+							add(project, "pod/"+pod.Name, "snapshot", "container %s restarted, %d restarts in total", name, n)
+						}
+					}
+				}
+				pods[key] = cur
+			}
+		}
+		var gone []string
+		for key := range pods {
+			// Pods of projects whose definitions could not be
+			// fetched are not known to be gone.
+			if !seen[key] && fetched[strings.SplitN(key, "/", 2)[0]] {
+				gone = append(gone, key)
+			}
+		}
+		sort.Strings(gone)
+		for _, key := range gone {
+			parts := strings.SplitN(key, "/", 2)
+			add(parts[0], "pod/"+parts[1], "snapshot", "pod no longer exists")
+			delete(pods, key)
+		}
+
+		eventPaths, err := filepath.Glob(filepath.Join(snapshot, "projects", "*", "definitions", "events.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range eventPaths {
+			project := filepath.Base(filepath.Dir(filepath.Dir(path)))
+			var eventList types.EventList
+			if err := load(path, &eventList); err != nil {
+				continue
+			}
+			for _, event := range eventList.Items {
+				// Events are updated in place when they repeat,
+				// incrementing their count.
+				key := fmt.Sprintf("%s/%s/%d", project, event.Name, event.Count)
+				if events[key] {
+					continue
+				}
+				events[key] = true
+				entry := eventTimelineEntry(project, event)
+				if entry.Time.IsZero() {
+					entry.Time = t
+				}
+				timeline = append(timeline, entry)
+			}
+		}
+		first = false
+	}
+	timeline.Sort()
+	return timeline, nil
+}
+
+// sortedContainerNames returns the keys of m in increasing order.
+func sortedContainerNames(m map[string]int32) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetSnapshotTasks(t *testing.T) {
+	tasks := make(chan Task, 10)
+	runner := &FakeRunner{}
+
+	GetSnapshotTasks(tasks, runner, []string{"project1"}, func(project, resource, substr string) ([]string, error) {
+		return []string{"nagios-1-abcde"}, nil
+	}, "/var/log/nagios/status.dat")
+	close(tasks)
+
+	for task := range tasks {
+		if err := task(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []RunCall{
+		{[]string{"oc", "get", "nodes", "-o=json"}, filepath.Join("definitions", "nodes.json")},
+		{[]string{"oc", "-n", "project1", "get", "pods", "-o=json"}, filepath.Join("projects", "project1", "definitions", "pods.json")},
+		{[]string{"oc", "-n", "project1", "get", "events", "-o=json"}, filepath.Join("projects", "project1", "definitions", "events.json")},
+		{[]string{"oc", "-n", "project1", "exec", "nagios-1-abcde", "--", "cat", "/var/log/nagios/status.dat"}, filepath.Join("projects", "project1", "nagios", "nagios-1-abcde_status.dat")},
+	}
+	if !reflect.DeepEqual(runner.Calls, want) {
+		t.Errorf("runner.Calls = %q, want %q", runner.Calls, want)
+	}
+}
+
+func TestBuildSnapshotTimeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-snapshots-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"1_2017-01-01T10-00-00Z/definitions/nodes.json": `{"items": [
+			{"metadata": {"name": "node1"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}
+		]}`,
+		"1_2017-01-01T10-00-00Z/projects/core/definitions/pods.json": `{"items": [
+			{"metadata": {"name": "mongodb-1-abcde"}, "status": {"phase": "Running", "containerStatuses": [{"name": "mongodb", "restartCount": 1}]}},
+			{"metadata": {"name": "fh-ngui-1-abcde"}, "status": {"phase": "Running"}}
+		]}`,
+		"1_2017-01-01T10-00-00Z/projects/core/definitions/events.json": `{"items": [
+			{"metadata": {"name": "e1"}, "involvedObject": {"kind": "Pod", "name": "mongodb-1-abcde"}, "type": "Warning", "reason": "BackOff", "message": "Back-off restarting failed container", "count": 1, "lastTimestamp": "2017-01-01T09:59:00Z"}
+		]}`,
+		"2_2017-01-01T10-00-30Z/definitions/nodes.json": `{"items": [
+			{"metadata": {"name": "node1"}, "status": {"conditions": [{"type": "Ready", "status": "False"}]}},
+			{"metadata": {"name": "node2"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}
+		]}`,
+		"2_2017-01-01T10-00-30Z/projects/core/definitions/pods.json": `{"items": [
+			{"metadata": {"name": "mongodb-1-abcde"}, "status": {"phase": "Pending", "containerStatuses": [{"name": "mongodb", "restartCount": 2}]}},
+			{"metadata": {"name": "fh-ngui-1-fghij"}, "status": {"phase": "Pending"}}
+		]}`,
+		"2_2017-01-01T10-00-30Z/projects/core/definitions/events.json": `{"items": [
+			{"metadata": {"name": "e1"}, "involvedObject": {"kind": "Pod", "name": "mongodb-1-abcde"}, "type": "Warning", "reason": "BackOff", "message": "Back-off restarting failed container", "count": 2, "lastTimestamp": "2017-01-01T10:00:20Z"}
+		]}`,
+		// Definitions that could not be fetched are empty.
+		"3_2017-01-01T10-01-00Z/definitions/nodes.json":                "",
+		"3_2017-01-01T10-01-00Z/projects/core/definitions/pods.json":   "",
+		"3_2017-01-01T10-01-00Z/projects/core/definitions/events.json": "",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timeline, err := BuildSnapshotTimeline(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+	t1 := t0.Add(30 * time.Second)
+	want := Timeline{
+		{Time: t0.Add(-time.Minute), Project: "core", Object: "pod/mongodb-1-abcde", Source: "event", Message: "Warning BackOff: Back-off restarting failed container"},
+		{Time: t0, Object: "node/node1", Source: "snapshot", Message: "node Ready condition is True"},
+		{Time: t0, Project: "core", Object: "pod/mongodb-1-abcde", Source: "snapshot", Message: "pod is Running"},
+		{Time: t0, Project: "core", Object: "pod/fh-ngui-1-abcde", Source: "snapshot", Message: "pod is Running"},
+		{Time: t0.Add(20 * time.Second), Project: "core", Object: "pod/mongodb-1-abcde", Source: "event", Message: "Warning BackOff: Back-off restarting failed container (x2)"},
+		{Time: t1, Object: "node/node1", Source: "snapshot", Message: "node Ready condition is False"},
+		{Time: t1, Object: "node/node2", Source: "snapshot", Message: "node Ready condition is True"},
+		{Time: t1, Project: "core", Object: "pod/mongodb-1-abcde", Source: "snapshot", Message: "pod phase changed from Running to Pending"},
+		{Time: t1, Project: "core", Object: "pod/mongodb-1-abcde", Source: "snapshot", Message: "container mongodb restarted, 2 restarts in total"},
+		{Time: t1, Project: "core", Object: "pod/fh-ngui-1-fghij", Source: "snapshot", Message: "pod appeared in phase Pending"},
+		{Time: t1, Project: "core", Object: "pod/fh-ngui-1-abcde", Source: "snapshot", Message: "pod no longer exists"},
+	}
+	if len(timeline) != len(want) {
+		t.Fatalf("len(timeline) = %d, want %d:\n%+v", len(timeline), len(want), timeline)
+	}
+	for i := range want {
+		if !timeline[i].Time.Equal(want[i].Time) {
+			t.Errorf("timeline[%d].Time = %v, want %v", i, timeline[i].Time, want[i].Time)
+		}
+		timeline[i].Time = want[i].Time
+		if !reflect.DeepEqual(timeline[i], want[i]) {
+			t.Errorf("timeline[%d] = %+v, want %+v", i, timeline[i], want[i])
+		}
+	}
+}
+
+func TestSnapshotDirName(t *testing.T) {
+	at := time.Date(2017, 1, 1, 10, 0, 0, 500, time.UTC)
+	// Snapshots taken within the same second have distinct names, that
+	// sort in the order they were taken.
+	first, second := snapshotDirName(0, 12, at), snapshotDirName(1, 12, at)
+	if first != "01_2017-01-01T10-00-00Z" || second != "02_2017-01-01T10-00-00Z" {
+		t.Errorf("snapshotDirName() = %q, %q", first, second)
+	}
+	if name := snapshotDirName(11, 12, at); name <= second {
+		t.Errorf("snapshotDirName(11) = %q, want it sorted after %q", name, second)
+	}
+
+	want := at.Truncate(time.Second)
+	if got, err := parseSnapshotDirName(first); err != nil || !got.Equal(want) {
+		t.Errorf("parseSnapshotDirName(%q) = %v, %v, want %v", first, got, err, want)
+	}
+	for _, name := range []string{"timeline.json", "x_2017-01-01T10-00-00Z", "2017-01-01T10-00-00Z"} {
+		if _, err := parseSnapshotDirName(name); err == nil {
+			t.Errorf("parseSnapshotDirName(%q) error = nil, want error", name)
+		}
+	}
+}
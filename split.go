@@ -0,0 +1,385 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// manifestExt is appended to the path of an archive to get the path of the
+// manifest listing its volumes, when split.
+const manifestExt = ".manifest.json"
+
+// volumeExt matches the extension of archive volumes.
+var volumeExt = regexp.MustCompile(`\.[0-9]{3,}$`)
+
+// ArchiveManifest describes an archive split into volumes. Joining the
+// volumes in order gives back the archive.
+type ArchiveManifest struct {
+	// Archive is the file name of the joined archive.
+	Archive string          `json:"archive"`
+	Size    int64           `json:"size"`
+	SHA256  string          `json:"sha256"`
+	Volumes []ArchiveVolume `json:"volumes"`
+}
+
+// ArchiveVolume is a volume of a split archive. Name is relative to the
+// directory of the manifest.
+type ArchiveVolume struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// sizePattern matches sizes accepted by ParseSize.
+var sizePattern = regexp.MustCompile(`^([0-9]+)(?:([KMGkmg])(?:i?[Bb])?|[Bb])?$`)
+
+// sizeUnits maps units of sizes to their number of bytes.
+var sizeUnits = map[string]int64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+
+// ParseSize parses a size in bytes, with an optional K, M or G unit, e.g. 25M.
+// Units are powers of 1024 and may be followed by B or iB.
+func ParseSize(s string) (int64, error) {
+	invalid := fmt.Errorf("invalid size %q, must be a positive number of bytes with an optional K, M or G unit", s)
+	match := sizePattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, invalid
+	}
+	n, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, invalid
+	}
+	m := sizeUnits[strings.ToUpper(match[2])]
+	if n > (1<<63-1)/m {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * m, nil
+}
+
+// volumePath returns the path of the nth volume, from 1, of an archive.
+func volumePath(archivePath string, n int) string {
+	return fmt.Sprintf("%s.%03d", archivePath, n)
+}
+
+// volumeWriter writes an archive as volumes of at most size bytes, and a
+// manifest listing them when closed.
+type volumeWriter struct {
+	archivePath string
+	size        int64
+	manifest    ArchiveManifest
+	hash        hash.Hash
+
+	// The volume being written.
+	f          *os.File
+	written    int64
+	volumeHash hash.Hash
+}
+
+func newVolumeWriter(archivePath string, size int64) *volumeWriter {
+	return &volumeWriter{
+		archivePath: archivePath,
+		size:        size,
+		manifest:    ArchiveManifest{Archive: filepath.Base(archivePath)},
+		hash:        sha256.New(),
+	}
+}
+
+func (w *volumeWriter) Write(p []byte) (int, error) {
+	var total int
+	for len(p) > 0 {
+		if w.f == nil || w.written == w.size {
+			if err := w.next(); err != nil {
+				return total, err
+			}
+		}
+		chunk := p
+		if left := w.size - w.written; int64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+		n, err := w.f.Write(chunk)
+		w.written += int64(n)
+		w.volumeHash.Write(chunk[:n])
+		w.hash.Write(chunk[:n])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// next finishes the current volume, if any, and starts the next one.
+func (w *volumeWriter) next() error {
+	if err := w.finish(); err != nil {
+		return err
+	}
+	path := volumePath(w.archivePath, len(w.manifest.Volumes)+1)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	w.f, w.written, w.volumeHash = f, 0, sha256.New()
+	return nil
+}
+
+// finish closes the current volume, if any, and adds it to the manifest.
+func (w *volumeWriter) finish() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.manifest.Volumes = append(w.manifest.Volumes, ArchiveVolume{
+		Name:   filepath.Base(w.f.Name()),
+		Size:   w.written,
+		SHA256: hex.EncodeToString(w.volumeHash.Sum(nil)),
+	})
+	w.manifest.Size += w.written
+	w.f = nil
+	return err
+}
+
+// Close finishes the last volume and writes the manifest.
+func (w *volumeWriter) Close() error {
+	if w.f == nil && len(w.manifest.Volumes) == 0 {
+		if err := w.next(); err != nil {
+			return err
+		}
+	}
+	if err := w.finish(); err != nil {
+		return err
+	}
+	w.manifest.SHA256 = hex.EncodeToString(w.hash.Sum(nil))
+	b, err := json.MarshalIndent(w.manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeNewFile(w.archivePath+manifestExt, append(b, '\n'))
+}
+
+// remove removes the volumes and manifest written.
+func (w *volumeWriter) remove() {
+	if w.f != nil {
+		w.f.Close()
+		os.Remove(w.f.Name())
+	}
+	for _, v := range w.manifest.Volumes {
+		os.Remove(filepath.Join(filepath.Dir(w.archivePath), v.Name))
+	}
+}
+
+// writeNewFile writes data to a new file at path, failing if it exists. The
+// file is removed if writing fails.
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// archiveVolumes archives the directory at path like archive, but as numbered
+// volumes of at most size bytes next to archivePath, with a manifest at
+// archivePath plus manifestExt. Nothing is left behind if archiving fails.
+func archiveVolumes(path, archivePath string, key *rsa.PublicKey, size int64) (ArchiveManifest, error) {
+	w := newVolumeWriter(archivePath, size)
+	err := writeArchive(w, path, key)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		w.remove()
+		return ArchiveManifest{}, err
+	}
+	return w.manifest, nil
+}
+
+// splitManifestPath returns the path of the manifest of a split archive, if
+// path is the manifest or one of its volumes.
+func splitManifestPath(path string) (string, bool) {
+	if strings.HasSuffix(path, manifestExt) {
+		return path, true
+	}
+	if ext := volumeExt.FindString(path); ext != "" {
+		manifest := strings.TrimSuffix(path, ext) + manifestExt
+		if _, err := os.Stat(manifest); err == nil {
+			return manifest, true
+		}
+	}
+	return "", false
+}
+
+// LoadManifest reads the manifest of a split archive at path.
+func LoadManifest(path string) (ArchiveManifest, error) {
+	var m ArchiveManifest
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(m.Volumes) == 0 {
+		return m, fmt.Errorf("%s: no volumes listed", path)
+	}
+	for _, v := range m.Volumes {
+		if v.Name == "" || filepath.Base(v.Name) != v.Name {
+			return m, fmt.Errorf("%s: invalid volume name %q", path, v.Name)
+		}
+	}
+	return m, nil
+}
+
+// openVolumes returns a reader of the archive split into the volumes listed
+// in the manifest at path. The size and checksum of each volume and of the
+// whole archive are checked as they are read; reading fails if one differs
+// from the manifest.
+func openVolumes(path string) (io.ReadCloser, error) {
+	m, err := LoadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	return &volumeReader{dir: filepath.Dir(path), manifest: m, hash: sha256.New()}, nil
+}
+
+// volumeReader reads the volumes of a split archive in order.
+type volumeReader struct {
+	dir      string
+	manifest ArchiveManifest
+	hash     hash.Hash
+	next     int
+	// err is returned by all reads after the first error.
+	err error
+
+	// The volume being read.
+	f          *os.File
+	read       int64
+	volumeHash hash.Hash
+}
+
+func (r *volumeReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.readVolumes(p)
+	r.err = err
+	return n, err
+}
+
+// readVolumes reads from the current volume, moving to the next one at its end.
+func (r *volumeReader) readVolumes(p []byte) (int, error) {
+	for {
+		if r.f == nil {
+			if r.next == len(r.manifest.Volumes) {
+				if sum := hex.EncodeToString(r.hash.Sum(nil)); sum != r.manifest.SHA256 {
+					return 0, fmt.Errorf("archive checksum mismatch: got %s, want %s", sum, r.manifest.SHA256)
+				}
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(r.dir, r.manifest.Volumes[r.next].Name))
+			if err != nil {
+				return 0, err
+			}
+			r.f, r.read, r.volumeHash = f, 0, sha256.New()
+		}
+		n, err := r.f.Read(p)
+		r.read += int64(n)
+		r.volumeHash.Write(p[:n])
+		r.hash.Write(p[:n])
+		if err == io.EOF {
+			err = r.finish()
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// finish checks and closes the volume read completely.
+func (r *volumeReader) finish() error {
+	v := r.manifest.Volumes[r.next]
+	r.f.Close()
+	r.f = nil
+	r.next++
+	if r.read != v.Size {
+		return fmt.Errorf("volume %s: size is %d bytes, want %d", v.Name, r.read, v.Size)
+	}
+	if sum := hex.EncodeToString(r.volumeHash.Sum(nil)); sum != v.SHA256 {
+		return fmt.Errorf("volume %s: checksum mismatch: got %s, want %s", v.Name, sum, v.SHA256)
+	}
+	return nil
+}
+
+func (r *volumeReader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// joinCommand implements the join subcommand, that joins the volumes of a
+// split archive.
+func joinCommand(args []string) error {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+	output := fs.String("o", "", "write the archive to this file (default the archive name of the manifest, next to it)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fh-system-dump-tool join [flags] <manifest or volume>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Joins the volumes of a split dump archive, checking their checksums.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("join requires a manifest or volume")
+	}
+	manifestPath, ok := splitManifestPath(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("%s is not a manifest or volume of a split archive", fs.Arg(0))
+	}
+	m, err := LoadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	out := *output
+	if out == "" {
+		out = filepath.Join(filepath.Dir(manifestPath), filepath.Base(m.Archive))
+	}
+	r, err := openVolumes(manifestPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out)
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"100", 100},
+		{"100B", 100},
+		{"4k", 4 << 10},
+		{"25M", 25 << 20},
+		{"25MB", 25 << 20},
+		{"25MiB", 25 << 20},
+		{"2G", 2 << 30},
+	}
+	for _, tt := range tests {
+		if got, err := ParseSize(tt.s); err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "0", "-1M", "1T", "M", "1.5M", "1 M", "1Mi", "99999999999G"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q) error = nil, want error", s)
+		}
+	}
+}
+
+// writeSplitArchive archives a dump with a large random file as volumes of
+// size bytes and returns the path of the archive and its manifest.
+func writeSplitArchive(t *testing.T, dir string, size int64) (string, ArchiveManifest) {
+	dump := filepath.Join(dir, "dump")
+	if err := os.Mkdir(dump, 0770); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 10000)
+	rand.Read(data)
+	files := map[string][]byte{"version": []byte("v1\n"), "data": data}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dump, name), content, 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archivePath := dump + ".tar.gz"
+	m, err := archiveVolumes(dump, archivePath, nil, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archivePath, m
+}
+
+func TestArchiveVolumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-split-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archivePath, m := writeSplitArchive(t, dir, 4096)
+	if len(m.Volumes) < 3 {
+		t.Fatalf("got %d volumes, want at least 3", len(m.Volumes))
+	}
+	var total int64
+	for i, v := range m.Volumes {
+		fi, err := os.Stat(filepath.Join(dir, v.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != v.Size || v.Size > 4096 || (i < len(m.Volumes)-1 && v.Size != 4096) {
+			t.Errorf("volume %s: size %d, manifest %d", v.Name, fi.Size(), v.Size)
+		}
+		total += v.Size
+	}
+	if m.Archive != "dump.tar.gz" || m.Size != total || m.Volumes[0].Name != "dump.tar.gz.001" {
+		t.Errorf("manifest = %+v", m)
+	}
+	if _, err := os.Stat(archivePath); !os.IsNotExist(err) {
+		t.Errorf("unsplit archive written: %v", err)
+	}
+
+	// Both the manifest and volumes can be opened.
+	for _, path := range []string{archivePath + manifestExt, archivePath + ".002"} {
+		opened, cleanup, err := OpenDump(path)
+		if err != nil {
+			t.Errorf("OpenDump(%s) error = %v", path, err)
+			continue
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(opened, "version")); err != nil || string(b) != "v1\n" {
+			t.Errorf("OpenDump(%s): version = %q, %v", path, b, err)
+		}
+		cleanup()
+	}
+
+	if err := joinCommand([]string{archivePath + ".001"}); err != nil {
+		t.Fatal(err)
+	}
+	opened, cleanup, err := OpenDump(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if opened == "" {
+		t.Error("joined archive could not be opened")
+	}
+
+	// Existing volumes are not overwritten.
+	if _, err := archiveVolumes(filepath.Join(dir, "dump"), archivePath, nil, 4096); err == nil {
+		t.Error("archiveVolumes() to existing volumes = nil, want error")
+	}
+	if _, err := os.Stat(archivePath + manifestExt); err != nil {
+		t.Errorf("existing manifest removed: %v", err)
+	}
+}
+
+func TestOpenDumpCorruptVolumes(t *testing.T) {
+	tests := []struct {
+		corrupt func(dir string, m ArchiveManifest) error
+		wantErr string
+	}{
+		{func(dir string, m ArchiveManifest) error {
+			return os.Remove(filepath.Join(dir, m.Volumes[1].Name))
+		}, "no such file"},
+		{func(dir string, m ArchiveManifest) error {
+			f, err := os.OpenFile(filepath.Join(dir, m.Volumes[len(m.Volumes)-1].Name), os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Write([]byte("x"))
+			return err
+		}, "size is"},
+		{func(dir string, m ArchiveManifest) error {
+			path := filepath.Join(dir, m.Volumes[0].Name)
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			b[len(b)-1] ^= 0xff
+			return ioutil.WriteFile(path, b, 0660)
+		}, "checksum mismatch"},
+	}
+	for i, tt := range tests {
+		dir, err := ioutil.TempDir("", "test-split-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		archivePath, m := writeSplitArchive(t, dir, 4096)
+		if err := tt.corrupt(dir, m); err != nil {
+			t.Fatal(err)
+		}
+		_, cleanup, err := OpenDump(archivePath + manifestExt)
+		cleanup()
+		os.RemoveAll(dir)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("#%d: OpenDump() error = %v, want %q", i, err, tt.wantErr)
+		}
+	}
+}
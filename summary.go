@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/feedhenry/fh-system-dump-tool/openshift/api/types"
+)
+
+// summaryFile is the name of the Markdown summary of a dump, in its root
+// directory.
+const summaryFile = "summary.md"
+
+// summaryMaxErrors is how many errors of a group are listed in summaries.
+const summaryMaxErrors = 20
+
+// WriteSummary writes a Markdown summary of the dump in dir, suitable for
+// pasting into support tickets, to summaryFile in dir. It is built from the
+// files of the dump: the version of the tool and of the cluster, the resource
+// definitions of projects, analysis.json and errors.json. Missing files leave
+// out their part of the summary.
+func WriteSummary(dir string) error {
+	var b bytes.Buffer
+	if err := writeSummary(&b, dir); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, summaryFile), b.Bytes(), 0660)
+}
+
+func writeSummary(b *bytes.Buffer, dir string) error {
+	b.WriteString("# RHMAP System Dump Summary\n\n")
+	if v := readFirstLine(filepath.Join(dir, "version")); v != "" {
+		fmt.Fprintf(b, "- Dump tool: %s\n", markdownEscaper.Replace(v))
+	}
+	fmt.Fprintf(b, "- Dump: `%s`\n", filepath.Base(dir))
+	if ocVersion, err := ioutil.ReadFile(filepath.Join(dir, "meta", "oc_version")); err == nil {
+		if cluster := parseClusterInfo(ocVersion); cluster.Version != "" {
+			fmt.Fprintf(b, "- OpenShift: %s\n", markdownEscaper.Replace(cluster.Version))
+		}
+		fmt.Fprintf(b, "\n<details>\n<summary>oc version</summary>\n\n```\n%s\n```\n</details>\n", strings.TrimSpace(string(ocVersion)))
+	}
+
+	if err := writeSummaryInventory(b, dir); err != nil {
+		return err
+	}
+
+	report, err := ReadAnalysis(filepath.Join(dir, "analysis.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	writeSummaryChecks(b, report.AnalysisResult)
+
+	var errorGroups []ErrorGroup
+	if err := loadIfExists(filepath.Join(dir, "errors.json"), &errorGroups); err != nil {
+		return err
+	}
+	writeSummaryErrors(b, errorGroups)
+	return nil
+}
+
+// readFirstLine returns the first line of the file at path, or an empty string
+// if it cannot be read.
+func readFirstLine(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	return strings.TrimSpace(scanner.Text())
+}
+
+// loadIfExists loads the JSON file at path into v, if it exists.
+func loadIfExists(path string, v interface{}) error {
+	err := load(path, v)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// writeSummaryInventory writes a table with the number of resources of each
+// kind in each project, and the number of pods not running.
+func writeSummaryInventory(b *bytes.Buffer, dir string) error {
+	fis, err := ioutil.ReadDir(filepath.Join(dir, "projects"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	type inventory struct {
+		project    string
+		counts     map[string]int
+		notRunning int
+	}
+	var inventories []inventory
+	kinds := make(map[string]bool)
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		inv := inventory{project: fi.Name(), counts: make(map[string]int)}
+		defs, _ := filepath.Glob(filepath.Join(dir, "projects", fi.Name(), "definitions", "*.json"))
+		for _, def := range defs {
+			var list struct {
+				Items []json.RawMessage `json:"items"`
+			}
+			if load(def, &list) != nil {
+				continue
+			}
+			kind := strings.TrimSuffix(filepath.Base(def), ".json")
+			inv.counts[kind] = len(list.Items)
+			kinds[kind] = true
+		}
+		var pods types.PodList
+		if load(filepath.Join(dir, "projects", fi.Name(), "definitions", "pods.json"), &pods) == nil {
+			for _, pod := range pods.Items {
+				if pod.Status.Phase != types.PodRunning && pod.Status.Phase != types.PodSucceeded {
+					inv.notRunning++
+				}
+			}
+		}
+		inventories = append(inventories, inv)
+	}
+	if len(inventories) == 0 {
+		return nil
+	}
+	var columns []string
+	for kind := range kinds {
+		columns = append(columns, kind)
+	}
+	sort.Strings(columns)
+
+	b.WriteString("\n## Projects\n\n| Project |")
+	for _, c := range columns {
+		fmt.Fprintf(b, " %s |", c)
+	}
+	b.WriteString(" pods not running |\n|---|")
+	for range columns {
+		b.WriteString("---:|")
+	}
+	b.WriteString("---:|\n")
+	for _, inv := range inventories {
+		fmt.Fprintf(b, "| %s |", markdownEscaper.Replace(inv.project))
+		for _, c := range columns {
+			if n, ok := inv.counts[c]; ok {
+				fmt.Fprintf(b, " %d |", n)
+			} else {
+				b.WriteString(" - |")
+			}
+		}
+		fmt.Fprintf(b, " %d |\n", inv.notRunning)
+	}
+	return nil
+}
+
+// writeSummaryChecks writes the failing checks, most severe first, with their
+// details in collapsible sections.
+func writeSummaryChecks(b *bytes.Buffer, analysisResult AnalysisResult) {
+	var failures []projectIssue
+	total := 0
+	for _, suite := range reportSuites(analysisResult) {
+		for _, r := range suite.results {
+			total++
+			if !r.Ok {
+				failures = append(failures, projectIssue{suite.name, r})
+			}
+		}
+	}
+	sort.Stable(bySeverity(failures))
+
+	fmt.Fprintf(b, "\n## Failing checks\n\n%d of %d checks failed.\n", len(failures), total)
+	for _, f := range failures {
+		r := f.result
+		b.WriteString("\n<details>\n<summary>")
+		if r.Severity != "" {
+			fmt.Fprintf(b, "[%s] ", r.Severity)
+		}
+		fmt.Fprintf(b, "%s: %s</summary>\n\n", htmlEscaper.Replace(f.project), htmlEscaper.Replace(r.CheckName))
+		fmt.Fprintf(b, "%s\n\n", markdownEscaper.Replace(r.Message))
+		for _, detail := range checkDetails(r) {
+			fmt.Fprintf(b, "- %s\n", markdownEscaper.Replace(detail))
+		}
+		if r.DocURL != "" {
+			fmt.Fprintf(b, "\nSee: %s\n", r.DocURL)
+		}
+		b.WriteString("</details>\n")
+	}
+}
+
+// writeSummaryErrors writes the errors that occurred while collecting and
+// analyzing data. Ignorable errors are only counted.
+func writeSummaryErrors(b *bytes.Buffer, groups []ErrorGroup) {
+	b.WriteString("\n## Collection errors\n\n")
+	total, ignorable := 0, 0
+	for _, g := range groups {
+		total += len(g.Errors)
+		ignorable += g.Ignorable()
+	}
+	if total == 0 {
+		b.WriteString("No errors.\n")
+		return
+	}
+	fmt.Fprintf(b, "%d errors, %d of them ignorable and not listed. Details are in `errors.json`.\n", total, ignorable)
+	for _, g := range groups {
+		var errs []ErrorRecord
+		for _, e := range g.Errors {
+			if !e.Ignorable {
+				errs = append(errs, e)
+			}
+		}
+		if len(errs) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "\n<details>\n<summary>%d errors in %s</summary>\n\n", len(errs), htmlEscaper.Replace(g.Source()))
+		for i, e := range errs {
+			if i == summaryMaxErrors {
+				fmt.Fprintf(b, "- and %d more\n", len(errs)-summaryMaxErrors)
+				break
+			}
+			msg := markdownEscaper.Replace(strings.TrimSpace(e.Error))
+			if len(e.Command) > 0 {
+				fmt.Fprintf(b, "- `%s`: %s\n", strings.Replace(strings.Join(e.Command, " "), "`", "'", -1), msg)
+			} else {
+				fmt.Fprintf(b, "- %s\n", msg)
+			}
+		}
+		b.WriteString("</details>\n")
+	}
+}
+
+// htmlEscaper escapes text placed in HTML elements of Markdown documents.
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const ocVersionOutput = `oc v3.3.1.7
+kubernetes v1.3.0+52492b4
+features: Basic-Auth GSSAPI Kerberos SPNEGO
+
+Server https://master.example.com:8443
+openshift v3.3.1.17
+kubernetes v1.3.0+52492b4
+`
+
+func TestWriteSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-summary-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	analysis, _ := json.Marshal(reportFixture)
+	errs, _ := json.Marshal([]ErrorGroup{
+		{Collector: "logs", Project: "core", Errors: []ErrorRecord{
+			{Command: []string{"oc", "logs", "pod"}, Error: "exit status 1"},
+			{Error: "not found", Ignorable: true},
+		}},
+		{Collector: "nagios", Errors: []ErrorRecord{{Error: "ignored", Ignorable: true}}},
+	})
+	files := map[string]string{
+		"version":                                 "RHMAP fh-system-dump-tool 1.2.3\n",
+		"meta/oc_version":                         ocVersionOutput,
+		"projects/core/definitions/pods.json":     `{"items": [{"status": {"phase": "Running"}}, {"status": {"phase": "Pending"}}]}`,
+		"projects/core/definitions/events.json":   `{"items": []}`,
+		"projects/mbaas/definitions/pods.json":    `{"items": [{"status": {"phase": "Succeeded"}}]}`,
+		"projects/mbaas/definitions/invalid.json": `{`,
+		"projects/mbaas/logs/fh-mbaas.logs":       "",
+		"analysis.json":                           string(analysis),
+		"errors.json":                             string(errs),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := WriteSummary(dir); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, summaryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"# RHMAP System Dump Summary\n\n- Dump tool: RHMAP fh-system-dump-tool 1.2.3\n",
+		"- OpenShift: v3.3.1.17\n",
+		"<summary>oc version</summary>\n\n```\noc v3.3.1.7\n",
+		"| Project | events | pods | pods not running |\n|---|---:|---:|---:|\n| core | 0 | 2 | 1 |\n| mbaas | - | 1 | 0 |\n",
+		"2 of 4 checks failed.\n\n<details>\n<summary>[critical] mbaas: check number of replicas in deployment configs</summary>\n\n",
+		"- the replica parameter is set to 0 \\| fix it\n\nSee: https://example.com/dc-replicas\n</details>\n",
+		"<summary>[warning] core: check event log for errors</summary>",
+		"3 errors, 2 of them ignorable and not listed.",
+		"<summary>1 errors in collector logs, project core</summary>\n\n- `oc logs pod`: exit status 1\n</details>\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "collector nagios") {
+		t.Errorf("summary lists groups with only ignorable errors:\n%s", got)
+	}
+}
+
+func TestWriteSummaryEmptyDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-summary-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := WriteSummary(dir); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, summaryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"0 of 0 checks failed.", "No errors."} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("summary does not contain %q:\n%s", want, b)
+		}
+	}
+}
@@ -3,13 +3,11 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 // A Task performs some part of the RHMAP System Dump Tool.
@@ -20,13 +18,19 @@ type Logger interface {
 	Printf(format string, v ...interface{})
 }
 
-// RunAllDumpTasks runs all tasks known to the dump tool using concurrent
-// workers and returns task errors. Dump output goes to path. Progress is
-// communicated by writing to out.
-func RunAllDumpTasks(runner Runner, path string, workers int, out io.Writer) []error {
+// RunAllDumpTasks runs all tasks generated by the given collectors with the
+// settings in cfg using concurrent workers and returns task errors. Progress is
+// reported to progress.
+func RunAllDumpTasks(runner Runner, collectors []Collector, cfg Config, workers int, progress ProgressReporter) []error {
+	return runTasks(GetAllDumpTasks(runner, collectors, cfg), workers, progress)
+}
+
+// runTasks runs tasks using concurrent workers until the tasks channel is
+// closed, and returns task errors. Progress is reported to progress.
+func runTasks(tasks <-chan Task, workers int, progress ProgressReporter) []error {
 	var errs []error
 
-	tasks := GetAllDumpTasks(runner, path)
+	tasks = trackTasks(tasks, progress)
 	results := make(chan error)
 
 	// Start worker goroutines to run tasks concurrently.
@@ -47,191 +51,210 @@ func RunAllDumpTasks(runner Runner, path string, workers int, out io.Writer) []e
 		close(results)
 	}()
 
-	// Loop through the task execution results and log errors.
+	// Loop through the task execution results and collect errors.
 	for err := range results {
 		if err != nil {
-			errs = append(errs, err)
+			errs = append(errs, flattenErrors(err)...)
 		}
-		fmt.Fprint(out, ".")
+		progress.TaskDone(err)
 	}
-	fmt.Fprintln(out)
 
 	return errs
 }
 
-// GetAllDumpTasks returns a channel of all tasks known to the dump tool. It returns
-// immediately and sends tasks to the channel in a separate goroutine. The
-// channel is closed after all tasks are sent.
-// FIXME: GetAllDumpTasks should not need to know about basepath.
-func GetAllDumpTasks(runner Runner, basepath string) <-chan Task {
+// trackTasks forwards tasks from in to the returned channel, reporting each
+// task to progress as soon as it is generated, so that the total number of
+// tasks is known ahead of running them. Tasks are queued as needed. The
+// returned channel is closed after in is closed and all tasks are forwarded.
+func trackTasks(in <-chan Task, progress ProgressReporter) <-chan Task {
+	out := make(chan Task)
+	go func() {
+		defer close(out)
+		var queue []Task
+		for in != nil || len(queue) > 0 {
+			// Sending is only enabled when there is a queued task,
+			// since sending on a nil channel blocks forever.
+			var (
+				send chan<- Task
+				next Task
+			)
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+			select {
+			case task, ok := <-in:
+				if !ok {
+					in = nil
+					progress.AllTasksAdded()
+					continue
+				}
+				progress.TaskAdded()
+				queue = append(queue, task)
+			case send <- next:
+				queue = queue[1:]
+			}
+		}
+	}()
+	return out
+}
+
+// GetAllDumpTasks returns a channel of all tasks generated by the given
+// collectors with the settings in cfg. It returns immediately and sends tasks
+// to the channel in a separate goroutine. The channel is closed after all tasks
+// are sent.
+func GetAllDumpTasks(runner Runner, collectors []Collector, cfg Config) <-chan Task {
 	tasks := make(chan Task)
 	go func() {
 		defer close(tasks)
 
-		projects, err := GetProjects(runner)
+		projects, err := getDumpProjects(runner, cfg.Projects)
 		if err != nil {
 			tasks <- NewError(err)
 			return
 		}
-		if len(projects) == 0 {
-			tasks <- NewError(errors.New("no projects visible to the currently logged in user"))
-			return
+
+		env := CollectorEnv{
+			Runner:          runner,
+			Projects:        projects,
+			MaxLogLines:     cfg.MaxLogLines,
+			ResourceFactory: podNameFactory(resourceMatchFactory(runner), cfg.PodNames),
+			Config:          cfg,
 		}
 
+		// Collectors generate tasks concurrently. Errors of their
+		// tasks are attributed to them.
 		var wg sync.WaitGroup
-
-		// Add tasks to fetch OpenShift metadata.
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			GetOpenShiftMetadataTasks(tasks, runner, projects)
-		}()
-
-		// Add tasks to fetch resource definitions.
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			resources := []string{
-				"deploymentconfigs", "pods", "services",
-				"events", "persistentvolumeclaims", "configmaps",
-			}
-			GetResourceDefinitionTasks(tasks, runner, projects, resources)
-
-			// For cluster-scoped resources we need only one task to
-			// fetch all definitions, instead of one per project.
-			clusterScoped := []string{"persistentvolumes", "nodes"}
-			for _, resource := range clusterScoped {
-				tasks <- ResourceDefinition(runner, "", resource)
-			}
-		}()
-
-		// Add tasks to fetch logs.
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			// We should only care about logs for pods, because they
-			// cover all other possible types.
-			resourcesWithLogs := []string{"pods"}
-			// FIXME: we should not be accessing a flag value
-			// (global) here, instead take maxLines as an argument.
-			GetFetchLogsTasks(tasks, runner, projects, resourcesWithLogs, *maxLogLines)
-		}()
-
-		// Add tasks to fetch Nagios data.
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			GetNagiosTasks(tasks, runner, projects)
-		}()
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			GetMillicoreConfigTasks(tasks, runner, projects, getResourceNamesBySubstr)
-		}()
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			tasks <- GetOcAdmDiagnosticsTask(runner)
-		}()
+		for _, c := range collectors {
+			c := c
+			collectorTasks := make(chan Task)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				defer close(collectorTasks)
+				c.Tasks(collectorTasks, env)
+			}()
+			go func() {
+				defer wg.Done()
+				for task := range collectorTasks {
+					tasks <- attributeErrors(c.Name(), task)
+				}
+			}()
+		}
 		wg.Wait()
 	}()
 	return tasks
 }
 
-// RunAllAnalysisTasks runs all tasks known to the analysis tool using concurrent workers.
-func RunAllAnalysisTasks(runner Runner, path string, workers int) AnalysisResult {
+// RunAllAnalysisTasks runs the given checks against the dump in path for the
+// given projects, or all visible projects if empty, using concurrent workers,
+// and returns the analysis result and task errors. The result is also written
+// to analysis.json in path, as an AnalysisReport of a dump started at
+// dumpStarted. Progress is reported to progress.
+func RunAllAnalysisTasks(runner Runner, checks []Check, path string, dumpStarted time.Time, projects []string, workers int, progress ProgressReporter) (AnalysisResult, []error) {
 	analysisResults := make(chan AnalysisResult)
-	tasks := GetAllAnalysisTasks(runner, path, analysisResults)
-	results := make(chan error)
-
-	// Start worker goroutines to run tasks concurrently.
-	var wg sync.WaitGroup
-	wg.Add(workers)
-	for i := 0; i < workers; i++ {
-		go func() {
-			defer wg.Done()
-			for task := range tasks {
-				results <- task()
-			}
-		}()
-	}
+	tasks := GetAllAnalysisTasks(runner, checks, path, projects, analysisResults)
 
-	// Listen to the checkResults channel and write all the results into
+	// Listen to the analysisResults channel and write all the results into
 	// the analysis.json file
-	var writeWait sync.WaitGroup
+	var (
+		writeWait      sync.WaitGroup
+		analysisResult AnalysisResult
+		writeErr       error
+	)
 	writeWait.Add(1)
-	var analysisResult AnalysisResult
-
 	go func() {
 		defer writeWait.Done()
 		filepath := filepath.Join(path, "analysis.json")
-		err := os.MkdirAll(path, 0770)
-		if err != nil {
-			results <- err
-			return
+		if err := os.MkdirAll(path, 0770); err != nil {
+			writeErr = err
+		}
+		report := AnalysisReport{
+			SchemaVersion:     AnalysisSchemaVersion,
+			ToolVersion:       Version,
+			DumpStartedAt:     dumpStarted,
+			AnalysisStartedAt: time.Now().UTC(),
+			Cluster:           readClusterInfo(path),
 		}
 
 		for result := range analysisResults {
-			analysisResult.Platform = append(analysisResult.Platform, result.Platform...)
-			analysisResult.Projects = append(analysisResult.Projects, result.Projects...)
+			analysisResult.Merge(result)
+			if writeErr != nil {
+				continue
+			}
 
-			output, err := json.MarshalIndent(analysisResult, "", "    ")
+			report.GeneratedAt = time.Now().UTC()
+			report.AnalysisResult = analysisResult
+			output, err := json.MarshalIndent(report, "", "    ")
 			if err != nil {
-				results <- err
+				writeErr = err
+				continue
+			}
+			if err := ioutil.WriteFile(filepath, []byte(output), 0644); err != nil {
+				writeErr = err
 			}
-			ioutil.WriteFile(filepath, []byte(output), 0644)
 		}
 	}()
 
-	// Wait for all workers to terminate, then close the results channel to
-	// communicate that no more results will be sent.
-	go func() {
-		wg.Wait()
-		close(analysisResults)
-		close(results)
-	}()
+	errs := runTasks(tasks, workers, progress)
 
-	// Loop through the task execution results and log errors.
-	for err := range results {
-		if err != nil {
-			// TODO: there should be a way to identify which task
-			// had an error.
-			fmt.Fprintln(os.Stderr)
-			log.Printf("Task error: %v", err)
-			continue
-		}
-		fmt.Fprint(os.Stderr, ".")
-	}
-	fmt.Fprintln(os.Stderr)
+	// All tasks are done, no more results will be sent.
+	close(analysisResults)
 	writeWait.Wait()
-	return analysisResult
+	if writeErr != nil {
+		errs = append(errs, writeErr)
+	}
+	return analysisResult, errs
 }
 
-// GetAllAnalysisTasks returns a channel of all the analysis tasks known to the dump tool. It returns
-// immediately and sends tasks to the channel in a separate goroutine. The channel is closed after
-// all tasks are sent.
+// GetAllAnalysisTasks returns a channel of all the analysis tasks known to the dump tool, for the
+// given projects or all visible projects if empty. It returns immediately and sends tasks to the
+// channel in a separate goroutine. The channel is closed after all tasks are sent.
 // FIXME: GetAllAnalysisTasks should not need to know about basepath.
-func GetAllAnalysisTasks(runner Runner, basepath string, results chan<- AnalysisResult) <-chan Task {
+func GetAllAnalysisTasks(runner Runner, checks []Check, basepath string, only []string, results chan<- AnalysisResult) <-chan Task {
 	tasks := make(chan Task)
 	go func() {
 		defer close(tasks)
 
 		projects, err := GetProjects(runner)
+		if err == nil {
+			projects, err = filterProjects(projects, only)
+		}
 		if err != nil {
 			tasks <- NewError(err)
 			return
 		}
 
-		GetAnalysisTasks(tasks, basepath, projects, results)
+		GetAnalysisTasks(tasks, checks, basepath, projects, results)
 
 	}()
 
 	return tasks
 }
 
+// getDumpProjects returns the projects to dump: the visible projects that are
+// in only, or all visible projects if only is empty.
+func getDumpProjects(runner Runner, only []string) ([]string, error) {
+	projects, err := GetProjects(runner)
+	if err != nil {
+		return nil, newTaskError("", err)
+	}
+	if len(projects) == 0 {
+		return nil, errors.New("no projects visible to the currently logged in user")
+	}
+	return filterProjects(projects, only)
+}
+
+// attributeErrors returns a Task that runs task, attributing its error to the
+// named collector.
+func attributeErrors(collector string, task Task) Task {
+	return func() error {
+		if err := task(); err != nil {
+			return newTaskError(collector, err)
+		}
+		return nil
+	}
+}
+
 // NewError returns a Task that always return the given error.
 func NewError(err error) Task {
 	return func() error { return err }
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/feedhenry/fh-system-dump-tool/openshift/api/types"
+)
+
+// A TimelineEntry is something that happened to an object at a point in time.
+type TimelineEntry struct {
+	Time    time.Time `json:"time"`
+	Project string    `json:"project,omitempty"`
+	// Object identifies what the entry is about, e.g. pod/mongodb-1-abcde
+	// or node/node1.example.com.
+	Object string `json:"object"`
+	// Source tells where the entry was derived from: event, log,
+	// previous-log, nagios or snapshot.
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+// A Timeline is a list of entries in chronological order.
+type Timeline []TimelineEntry
+
+// Sort sorts the timeline chronologically, keeping entries with the same time
+// in their original order.
+func (t Timeline) Sort() {
+	sort.Stable(t)
+}
+
+func (t Timeline) Len() int           { return len(t) }
+func (t Timeline) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t Timeline) Less(i, j int) bool { return t[i].Time.Before(t[j].Time) }
+
+// writeTimeline writes timeline as JSON to path, creating parent directories
+// if necessary.
+func writeTimeline(timeline Timeline, path string) error {
+	if timeline == nil {
+		timeline = Timeline{}
+	}
+	b, err := json.MarshalIndent(timeline, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0660)
+}
+
+// timelineTimeFormat is the layout of times in the text view of a timeline.
+const timelineTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// WriteTimeline builds the timeline of the dump in basepath and writes it to
+// timeline.json, and as text to timeline.txt.
+func WriteTimeline(basepath string) error {
+	timeline, err := BuildTimeline(basepath)
+	if err != nil {
+		return err
+	}
+	if err := writeTimeline(timeline, filepath.Join(basepath, "timeline.json")); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(basepath, "timeline.txt"))
+	if err != nil {
+		return err
+	}
+	PrintTimeline(timeline, f)
+	return f.Close()
+}
+
+// BuildTimeline merges events, timestamped log lines of current and previous
+// containers, Nagios state changes and, if present, the snapshot timeline of
+// the dump in dir into a single timeline. Files that could not be fetched or
+// parsed are skipped.
+func BuildTimeline(dir string) (Timeline, error) {
+	var timeline Timeline
+	projectDirs, err := filepath.Glob(filepath.Join(dir, "projects", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, projectDir := range projectDirs {
+		project := filepath.Base(projectDir)
+
+		var events types.EventList
+		if err := load(filepath.Join(projectDir, "definitions", "events.json"), &events); err == nil {
+			for _, event := range events.Items {
+				if event.LastTimestamp.IsZero() {
+					continue
+				}
+				timeline = append(timeline, eventTimelineEntry(project, event))
+			}
+		}
+
+		for _, logs := range []struct{ dir, source string }{
+			{"logs", "log"},
+			{"logs-previous", "previous-log"},
+		} {
+			paths, err := filepath.Glob(filepath.Join(projectDir, logs.dir, "*.logs"))
+			if err != nil {
+				return nil, err
+			}
+			for _, path := range paths {
+				entries, err := loadLogTimeline(path, project, logs.source)
+				if err != nil {
+					return nil, err
+				}
+				timeline = append(timeline, entries...)
+			}
+		}
+
+		entries, err := loadNagiosTimeline(filepath.Join(projectDir, "nagios"), project)
+		if err != nil {
+			return nil, err
+		}
+		timeline = append(timeline, entries...)
+	}
+
+	var snapshots Timeline
+	if err := load(filepath.Join(dir, snapshotsDir, "timeline.json"), &snapshots); err == nil {
+		timeline = append(timeline, snapshots...)
+	}
+
+	timeline.Sort()
+	return timeline, nil
+}
+
+// eventTimelineEntry converts an event into a timeline entry, using the time
+// the event was last seen.
+func eventTimelineEntry(project string, event types.Event) TimelineEntry {
+	entry := TimelineEntry{
+		Time:    event.LastTimestamp,
+		Project: project,
+		Object:  strings.ToLower(event.InvolvedObject.Kind) + "/" + event.InvolvedObject.Name,
+		Source:  "event",
+		Message: fmt.Sprintf("%s %s: %s", event.Type, event.Reason, event.Message),
+	}
+	if event.Count > 1 {
+		entry.Message += fmt.Sprintf(" (x%d)", event.Count)
+	}
+	return entry
+}
+
+// loadLogTimeline loads the timestamped lines of a log file written by ocLogs
+// as timeline entries. Lines without a timestamp are skipped.
+func loadLogTimeline(path, project, source string) (Timeline, error) {
+	// File names are <type>_<name>_<container>.logs, and neither resource
+	// names nor container names contain underscores.
+	parts := strings.SplitN(strings.TrimSuffix(filepath.Base(path), ".logs"), "_", 3)
+	if len(parts) < 2 {
+		return nil, nil
+	}
+	object := strings.TrimSuffix(parts[0], "s") + "/" + parts[1]
+	var prefix string
+	if len(parts) == 3 {
+		prefix = parts[2] + ": "
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var timeline Timeline
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			continue
+		}
+		var msg string
+		if len(fields) == 2 {
+			msg = fields[1]
+		}
+		timeline = append(timeline, TimelineEntry{
+			Time:    t,
+			Project: project,
+			Object:  object,
+			Source:  source,
+			Message: prefix + msg,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return timeline, nil
+}
+
+// loadNagiosTimeline loads the Nagios state changes found in the status and
+// historical data within dir as timeline entries. State changes found in
+// both are only included once.
+func loadNagiosTimeline(dir, project string) (Timeline, error) {
+	var changes []NagiosStateChange
+	for _, data := range []struct {
+		pattern string
+		parse   func(io.Reader) ([]NagiosStateChange, error)
+	}{
+		{"*_history.tar", parseNagiosHistory},
+		{"*_status.dat", parseNagiosStatus},
+	} {
+		paths, err := filepath.Glob(filepath.Join(dir, data.pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			// Archives may be truncated if the dump was
+			// interrupted, keep what could be parsed.
+			c, _ := data.parse(f)
+			f.Close()
+			changes = append(changes, c...)
+		}
+	}
+
+	var timeline Timeline
+	seen := make(map[TimelineEntry]bool)
+	for _, c := range changes {
+		object := "nagios/" + c.Host
+		if c.Service != "" {
+			object += "/" + c.Service
+		}
+		entry := TimelineEntry{
+			Time:    c.Time,
+			Project: project,
+			Object:  object,
+			Source:  "nagios",
+			Message: c.State + ": " + c.Output,
+		}
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		timeline = append(timeline, entry)
+	}
+	return timeline, nil
+}
+
+// A TimelineFilter selects timeline entries by project and component. Empty
+// lists match all entries.
+type TimelineFilter struct {
+	Projects []string
+	// Components are matched against any part of the object name, e.g.
+	// mongodb matches pod/mongodb-1-1-abcde.
+	Components []string
+}
+
+// Filter returns the entries of t matching f.
+func (f TimelineFilter) Filter(t Timeline) Timeline {
+	var filtered Timeline
+	for _, entry := range t {
+		if len(f.Projects) > 0 && !contains(f.Projects, entry.Project) {
+			continue
+		}
+		if len(f.Components) > 0 {
+			found := false
+			for _, c := range f.Components {
+				if strings.Contains(entry.Object, c) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
+
+// PrintTimeline writes a human-readable view of timeline to out, one entry per
+// line.
+func PrintTimeline(timeline Timeline, out io.Writer) {
+	for _, entry := range timeline {
+		project := entry.Project
+		if project == "" {
+			project = "-"
+		}
+		fmt.Fprintf(out, "%s %s %s [%s] %s\n", entry.Time.UTC().Format(timelineTimeFormat), project, entry.Object, entry.Source, entry.Message)
+	}
+}
+
+// timelineCommand implements the timeline subcommand, that prints the timeline
+// of an existing dump.
+func timelineCommand(args []string) error {
+	fs := flag.NewFlagSet("timeline", flag.ExitOnError)
+	projects := fs.String("project", "", "comma-separated list of projects to include (default all)")
+	components := fs.String("component", "", "comma-separated list of components to include, matched against object names (default all)")
+	jsonPath := fs.String("json", "", "also write the timeline as JSON to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fh-system-dump-tool timeline [flags] <dump>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Prints events, logs and Nagios state changes of a dump, given as a directory or archive, in chronological order.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("timeline requires exactly one dump")
+	}
+
+	dir, cleanup, err := OpenDump(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	timeline, err := BuildTimeline(dir)
+	if err != nil {
+		return err
+	}
+	filter := TimelineFilter{
+		Projects:   splitList(*projects),
+		Components: splitList(*components),
+	}
+	timeline = filter.Filter(timeline)
+
+	PrintTimeline(timeline, os.Stdout)
+
+	if *jsonPath != "" {
+		return writeTimeline(timeline, *jsonPath)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-timeline-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var history bytes.Buffer
+	tw := tar.NewWriter(&history)
+	nagiosLog := "[1483264810] SERVICE ALERT: mongodb;Ping;CRITICAL;HARD;1;connection refused\n" +
+		"[1483264815] Auto-save of retention data completed successfully.\n"
+	if err := tw.WriteHeader(&tar.Header{Name: "archives/nagios-01-01-2017-10.log", Mode: 0600, Size: int64(len(nagiosLog)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(nagiosLog)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeDumpFiles(t, dir, map[string]string{
+		"projects/core/definitions/events.json": `{"items": [
+			{"involvedObject": {"kind": "Pod", "name": "mongodb-1-abcde"}, "type": "Warning", "reason": "Unhealthy", "message": "Liveness probe failed", "count": 3, "lastTimestamp": "2017-01-01T10:00:05Z"},
+			{"involvedObject": {"kind": "Pod", "name": "mongodb-1-abcde"}, "type": "Normal", "reason": "Pulled", "message": "no timestamp"}
+		]}`,
+		"projects/core/logs/pods_mongodb-1-abcde_mongodb.logs": "2017-01-01T10:00:00.5Z starting\n" +
+			"2017-01-01T10:00:20Z ready\n",
+		"projects/core/logs-previous/pods_mongodb-1-abcde_mongodb.logs": "2017-01-01T09:59:59Z exiting\n" +
+			"not timestamped\n",
+		"projects/core/nagios/nagios-1-abcde_status.dat": "hoststatus {\n\thost_name=mongodb\n\t}\n" +
+			"servicestatus {\n\thost_name=mongodb\n\tservice_description=Ping\n\tcurrent_state=2\n\tlast_state_change=1483264810\n\tplugin_output=connection refused\n\t}\n",
+		"projects/core/nagios/nagios-1-abcde_history.tar": history.String(),
+		"snapshots/timeline.json":                         `[{"time": "2017-01-01T10:00:15Z", "project": "core", "object": "pod/mongodb-1-abcde", "source": "snapshot", "message": "pod phase changed from Running to Pending"}]`,
+	})
+
+	timeline, err := BuildTimeline(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+	want := Timeline{
+		{Time: t0.Add(-time.Second), Project: "core", Object: "pod/mongodb-1-abcde", Source: "previous-log", Message: "mongodb: exiting"},
+		{Time: t0.Add(500 * time.Millisecond), Project: "core", Object: "pod/mongodb-1-abcde", Source: "log", Message: "mongodb: starting"},
+		{Time: t0.Add(5 * time.Second), Project: "core", Object: "pod/mongodb-1-abcde", Source: "event", Message: "Warning Unhealthy: Liveness probe failed (x3)"},
+		{Time: t0.Add(10 * time.Second), Project: "core", Object: "nagios/mongodb/Ping", Source: "nagios", Message: "CRITICAL: connection refused"},
+		{Time: t0.Add(15 * time.Second), Project: "core", Object: "pod/mongodb-1-abcde", Source: "snapshot", Message: "pod phase changed from Running to Pending"},
+		{Time: t0.Add(20 * time.Second), Project: "core", Object: "pod/mongodb-1-abcde", Source: "log", Message: "mongodb: ready"},
+	}
+	if len(timeline) != len(want) {
+		t.Fatalf("len(timeline) = %d, want %d:\n%+v", len(timeline), len(want), timeline)
+	}
+	for i := range want {
+		if !timeline[i].Time.Equal(want[i].Time) {
+			t.Errorf("timeline[%d].Time = %v, want %v", i, timeline[i].Time, want[i].Time)
+		}
+		timeline[i].Time = want[i].Time
+		if !reflect.DeepEqual(timeline[i], want[i]) {
+			t.Errorf("timeline[%d] = %+v, want %+v", i, timeline[i], want[i])
+		}
+	}
+}
+
+func TestTimelineFilter(t *testing.T) {
+	timeline := Timeline{
+		{Project: "core", Object: "pod/mongodb-1-abcde"},
+		{Project: "core", Object: "pod/fh-ngui-1-abcde"},
+		{Project: "mbaas", Object: "pod/mongodb-1-fghij"},
+		{Object: "node/node1"},
+	}
+	tests := []struct {
+		filter TimelineFilter
+		want   Timeline
+	}{
+		{
+			filter: TimelineFilter{},
+			want:   timeline,
+		},
+		{
+			filter: TimelineFilter{Projects: []string{"core"}},
+			want:   timeline[:2],
+		},
+		{
+			filter: TimelineFilter{Components: []string{"mongodb", "node"}},
+			want:   Timeline{timeline[0], timeline[2], timeline[3]},
+		},
+		{
+			filter: TimelineFilter{Projects: []string{"mbaas"}, Components: []string{"fh-ngui"}},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Filter(timeline); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v.Filter(timeline) = %+v, want %+v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestPrintTimeline(t *testing.T) {
+	timeline := Timeline{
+		{Time: time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC), Object: "node/node1", Source: "snapshot", Message: "node Ready condition is False"},
+		{Time: time.Date(2017, 1, 1, 10, 0, 0, 500000000, time.UTC), Project: "core", Object: "pod/mongodb-1-abcde", Source: "log", Message: "mongodb: starting"},
+	}
+	var out bytes.Buffer
+	PrintTimeline(timeline, &out)
+	want := "2017-01-01T10:00:00.000Z - node/node1 [snapshot] node Ready condition is False\n" +
+		"2017-01-01T10:00:00.500Z core pod/mongodb-1-abcde [log] mongodb: starting\n"
+	if got := out.String(); got != want {
+		t.Errorf("PrintTimeline(...) = %q, want %q", got, want)
+	}
+}
+
+func TestLoadNagiosTimelineTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-timeline-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var history bytes.Buffer
+	tw := tar.NewWriter(&history)
+	logs := []string{
+		"[1483264800] HOST ALERT: mongodb;DOWN;HARD;1;unreachable\n",
+		"[1483264810] SERVICE ALERT: mongodb;Ping;CRITICAL;HARD;1;connection refused\n" +
+			"[1483264820] SERVICE ALERT: mongodb;Ping;OK;HARD;1;pong\n",
+	}
+	for i, log := range logs {
+		if err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("archives/nagios-%d.log", i), Mode: 0600, Size: int64(len(log)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(log)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Cut the archive in the middle of the last alert, as an interrupted
+	// dump would.
+	b := history.Bytes()
+	truncated := b[:bytes.Index(b, []byte("Ping;OK"))]
+	if err := ioutil.WriteFile(filepath.Join(dir, "nagios-1-abcde_history.tar"), truncated, 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	timeline, err := loadNagiosTimeline(dir, "core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range timeline {
+		got = append(got, entry.Object+": "+entry.Message)
+	}
+	want := []string{"nagios/mongodb: DOWN: unreachable", "nagios/mongodb/Ping: CRITICAL: connection refused"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("timeline = %q, want %q", got, want)
+	}
+}
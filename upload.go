@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Methods of uploading to HTTP endpoints.
+const (
+	// UploadPut sends the archive as the body of a PUT request, as
+	// expected by pre-signed S3 URLs.
+	UploadPut = "put"
+	// UploadPost sends the archive as the file field of a
+	// multipart/form-data POST request.
+	UploadPost = "post"
+)
+
+const (
+	// uploadAttempts is how many times a failed request is tried.
+	uploadAttempts = 4
+	// uploadBackoff is the delay before retrying a failed request,
+	// doubled for each retry.
+	uploadBackoff = 2 * time.Second
+)
+
+// An Uploader uploads dump archives.
+type Uploader interface {
+	// Upload uploads the file at path and returns where it was uploaded
+	// to.
+	Upload(path string) (string, error)
+}
+
+// UploadOptions holds the settings of uploads that are not part of the
+// target.
+type UploadOptions struct {
+	// Method is how to upload to HTTP endpoints, UploadPut or UploadPost.
+	Method string
+	// S3Endpoint is the URL of an S3-compatible service. Empty means AWS.
+	S3Endpoint string
+	S3Region   string
+	// Credentials of S3 uploads.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// NewUploader returns an Uploader for target, an http or https URL, e.g. a
+// pre-signed S3 URL, or an s3://bucket/key URL. S3 keys ending with a slash,
+// or empty, are prefixes to which the archive name is appended.
+func NewUploader(target string, opts UploadOptions) (Uploader, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		method := opts.Method
+		if method == "" {
+			method = UploadPut
+		}
+		if method != UploadPut && method != UploadPost {
+			return nil, fmt.Errorf("invalid upload method %q, must be %s or %s", method, UploadPut, UploadPost)
+		}
+		return &httpUploader{
+			client: http.DefaultClient,
+			url:    target,
+			method: method,
+			sleep:  time.Sleep,
+		}, nil
+	case "s3":
+		if u.Host == "" {
+			return nil, errors.New("missing bucket in S3 upload target")
+		}
+		if opts.AccessKey == "" || opts.SecretKey == "" {
+			return nil, errors.New("S3 uploads require credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		region := opts.S3Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint := opts.S3Endpoint
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+		e, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint: %v", err)
+		}
+		return &s3Uploader{
+			client:   http.DefaultClient,
+			endpoint: e,
+			region:   region,
+			bucket:   u.Host,
+			key:      strings.TrimPrefix(u.Path, "/"),
+			creds:    s3Credentials{opts.AccessKey, opts.SecretKey, opts.SessionToken},
+			partSize: s3PartSize,
+			now:      time.Now,
+			sleep:    time.Sleep,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported upload target %q, must be an http, https or s3 URL", target)
+}
+
+// httpUploader uploads to an HTTP endpoint with a single request. Uploads are
+// not resumable: there is no standard way to resume them across servers, so
+// each attempt sends the whole file.
+type httpUploader struct {
+	client *http.Client
+	url    string
+	method string
+	sleep  func(time.Duration)
+}
+
+var _ Uploader = (*httpUploader)(nil)
+
+// Upload uploads the file at path, retrying failed requests. The MD5 checksum
+// of the file is sent in the Content-MD5 header, and compared to the ETag of
+// the response if it looks like one.
+func (u *httpUploader) Upload(path string) (string, error) {
+	sum, err := fileMD5(path)
+	if err != nil {
+		return "", err
+	}
+	var location string
+	err = retryUpload(u.sleep, func() (bool, error) {
+		resp, err := u.send(path, sum)
+		if err != nil {
+			return true, err
+		}
+		defer resp.Body.Close()
+		if err := checkUploadResponse(resp); err != nil {
+			return retryableStatus(resp.StatusCode), err
+		}
+		if err := checkETag(resp.Header.Get("ETag"), sum); err != nil {
+			return false, err
+		}
+		location = u.url
+		if l := resp.Header.Get("Location"); l != "" {
+			location = l
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	// Do not disclose signatures of pre-signed URLs in logs.
+	if i := strings.Index(location, "?"); i >= 0 {
+		location = location[:i]
+	}
+	return location, nil
+}
+
+// send sends the file at path in a single request.
+func (u *httpUploader) send(path string, sum []byte) (*http.Response, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	if u.method == UploadPost {
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		go func() {
+			part, err := mw.CreateFormFile("file", filepath.Base(path))
+			if err == nil {
+				_, err = io.Copy(part, f)
+			}
+			if err == nil {
+				err = mw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		req, err = http.NewRequest("POST", u.url, pr)
+		if err != nil {
+			pr.Close()
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+	} else {
+		req, err = http.NewRequest("PUT", u.url, f)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = fi.Size()
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum))
+	}
+	return u.client.Do(req)
+}
+
+// retryUpload calls try until it succeeds, returns a permanent error, or
+// uploadAttempts attempts failed. Try returns whether its error is
+// temporary.
+func retryUpload(sleep func(time.Duration), try func() (retry bool, err error)) error {
+	backoff := uploadBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := try()
+		if err == nil || !retry || attempt == uploadAttempts {
+			return err
+		}
+		sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// checkUploadResponse returns an error if resp is not successful, including
+// the start of the response body.
+func checkUploadResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	msg := strings.TrimSpace(string(b))
+	if msg == "" {
+		return fmt.Errorf("upload failed: %s", resp.Status)
+	}
+	return fmt.Errorf("upload failed: %s: %s", resp.Status, msg)
+}
+
+// retryableStatus reports whether a request failing with the given status
+// code may succeed if retried.
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+}
+
+// checkETag returns an error if etag is a hex-encoded MD5 checksum that
+// differs from sum. Other ETags are ignored, since their meaning depends on
+// the server.
+func checkETag(etag string, sum []byte) error {
+	etag = strings.Trim(etag, `"`)
+	if len(etag) != 2*md5.Size {
+		return nil
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return nil
+	}
+	if want := hex.EncodeToString(sum); !strings.EqualFold(etag, want) {
+		return fmt.Errorf("checksum mismatch: server received data with MD5 %s, want %s", etag, want)
+	}
+	return nil
+}
+
+// fileMD5 returns the MD5 checksum of the file at path.
+func fileMD5(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// uploadFlags registers the flags configuring uploads in fs.
+func uploadFlags(fs *flag.FlagSet) *UploadOptions {
+	opts := &UploadOptions{}
+	fs.StringVar(&opts.Method, "upload-method", UploadPut, "how to upload to http and https URLs: put, or post for a multipart form with a file field")
+	fs.StringVar(&opts.S3Endpoint, "s3-endpoint", "", "URL of an S3-compatible service for s3:// uploads (default AWS)")
+	fs.StringVar(&opts.S3Region, "s3-region", "", "region of s3:// uploads (default $AWS_REGION or us-east-1)")
+	return opts
+}
+
+// newUploaderFromEnv returns an Uploader for target, taking S3 credentials and
+// the default region from the standard AWS environment variables.
+func newUploaderFromEnv(target string, opts UploadOptions) (Uploader, error) {
+	opts.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	opts.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	opts.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	if opts.S3Region == "" {
+		opts.S3Region = os.Getenv("AWS_REGION")
+	}
+	return NewUploader(target, opts)
+}
+
+// uploadCommand implements the upload subcommand, that uploads an existing
+// dump archive, resuming interrupted S3 uploads.
+func uploadCommand(args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	opts := uploadFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: fh-system-dump-tool upload [flags] <archive> <target>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Uploads a dump archive to an http, https or s3:// URL. Interrupted S3 uploads are resumed, http and https uploads start over.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("upload requires an archive and a target")
+	}
+	uploader, err := newUploaderFromEnv(fs.Arg(1), *opts)
+	if err != nil {
+		return err
+	}
+	location, err := uploader.Upload(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Uploaded to:", location)
+	return nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeTempUpload writes data to a temporary file and returns its path.
+func writeTempUpload(t *testing.T, data []byte) string {
+	f, err := ioutil.TempFile("", "test-upload-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func noSleep(time.Duration) {}
+
+func TestHTTPUploader(t *testing.T) {
+	data := []byte("dump archive data")
+	path := writeTempUpload(t, data)
+	defer os.Remove(path)
+	sum := md5.Sum(data)
+
+	tests := []struct {
+		method  string
+		handler func(attempt int, w http.ResponseWriter, r *http.Request, body []byte)
+		wantErr string
+	}{
+		{UploadPut, func(attempt int, w http.ResponseWriter, r *http.Request, body []byte) {
+			if r.Method != "PUT" || !bytes.Equal(body, data) || r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		}, ""},
+		// Server errors are retried.
+		{UploadPut, func(attempt int, w http.ResponseWriter, r *http.Request, body []byte) {
+			if attempt < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}, ""},
+		{UploadPut, func(attempt int, w http.ResponseWriter, r *http.Request, body []byte) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, "503 Service Unavailable"},
+		{UploadPut, func(attempt int, w http.ResponseWriter, r *http.Request, body []byte) {
+			if attempt > 1 {
+				w.WriteHeader(http.StatusTeapot)
+				return
+			}
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "expired")
+		}, "403 Forbidden: expired"},
+		{UploadPut, func(attempt int, w http.ResponseWriter, r *http.Request, body []byte) {
+			w.Header().Set("ETag", `"0123456789abcdef0123456789abcdef"`)
+		}, "checksum mismatch"},
+		{UploadPost, func(attempt int, w http.ResponseWriter, r *http.Request, body []byte) {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if b, _ := ioutil.ReadAll(f); !bytes.Equal(b, data) {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}, ""},
+	}
+	for i, tt := range tests {
+		attempt := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempt++
+			body, _ := ioutil.ReadAll(r.Body)
+			tt.handler(attempt, w, r, body)
+		}))
+		u, err := NewUploader(srv.URL+"/dump?X-Amz-Signature=secret", UploadOptions{Method: tt.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.(*httpUploader).sleep = noSleep
+		location, err := u.Upload(path)
+		srv.Close()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("#%d: Upload() error = %v, want %q", i, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: Upload() error = %v", i, err)
+			continue
+		}
+		if want := srv.URL + "/dump"; location != want {
+			t.Errorf("#%d: Upload() = %q, want %q", i, location, want)
+		}
+	}
+}
+
+func TestNewUploaderErrors(t *testing.T) {
+	tests := []struct {
+		target  string
+		opts    UploadOptions
+		wantErr string
+	}{
+		{"ftp://host/dump", UploadOptions{}, "unsupported upload target"},
+		{"dump.tar.gz", UploadOptions{}, "unsupported upload target"},
+		{"https://host/dump", UploadOptions{Method: "patch"}, `invalid upload method "patch"`},
+		{"s3:///key", UploadOptions{AccessKey: "a", SecretKey: "s"}, "missing bucket"},
+		{"s3://bucket/key", UploadOptions{}, "require credentials"},
+	}
+	for _, tt := range tests {
+		if _, err := NewUploader(tt.target, tt.opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("NewUploader(%q) error = %v, want %q", tt.target, err, tt.wantErr)
+		}
+	}
+}
+
+// fakeS3 is a minimal S3 multipart upload API.
+type fakeS3 struct {
+	mu       sync.Mutex
+	uploads  map[string]map[int][]byte
+	objects  map[string][]byte
+	requests []string
+	// failPart fails uploads of this part number, if not zero.
+	failPart int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{uploads: make(map[string]map[int][]byte), objects: make(map[string][]byte)}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	q := r.URL.Query()
+	id := q.Get("uploadId")
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path+" "+q.Get("partNumber"))
+	switch {
+	case r.Method == "POST" && q["uploads"] != nil:
+		id = strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case s.uploads[id] == nil:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchUpload</Code><Message>gone</Message></Error>")
+	case r.Method == "PUT":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		if n == s.failPart {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<Error><Code>BadDigest</Code><Message>bad</Message></Error>")
+			return
+		}
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.uploads[id][n] = body
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == "GET":
+		var b bytes.Buffer
+		b.WriteString("<ListPartsResult>")
+		for n, data := range s.uploads[id] {
+			sum := md5.Sum(data)
+			fmt.Fprintf(&b, "<Part><PartNumber>%d</PartNumber><ETag>&quot;%x&quot;</ETag></Part>", n, sum)
+		}
+		b.WriteString("</ListPartsResult>")
+		w.Write(b.Bytes())
+	case r.Method == "POST":
+		var req struct {
+			Parts []s3Part `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var object []byte
+		for i, p := range req.Parts {
+			data, ok := s.uploads[id][p.PartNumber]
+			if sum := md5.Sum(data); !ok || p.PartNumber != i+1 || strings.Trim(p.ETag, `"`) != hex.EncodeToString(sum[:]) {
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code><Message>invalid part</Message></Error>")
+				return
+			}
+			object = append(object, data...)
+		}
+		s.objects[r.URL.Path] = object
+		delete(s.uploads, id)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	}
+}
+
+func newTestS3Uploader(t *testing.T, srv *httptest.Server, target string) *s3Uploader {
+	u, err := NewUploader(target, UploadOptions{S3Endpoint: srv.URL, AccessKey: "AKID", SecretKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3 := u.(*s3Uploader)
+	s3.partSize = 4
+	s3.sleep = noSleep
+	return s3
+}
+
+func TestS3Uploader(t *testing.T) {
+	data := []byte("0123456789")
+	path := writeTempUpload(t, data)
+	defer os.Remove(path)
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	// The first upload fails on the last part, the second resumes it.
+	fake.failPart = 3
+	u := newTestS3Uploader(t, srv, "s3://bucket/dumps/")
+	if _, err := u.Upload(path); err == nil || !strings.Contains(err.Error(), "part 3: 400 Bad Request: BadDigest: bad") {
+		t.Fatalf("Upload() error = %v, want BadDigest", err)
+	}
+	if _, err := os.Stat(path + uploadStateExt); err != nil {
+		t.Fatalf("upload state not saved: %v", err)
+	}
+	fake.failPart = 0
+	fake.requests = nil
+	location, err := u.Upload(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := path[strings.LastIndex(path, "/")+1:]
+	if want := "s3://bucket/dumps/" + base; location != want {
+		t.Errorf("Upload() = %q, want %q", location, want)
+	}
+	objectPath := "/bucket/dumps/" + base
+	wantRequests := []string{"GET " + objectPath + " ", "PUT " + objectPath + " 3", "POST " + objectPath + " "}
+	if strings.Join(fake.requests, "\n") != strings.Join(wantRequests, "\n") {
+		t.Errorf("requests = %q, want %q", fake.requests, wantRequests)
+	}
+	if got := fake.objects[objectPath]; !bytes.Equal(got, data) {
+		t.Errorf("object = %q, want %q", got, data)
+	}
+	if _, err := os.Stat(path + uploadStateExt); !os.IsNotExist(err) {
+		t.Errorf("upload state not removed: %v", err)
+	}
+}
+
+func TestS3UploaderEmptyFile(t *testing.T) {
+	path := writeTempUpload(t, nil)
+	defer os.Remove(path)
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	if _, err := newTestS3Uploader(t, srv, "s3://bucket/empty.tar.gz").Upload(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := fake.objects["/bucket/empty.tar.gz"]; !ok || len(got) != 0 {
+		t.Errorf("object = %q, %v, want empty object", got, ok)
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite.
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := s3Credentials{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	query := url.Values{"uploads": {""}, "b": {"x y/z"}, "a": {"2", "1"}}
+	if got, want := canonicalQuery(query), "a=1&a=2&b=x%20y%2Fz&uploads="; got != want {
+		t.Errorf("canonicalQuery() = %q, want %q", got, want)
+	}
+}